@@ -0,0 +1,16 @@
+package main
+
+import (
+	"shared/config"
+)
+
+// Config is the gateway's configuration. See shared/config for the sources
+// each setting is read from.
+type Config struct {
+	Port               int             `config:"port" default:"4001" validate:"port" usage:"HTTP port"`
+	ApproverPrivateKey string          `config:"approverPrivateKey" validate:"required,hexkey" secret:"true" usage:"private key sent with each request"`
+	Encoding           string          `config:"encoding" default:"json" validate:"oneof=json|protobuf" usage:"encoding of worker requests and replies"`
+	RabbitMQ           config.RabbitMQ `config:"rabbitmq"`
+	Log                config.Log      `config:"log"`
+	Shutdown           config.Shutdown `config:"shutdown"`
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"shared/broker"
+	"shared/codec"
+	"shared/messages"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/streadway/amqp"
+)
+
+const approverKey = "b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291"
+
+// gateway serves the gateway's routes over an in-memory broker, with answer
+// standing in for the worker on both request queues.
+func gateway(t *testing.T, answer func(b broker.Broker, d amqp.Delivery)) (*fiber.App, *RabbitMQHandler) {
+	t.Helper()
+	m := broker.NewMemory()
+	worker := m.Channel()
+	for _, queue := range []broker.Queue{broker.ApprovalQueue, broker.DepositQueue} {
+		if _, err := worker.Declare(queue); err != nil {
+			t.Fatal(err)
+		}
+		requests, err := worker.Consume(queue.Name, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			for d := range requests {
+				answer(worker, d)
+				d.Ack(false)
+			}
+		}()
+	}
+	t.Cleanup(func() { worker.Close() })
+
+	handler := &RabbitMQHandler{Broker: m.Channel()}
+	app := fiber.New()
+	registerRoutes(app, handler, approverKey)
+	return app, handler
+}
+
+func reply(b broker.Broker, d amqp.Delivery, response map[string]string) {
+	body, _ := json.Marshal(response)
+	broker.Reply(b, d, amqp.Publishing{ContentType: "application/json", Body: body})
+}
+
+func post(t *testing.T, app *fiber.App, path, body string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(raw)
+}
+
+func TestApproveForwardsToWorker(t *testing.T) {
+	requests := make(chan amqp.Delivery, 1)
+	app, _ := gateway(t, func(b broker.Broker, d amqp.Delivery) {
+		requests <- d
+		// Replies to other requests on the same queue are ignored
+		b.Publish(d.ReplyTo, amqp.Publishing{CorrelationId: "other", Body: []byte(`{"error":"not yours"}`)})
+		reply(b, d, map[string]string{"message": "Success"})
+	})
+
+	status, body := post(t, app, "/approve", "")
+	if status != fiber.StatusOK || body != `{"response":{"message":"Success"}}` {
+		t.Fatalf("got %d %s", status, body)
+	}
+
+	d := <-requests
+	if d.RoutingKey != broker.ApprovalQueue.Name || d.CorrelationId == "" || d.ReplyTo == "" {
+		t.Fatalf("request sent to %s with correlation ID %q and reply-to %q", d.RoutingKey, d.CorrelationId, d.ReplyTo)
+	}
+	var request map[string]interface{}
+	if err := json.Unmarshal(d.Body, &request); err != nil {
+		t.Fatal(err)
+	}
+	if request["proposalId"] != float64(1) || request["privateKey"] != approverKey {
+		t.Fatalf("request = %v", request)
+	}
+}
+
+func TestDepositRelaysWorkerErrors(t *testing.T) {
+	app, _ := gateway(t, func(b broker.Broker, d amqp.Delivery) {
+		var request map[string]string
+		json.Unmarshal(d.Body, &request)
+		reply(b, d, map[string]string{"error": "cannot deposit " + request["amount"]})
+	})
+
+	status, body := post(t, app, "/deposit", `{"amount":"2"}`)
+	if status != fiber.StatusOK || body != `{"response":{"error":"cannot deposit 2"}}` {
+		t.Fatalf("got %d %s", status, body)
+	}
+
+	status, _ = post(t, app, "/deposit", `{"amount":`)
+	if status != fiber.StatusBadRequest {
+		t.Fatalf("malformed body got %d, want 400", status)
+	}
+}
+
+func TestRequestEndsWhenTheChannelCloses(t *testing.T) {
+	var app *fiber.App
+	var handler *RabbitMQHandler
+	app, handler = gateway(t, func(broker.Broker, amqp.Delivery) {
+		handler.Broker.Close()
+	})
+
+	status, body := post(t, app, "/approve", "")
+	if status != fiber.StatusOK || body != `{"message":"No response received"}` {
+		t.Fatalf("got %d %s", status, body)
+	}
+}
+
+func TestMalformedReply(t *testing.T) {
+	app, _ := gateway(t, func(b broker.Broker, d amqp.Delivery) {
+		broker.Reply(b, d, amqp.Publishing{Body: []byte("oops")})
+	})
+
+	status, body := post(t, app, "/approve", "")
+	if status != fiber.StatusInternalServerError || !strings.Contains(body, "Failed to parse response") {
+		t.Fatalf("got %d %s", status, body)
+	}
+}
+
+func TestProtobufRequests(t *testing.T) {
+	requests := make(chan amqp.Delivery, 1)
+	app, handler := gateway(t, func(b broker.Broker, d amqp.Delivery) {
+		requests <- d
+		msg, _ := codec.Publishing(codec.ReplyContentType(d), &messages.Response{Message: "Success"})
+		broker.Reply(b, d, msg)
+	})
+	handler.ContentType = codec.ContentTypeProtobuf
+
+	status, body := post(t, app, "/deposit", `{"amount":"2"}`)
+	if status != fiber.StatusOK || body != `{"response":{"message":"Success"}}` {
+		t.Fatalf("got %d %s", status, body)
+	}
+	d := <-requests
+	var request messages.DepositRequest
+	if err := codec.Unmarshal(d.ContentType, d.Body, &request); err != nil || request.Amount != "2" || request.PrivateKey != approverKey {
+		t.Fatalf("request %s: %+v, %v", d.ContentType, request, err)
+	}
+	if !codec.IsProtobuf(d.ContentType) || d.Headers[codec.AcceptHeader] != codec.ContentTypeProtobuf {
+		t.Fatalf("request sent as %s accepting %v", d.ContentType, d.Headers[codec.AcceptHeader])
+	}
+}
@@ -1,24 +1,43 @@
 package main
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"shared/broker"
+	"shared/codec"
+	"shared/config"
+	"shared/health"
+	"shared/lifecycle"
+	"shared/logging"
+	"shared/messages"
+	"shared/metrics"
+	"shared/tracing"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/joho/godotenv"
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
+var logger = logging.For("gateway")
+
 type RabbitMQHandler struct {
 	Connection *amqp.Connection
 	Channel    *amqp.Channel
+	Broker     broker.Broker
+
+	// ContentType is the encoding of requests and, through their accept
+	// header, of the worker's replies; JSON if empty.
+	ContentType string
 }
 
 // NewRabbitMQHandler initializes a single RabbitMQ handler.
-func NewRabbitMQHandler() (*RabbitMQHandler, error) {
-	conn, err := amqp.Dial(os.Getenv("RABBITMQ_URL"))
+func NewRabbitMQHandler(rabbitmqURL string) (*RabbitMQHandler, error) {
+	conn, err := amqp.Dial(rabbitmqURL)
 	if err != nil {
 		return nil, err
 	}
@@ -31,12 +50,13 @@ func NewRabbitMQHandler() (*RabbitMQHandler, error) {
 	return &RabbitMQHandler{
 		Connection: conn,
 		Channel:    ch,
+		Broker:     broker.AMQP(ch),
 	}, nil
 }
 
 func (r *RabbitMQHandler) Close() {
-	if r.Channel != nil {
-		r.Channel.Close()
+	if r.Broker != nil {
+		r.Broker.Close()
 	}
 	if r.Connection != nil {
 		r.Connection.Close()
@@ -44,108 +64,64 @@ func (r *RabbitMQHandler) Close() {
 }
 
 // SendRequest is a generic function to send a request to the specified queue and wait for a response.
-func (r *RabbitMQHandler) SendRequest(requestBody map[string]interface{}, routingKey string) (string, <-chan amqp.Delivery, error) {
-	callbackQueue, err := r.Channel.QueueDeclare(
-		"",
-		false,
-		false,
-		true,
-		false,
-		nil,
-	)
-	if err != nil {
-		return "", nil, err
+func (r *RabbitMQHandler) SendRequest(ctx context.Context, correlationID string, request codec.Message, routingKey string) (amqp.Delivery, error) {
+	contentType := r.ContentType
+	if contentType == "" {
+		contentType = codec.ContentTypeJSON
 	}
-
-	msgs, err := r.Channel.Consume(
-		callbackQueue.Name,
-		"",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
+	msg, err := codec.Publishing(contentType, request)
 	if err != nil {
-		return "", nil, err
+		return amqp.Delivery{}, err
 	}
+	msg.CorrelationId = correlationID
+	msg.Headers = tracing.Inject(ctx, amqp.Table{codec.AcceptHeader: contentType})
+	return broker.Call(ctx, r.Broker, routingKey, msg)
+}
+
+// HandleRequest is a generic function to handle both "approve" and "deposit" requests.
+func HandleRequest(c *fiber.Ctx, rabbitMQ *RabbitMQHandler, routingKey string, request codec.Message) error {
+	// The span covers the round trip to the worker; the worker continues the
+	// trace from the message headers
+	ctx, span := tracing.StartPublish(c.UserContext(), routingKey)
+	defer span.End()
 
 	correlationID := uuid.New().String()
-	bodyBytes, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", nil, err
-	}
+	span.SetAttributes(attribute.String("messaging.message.conversation_id", correlationID))
+	ctx = logging.WithCorrelationID(ctx, correlationID)
 
-	err = r.Channel.Publish(
-		"",
-		routingKey,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType:   "application/json",
-			Body:          bodyBytes,
-			CorrelationId: correlationID,
-			ReplyTo:       callbackQueue.Name,
-		},
-	)
-	if err != nil {
-		return "", nil, err
+	msg, err := rabbitMQ.SendRequest(ctx, correlationID, request, routingKey)
+	if errors.Is(err, broker.ErrNoReply) {
+		return c.JSON(fiber.Map{"message": "No response received"})
 	}
-
-	return correlationID, msgs, nil
-}
-
-// HandleRequest is a generic function to handle both "approve" and "deposit" requests.
-func HandleRequest(c *fiber.Ctx, rabbitMQ *RabbitMQHandler, routingKey string, requestBody map[string]interface{}) error {
-	correlationID, msgs, err := rabbitMQ.SendRequest(requestBody, routingKey)
 	if err != nil {
-		log.Printf("Error sending request: %v", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		logger.ErrorContext(ctx, "Failed to send request", "queue", routingKey, "err", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	for msg := range msgs {
-		if msg.CorrelationId == correlationID {
-			log.Printf("Received response: %s", msg.Body)
-			var response map[string]string
-			err = json.Unmarshal(msg.Body, &response)
-			if err != nil {
-				log.Printf("Failed to unmarshal response: %v", err)
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error":   "Failed to parse response",
-					"details": string(msg.Body),
-				})
-			}
-			return c.JSON(fiber.Map{
-				"response": response,
-			})
-		}
-	}
-
-	return c.JSON(fiber.Map{"message": "No response received"})
-}
-
-func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Error loading .env file")
-	}
-
-	rabbitMQ, err := NewRabbitMQHandler()
+	var response messages.Response
+	err = codec.Unmarshal(msg.ContentType, msg.Body, &response)
 	if err != nil {
-		log.Fatalf("RabbitMQ initialization error: %v", err)
+		logger.ErrorContext(ctx, "Failed to unmarshal response", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to parse response",
+			"details": string(msg.Body),
+		})
 	}
-	defer rabbitMQ.Close()
-
-	app := fiber.New()
+	logger.DebugContext(ctx, "Received response", "content_type", msg.ContentType, "response", response)
+	return c.JSON(fiber.Map{
+		"response": response,
+	})
+}
 
+// registerRoutes adds the routes that forward requests, signed with
+// approverKey, to the worker.
+func registerRoutes(app *fiber.App, rabbitMQ *RabbitMQHandler, approverKey string) {
 	// Approve route
 	app.Post("/approve", func(c *fiber.Ctx) error {
-		privateKey := os.Getenv("APPROVER_PRIVATE_KEY")
-		proposalID := int64(1)
-		requestBody := map[string]interface{}{
-			"proposalId": proposalID,
-			"privateKey": privateKey,
-		}
-		return HandleRequest(c, rabbitMQ, "approval_queue", requestBody)
+		request := &messages.ApprovalRequest{ProposalID: 1, PrivateKey: approverKey}
+		return HandleRequest(c, rabbitMQ, broker.ApprovalQueue.Name, request)
 	})
 
 	// Deposit route
@@ -158,17 +134,68 @@ func main() {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 		}
 
-		privateKey := os.Getenv("APPROVER_PRIVATE_KEY")
-		if privateKey == "" {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Private key not set in environment variables"})
-		}
+		request := &messages.DepositRequest{PrivateKey: approverKey, Amount: req.Amount}
+		return HandleRequest(c, rabbitMQ, broker.DepositQueue.Name, request)
+	})
+}
 
-		requestBody := map[string]interface{}{
-			"privateKey": privateKey,
-			"amount":     req.Amount,
-		}
-		return HandleRequest(c, rabbitMQ, "deposit_queue", requestBody)
+func main() {
+	var cfg Config
+	effective := config.MustLoad("approval-node", &cfg)
+	if err := logging.Init("approval-node", cfg.Log.Level, cfg.Log.Levels); err != nil {
+		logging.Fatal("Invalid logging configuration", "err", err)
+	}
+	slog.Info("Configuration loaded", "config", effective.Map())
+
+	ctx, stop := lifecycle.SignalContext()
+	defer stop()
+
+	rabbitMQ, err := NewRabbitMQHandler(cfg.RabbitMQ.URL)
+	if err != nil {
+		logging.Fatal("RabbitMQ initialization error", "err", err)
+	}
+	rabbitMQ.ContentType, _ = codec.ContentType(cfg.Encoding)
+
+	shutdownTracing, err := tracing.Init(context.Background(), "approval-node")
+	if err != nil {
+		logging.Fatal("Tracing initialization error", "err", err)
+	}
+
+	app := fiber.New()
+	app.Use(tracing.Middleware())
+	app.Use(logging.Middleware())
+	app.Use(metrics.Middleware())
+	metrics.Routes(app)
+
+	registerRoutes(app, rabbitMQ, cfg.ApproverPrivateKey)
+
+	// Health, readiness and status. The handler does not reconnect, so a
+	// closed channel fails liveness and gets the process restarted.
+	channel := health.WatchChannel(rabbitMQ.Connection, rabbitMQ.Channel)
+	status := health.New("approval-node")
+	status.Config("port", cfg.Port)
+	status.Config("rabbitmq", health.MaskURL(cfg.RabbitMQ.URL))
+	status.Config("encoding", cfg.Encoding)
+	status.Live("rabbitmq", channel.Check)
+	status.Ready("rabbitmq", channel.Check)
+	status.Status("queues", health.QueueDepths(func() *amqp.Connection { return rabbitMQ.Connection }, broker.ApprovalQueue.Name, broker.DepositQueue.Name))
+	status.Routes(app)
+
+	// Requests waiting for the worker's reply are drained first. Closing the
+	// connection ends any still waiting when the deadline passes.
+	var shutdown lifecycle.Shutdown
+	shutdown.Add("http", lifecycle.Drain(app))
+	shutdown.Add("rabbitmq", func(context.Context) error {
+		rabbitMQ.Close()
+		return nil
 	})
+	shutdown.Add("tracing", shutdownTracing)
 
-	log.Fatal(app.Listen(":4001"))
+	if err := lifecycle.Serve(ctx, app, fmt.Sprintf(":%d", cfg.Port)); err != nil {
+		logging.Fatal("Server stopped", "err", err)
+	}
+	stop()
+	if err := shutdown.Run(cfg.Shutdown.Timeout); err != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"shared/config"
+)
+
+// Config is the worker's configuration. See shared/config for the sources
+// each setting is read from.
+type Config struct {
+	Port           int             `config:"port" default:"4000" validate:"port" usage:"HTTP port of the health and metrics endpoints"`
+	DiamondAddress string          `config:"diamondAddress" validate:"required,address" usage:"address of the Diamond contract"`
+	RabbitMQ       config.RabbitMQ `config:"rabbitmq"`
+	RPC            config.RPC      `config:"rpc"`
+	Log            config.Log      `config:"log"`
+	Health         config.Health   `config:"health"`
+	Shutdown       config.Shutdown `config:"shutdown"`
+}
@@ -2,134 +2,235 @@ package main
 
 import (
 	blockchain "blockchain/services"
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"shared/broker"
+	"shared/codec"
+	"shared/config"
+	"shared/health"
+	"shared/lifecycle"
+	"shared/logging"
+	"shared/messages"
+	"shared/metrics"
+	"shared/tracing"
 
-	"github.com/joho/godotenv"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func handleRequest(ch *amqp.Channel, d amqp.Delivery, requestType string) error {
+var logger = logging.For("worker")
+
+var requests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "blockchain_requests_total",
+	Help: "Requests handled, by type and outcome (success, invalid or error).",
+}, []string{"type", "outcome"})
+
+func handleRequest(ctx context.Context, b broker.Broker, chain *blockchain.Chain, d amqp.Delivery, requestType string) error {
 	var err error
+	outcome := "success"
 	switch requestType {
 	case "approval":
 		var approvalReq blockchain.ApprovalRequest
-		if err = json.Unmarshal(d.Body, &approvalReq); err == nil && approvalReq.ProposalID != 0 {
-			log.Printf("Received approval request: %+v", approvalReq)
-			err = blockchain.ApproveProposal(approvalReq)
+		if err = codec.Unmarshal(d.ContentType, d.Body, &approvalReq); err == nil && approvalReq.ProposalID != 0 {
+			logger.InfoContext(ctx, "Received approval request", "request", approvalReq)
+			err = chain.ApproveProposal(ctx, approvalReq)
 		} else {
-			log.Printf("Invalid approval request format: %v", err)
+			if err == nil {
+				err = errors.New("invalid approval request: proposalId is required")
+			}
+			logger.WarnContext(ctx, "Invalid approval request format", "err", err)
+			outcome = "invalid"
 		}
 	case "deposit":
 		var depositReq blockchain.DepositRequest
-		if err = json.Unmarshal(d.Body, &depositReq); err == nil && depositReq.Amount != "" {
-			log.Printf("Received deposit request: %+v", depositReq)
-			err = blockchain.DepositEther(depositReq)
+		if err = codec.Unmarshal(d.ContentType, d.Body, &depositReq); err == nil && depositReq.Amount != "" {
+			logger.InfoContext(ctx, "Received deposit request", "request", depositReq)
+			err = chain.DepositEther(ctx, depositReq)
 		} else {
-			log.Printf("Invalid deposit request format: %v", err)
+			if err == nil {
+				err = errors.New("invalid deposit request: amount is required")
+			}
+			logger.WarnContext(ctx, "Invalid deposit request format", "err", err)
+			outcome = "invalid"
 		}
 	default:
-		log.Printf("Unknown request type: %s", requestType)
-		err = json.Unmarshal(d.Body, nil)
+		logger.WarnContext(ctx, "Unknown request type", "type", requestType)
+		err = fmt.Errorf("unknown request type: %s", requestType)
+		outcome = "invalid"
 	}
 
 	if err != nil {
-		log.Printf("Failed to process %s request: %v", requestType, err)
+		logger.ErrorContext(ctx, "Failed to process request", "type", requestType, "err", err)
+		trace.SpanFromContext(ctx).RecordError(err)
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+		if outcome == "success" {
+			outcome = "error"
+		}
 	}
-	return sendResponse(ch, d, err)
+	requests.WithLabelValues(requestType, outcome).Inc()
+	return sendResponse(ctx, b, d, err)
 }
 
-func sendResponse(ch *amqp.Channel, d amqp.Delivery, err error) error {
-	response := map[string]string{}
+// sendResponse replies to d in the content type it asks for, by default its
+// own.
+func sendResponse(ctx context.Context, b broker.Broker, d amqp.Delivery, err error) error {
+	response := messages.Response{Message: "Success"}
 	if err != nil {
-		response["error"] = err.Error()
-	} else {
-		response["message"] = "Success"
-	}
-	responseBody, _ := json.Marshal(response)
-	err = ch.Publish(
-		"",
-		d.ReplyTo,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType:   "application/json",
-			CorrelationId: d.CorrelationId,
-			Body:          responseBody,
-		},
-	)
+		response = messages.Response{Error: err.Error()}
+	}
+	reply, err := codec.Publishing(codec.ReplyContentType(d), &response)
 	if err != nil {
-		log.Printf("Failed to publish response: %v", err)
 		return err
 	}
-	log.Printf("Response sent for correlation ID: %s", d.CorrelationId)
-	return nil
-}
-
-func consumeMessages(ch *amqp.Channel, queueName string, requestType string) {
-	msgs, err := ch.Consume(
-		queueName,
-		"",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
+	reply.Headers = tracing.Inject(ctx, nil)
+	err = broker.Reply(b, d, reply)
 	if err != nil {
-		log.Fatalf("Failed to register a consumer for %s queue: %v", requestType, err)
+		logger.ErrorContext(ctx, "Failed to publish response", "err", err)
+		return err
 	}
+	logger.DebugContext(ctx, "Response sent", "reply_to", d.ReplyTo)
+	return nil
+}
 
-	go func() {
-		for d := range msgs {
-			err := handleRequest(ch, d, requestType)
-			if err != nil {
-				log.Printf("Failed to handle %s request: %v", requestType, err)
-			}
+// consumeMessages handles the requests on queueName one at a time. Each is
+// acknowledged once its response is sent, so a request interrupted by a
+// shutdown is redelivered rather than lost.
+func consumeMessages(b broker.Broker, chain *blockchain.Chain, queueName string, requestType string) (*lifecycle.Consumer, error) {
+	return lifecycle.Consume(b, queueName, func(d amqp.Delivery) {
+		ctx, span := tracing.StartConsume(d, queueName)
+		defer span.End()
+		ctx = logging.WithCorrelationID(ctx, d.CorrelationId)
+		if err := handleRequest(ctx, b, chain, d, requestType); err != nil {
+			logger.ErrorContext(ctx, "Failed to handle request", "type", requestType, "err", err)
 		}
-	}()
+		if err := d.Ack(false); err != nil {
+			logger.ErrorContext(ctx, "Failed to acknowledge request", "err", err)
+		}
+	})
 }
 
 func main() {
-	err := godotenv.Load()
+	var cfg Config
+	effective := config.MustLoad("blockchain", &cfg)
+	if err := logging.Init("blockchain", cfg.Log.Level, cfg.Log.Levels); err != nil {
+		logging.Fatal("Invalid logging configuration", "err", err)
+	}
+	slog.Info("Configuration loaded", "config", effective.Map())
+
+	ctx, stop := lifecycle.SignalContext()
+	defer stop()
+
+	shutdownTracing, err := tracing.Init(context.Background(), "blockchain")
 	if err != nil {
-		log.Fatalf("Error loading .env file")
+		logging.Fatal("Failed to initialize tracing", "err", err)
 	}
 
-	conn, err := amqp.Dial(os.Getenv("RABBITMQ_URL"))
+	// Connect once; the client and signers are reused for every message
+	chain, err := blockchain.Connect(cfg.RPC.URLs, common.HexToAddress(cfg.DiamondAddress))
 	if err != nil {
-		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
+		logging.Fatal("Failed to connect to Ethereum client", "err", err)
+	}
+
+	conn, err := amqp.Dial(cfg.RabbitMQ.URL)
+	if err != nil {
+		logging.Fatal("Failed to connect to RabbitMQ", "err", err)
 	}
-	defer conn.Close()
 
 	ch, err := conn.Channel()
 	if err != nil {
-		log.Fatalf("Failed to open RabbitMQ channel: %v", err)
+		logging.Fatal("Failed to open RabbitMQ channel", "err", err)
+	}
+	b := broker.AMQP(ch)
+
+	// Announce each transaction's trace before it is sent, so the publisher
+	// can link the events it emits back to the request
+	if err := tracing.DeclareTxQueue(b); err != nil {
+		logging.Fatal("Failed to declare queue", "queue", tracing.TxQueue, "err", err)
+	}
+	chain.OnSigned(func(ctx context.Context, tx *types.Transaction) {
+		if err := tracing.AnnounceTx(ctx, b, tx.Hash().Hex()); err != nil {
+			logger.WarnContext(logging.WithTxHash(ctx, tx.Hash().Hex()), "Failed to announce transaction trace", "err", err)
+		}
+	})
+
+	queues := map[broker.Queue]string{
+		broker.ApprovalQueue: "approval",
+		broker.DepositQueue:  "deposit",
 	}
-	defer ch.Close()
 
-	queues := map[string]string{
-		"approval_queue": "approval",
-		"deposit_queue":  "deposit",
+	// Take one request per queue at a time, so stopping leaves at most one
+	// buffered delivery to requeue
+	if err := b.Qos(1); err != nil {
+		logging.Fatal("Failed to set QoS", "err", err)
 	}
 
-	for queueName, requestType := range queues {
-		_, err := ch.QueueDeclare(
-			queueName,
-			false,
-			false,
-			false,
-			false,
-			nil,
-		)
+	var consumers []*lifecycle.Consumer
+	for queue, requestType := range queues {
+		if _, err := b.Declare(queue); err != nil {
+			logging.Fatal("Failed to declare queue", "queue", queue.Name, "err", err)
+		}
+		consumer, err := consumeMessages(b, chain, queue.Name, requestType)
 		if err != nil {
-			log.Fatalf("Failed to declare %s queue: %v", requestType, err)
+			logging.Fatal("Failed to register a consumer", "queue", queue.Name, "err", err)
 		}
-
-		consumeMessages(ch, queueName, requestType)
+		consumers = append(consumers, consumer)
 	}
 
-	log.Printf(" [*] Waiting for messages. To exit press CTRL+C")
-	select {}
+	// Health, readiness and status. The consumers do not reconnect, so a
+	// closed channel fails liveness and gets the process restarted.
+	consumer := health.WatchChannel(conn, ch)
+	status := health.New("blockchain")
+	status.Config("port", cfg.Port)
+	status.Config("rabbitmq", health.MaskURL(cfg.RabbitMQ.URL))
+	status.Config("rpcEndpoints", len(chain.Client.Status()))
+	status.Config("diamondAddress", cfg.DiamondAddress)
+	status.Live("rabbitmq", consumer.Check)
+	status.Ready("rabbitmq", consumer.Check)
+	status.Ready("rpc", chain.Client.Ready(cfg.Health.MaxHeadAge))
+	status.Status("rpc", func(ctx context.Context) any { return chain.Client.Status() })
+	status.Status("signers", func(ctx context.Context) any { return chain.Signers() })
+	status.Status("queues", health.QueueDepths(func() *amqp.Connection { return conn }, broker.ApprovalQueue.Name, broker.DepositQueue.Name))
+
+	app := fiber.New()
+	app.Use(tracing.Middleware())
+	app.Use(logging.Middleware())
+	app.Use(metrics.Middleware())
+	metrics.Routes(app)
+	status.Routes(app)
+
+	// Stop taking requests and let those in progress submit their
+	// transactions and reply before the connections close
+	var shutdown lifecycle.Shutdown
+	shutdown.Add("consumers", func(ctx context.Context) error {
+		var errs []error
+		for _, consumer := range consumers {
+			errs = append(errs, consumer.Stop(ctx))
+		}
+		return errors.Join(errs...)
+	})
+	shutdown.Add("http", lifecycle.Drain(app))
+	shutdown.Add("rabbitmq", lifecycle.Closer(conn))
+	shutdown.Add("rpc", func(context.Context) error {
+		chain.Close()
+		return nil
+	})
+	shutdown.Add("tracing", shutdownTracing)
+
+	logger.Info("Waiting for messages")
+	if err := lifecycle.Serve(ctx, app, fmt.Sprintf(":%d", cfg.Port)); err != nil {
+		logging.Fatal("Server stopped", "err", err)
+	}
+	stop()
+	if err := shutdown.Run(cfg.Shutdown.Timeout); err != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,180 @@
+package main
+
+import (
+	blockchain "blockchain/services"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"shared/broker"
+	"shared/chaintest"
+	"shared/codec"
+	"shared/messages"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// worker runs the worker's consumers on an in-memory broker against a
+// simulated chain, and returns a channel for sending it requests.
+func worker(t *testing.T) (*chaintest.Chain, *broker.Memory, broker.Broker) {
+	t.Helper()
+	sim := chaintest.New(t)
+	chain, err := blockchain.Connect(sim.URLs(), sim.Diamond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(chain.Close)
+
+	m := broker.NewMemory()
+	b := m.Channel()
+	if err := b.Qos(1); err != nil {
+		t.Fatal(err)
+	}
+	for queue, requestType := range map[broker.Queue]string{
+		broker.ApprovalQueue: "approval",
+		broker.DepositQueue:  "deposit",
+	} {
+		if _, err := b.Declare(queue); err != nil {
+			t.Fatal(err)
+		}
+		consumer, err := consumeMessages(b, chain, queue.Name, requestType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { consumer.Stop(context.Background()) })
+	}
+	return sim, m, m.Channel()
+}
+
+// send sends a request as the gateways do and decodes the reply.
+func send(b broker.Broker, queue string, request map[string]interface{}) (map[string]string, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reply, err := broker.Call(ctx, b, queue, amqp.Publishing{ContentType: "application/json", Body: body})
+	if err != nil {
+		return nil, err
+	}
+	var response map[string]string
+	err = json.Unmarshal(reply.Body, &response)
+	return response, err
+}
+
+func call(t *testing.T, b broker.Broker, queue string, request map[string]interface{}) map[string]string {
+	t.Helper()
+	response, err := send(b, queue, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestApprovalRoundTrip(t *testing.T) {
+	sim, m, gateway := worker(t)
+
+	response := call(t, gateway, broker.ApprovalQueue.Name, map[string]interface{}{
+		"proposalId": 7,
+		"privateKey": chaintest.Key,
+	})
+	if response["message"] != "Success" {
+		t.Fatalf("response = %v", response)
+	}
+	if n := m.Len(broker.ApprovalQueue.Name); n != 0 {
+		t.Fatalf("%d requests left in the queue", n)
+	}
+
+	var calls []chaintest.Call
+	for deadline := time.Now().Add(5 * time.Second); len(calls) == 0; time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("approval was not mined")
+		}
+		calls = sim.Calls(t)
+	}
+	if len(calls[0].Input) < 36 || new(big.Int).SetBytes(calls[0].Input[4:36]).Int64() != 7 {
+		t.Fatalf("approval called with %x", calls[0].Input)
+	}
+}
+
+func TestRoundTripReportsErrors(t *testing.T) {
+	_, _, gateway := worker(t)
+
+	tests := []struct {
+		queue   string
+		request map[string]interface{}
+	}{
+		{broker.ApprovalQueue.Name, map[string]interface{}{"privateKey": chaintest.Key}},
+		{broker.ApprovalQueue.Name, map[string]interface{}{"proposalId": 1, "privateKey": "not a key"}},
+		{broker.DepositQueue.Name, map[string]interface{}{"privateKey": chaintest.Key}},
+		{broker.DepositQueue.Name, map[string]interface{}{"privateKey": chaintest.Key, "amount": "lots"}},
+	}
+	for _, test := range tests {
+		response := call(t, gateway, test.queue, test.request)
+		if response["error"] == "" || response["message"] != "" {
+			t.Errorf("%s %v: response = %v, want an error", test.queue, test.request, response)
+		}
+	}
+}
+
+func TestDepositRoundTrip(t *testing.T) {
+	_, _, gateway := worker(t)
+
+	// Concurrent callers each get their own reply
+	errs := make(chan error, 3)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			response, err := send(gateway, broker.DepositQueue.Name, map[string]interface{}{
+				"privateKey": chaintest.Key,
+				"amount":     "0.5",
+			})
+			if err == nil && response["message"] != "Success" {
+				err = fmt.Errorf("response = %v", response)
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProtobufRoundTrip(t *testing.T) {
+	_, _, gateway := worker(t)
+
+	request, err := codec.Publishing(codec.ContentTypeProtobuf, &messages.DepositRequest{PrivateKey: chaintest.Key, Amount: "0.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reply, err := broker.Call(ctx, gateway, broker.DepositQueue.Name, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response messages.Response
+	if err := codec.Unmarshal(reply.ContentType, reply.Body, &response); err != nil || response.Message != "Success" {
+		t.Fatalf("reply %s %x: %+v, %v", reply.ContentType, reply.Body, response, err)
+	}
+	if !codec.IsProtobuf(reply.ContentType) {
+		t.Fatalf("replied in %s", reply.ContentType)
+	}
+
+	// A JSON request can ask for a Protobuf reply
+	request = amqp.Publishing{
+		ContentType: codec.ContentTypeJSON,
+		Headers:     amqp.Table{codec.AcceptHeader: codec.ContentTypeProtobuf},
+		Body:        []byte(`{"privateKey":"` + chaintest.Key + `"}`),
+	}
+	if reply, err = broker.Call(ctx, gateway, broker.DepositQueue.Name, request); err != nil {
+		t.Fatal(err)
+	}
+	if err := codec.Unmarshal(reply.ContentType, reply.Body, &response); err != nil || response.Error == "" {
+		t.Fatalf("reply %s: %+v, %v", reply.ContentType, response, err)
+	}
+}
@@ -1,21 +1,24 @@
 package blockchain
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"math/big"
-	"os"
-
+	"shared/failover"
+	"shared/logging"
+	"shared/messages"
+	"shared/signer"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 )
 
+var logger = logging.For("chain")
+
 const proposalABI = `[
     {
       "anonymous": false,
@@ -160,26 +163,56 @@ const proposalABI = `[
     }
   ]`
 
-type ApprovalRequest struct {
-	ProposalID int64  `json:"proposalId"`
-	PrivateKey string `json:"privateKey"`
-}
+// The requests the worker handles, shared with the gateways.
+type (
+	ApprovalRequest = messages.ApprovalRequest
+	DepositRequest  = messages.DepositRequest
+)
 
-type DepositRequest struct {
-	PrivateKey string `json:"privateKey"`
-	Amount     string `json:"amount"`
+// Chain holds the worker's long-lived RPC connection. Requests carry their
+// signing key, so a signer is kept per key and reused across messages.
+type Chain struct {
+	Client   *failover.Client
+	signers  *signer.Keyring
+	contract *bind.BoundContract
 }
 
-func DepositEther(req DepositRequest) error {
-	client, err := ethclient.Dial(os.Getenv("RPC_URL"))
+// Connect dials the RPC endpoints once at boot and binds the Diamond at
+// diamond.
+func Connect(urls []string, diamond common.Address) (*Chain, error) {
+	contractAbi, err := abi.JSON(strings.NewReader(proposalABI))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(req.PrivateKey, "0x"))
+	client, err := failover.Dial(failover.Config{URLs: urls})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, big.NewInt(1337)) // Adjust ChainID if needed
+	return &Chain{
+		Client:   client,
+		signers:  signer.NewKeyring(client),
+		contract: bind.NewBoundContract(diamond, contractAbi, client, client, client),
+	}, nil
+}
+
+// Signers lists the accounts that have signed requests so far.
+func (c *Chain) Signers() []string {
+	return c.signers.Addresses()
+}
+
+// OnSigned registers fn to see every transaction the worker signs, before
+// it is sent.
+func (c *Chain) OnSigned(fn signer.SignedFunc) {
+	c.signers.OnSigned(fn)
+}
+
+// Close closes the RPC connections.
+func (c *Chain) Close() {
+	c.Client.Close()
+}
+
+func (c *Chain) DepositEther(ctx context.Context, req DepositRequest) error {
+	s, err := c.signers.Signer(ctx, req.PrivateKey)
 	if err != nil {
 		return err
 	}
@@ -190,53 +223,36 @@ func DepositEther(req DepositRequest) error {
 	weiAmount := new(big.Float).Mul(etherAmount, big.NewFloat(1e18))
 	wei := new(big.Int)
 	weiAmount.Int(wei)
-	auth.Value = wei
-	contractAddress := common.HexToAddress(os.Getenv("DIAMOND_ADDRESS"))
-	contractAbi, err := abi.JSON(strings.NewReader(proposalABI))
+	submitted := time.Now()
+	tx, err := s.Transact(ctx, wei, func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return c.contract.Transact(auth, "depositEther")
+	})
 	if err != nil {
 		return err
 	}
-	contract := bind.NewBoundContract(contractAddress, contractAbi, client, client, client)
-	tx, err := contract.Transact(auth, "depositEther")
-	if err != nil {
-		return err
-	}
-	log.Printf("Ether deposited with tx: %s", tx.Hash().Hex())
+	logger.InfoContext(logging.WithTxHash(ctx, tx.Hash().Hex()), "Ether deposited", "amount", req.Amount, "from", s.Address().Hex())
+	go c.trackMined("deposit", tx, submitted)
 	return nil
 }
 
-func ApproveOnChain(client *ethclient.Client, auth *bind.TransactOpts, contractAddress common.Address, proposalID *big.Int) (*types.Transaction, error) {
-	contractAbi, err := abi.JSON(strings.NewReader(proposalABI))
-	if err != nil {
-		return nil, err
-	}
-	contract := bind.NewBoundContract(contractAddress, contractAbi, client, client, client)
-	tx, err := contract.Transact(auth, "approveProposal", proposalID)
-	if err != nil {
-		return nil, err
-	}
-	return tx, nil
+func (c *Chain) ApproveOnChain(ctx context.Context, s *signer.Signer, proposalID *big.Int) (*types.Transaction, error) {
+	return s.Transact(ctx, nil, func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return c.contract.Transact(auth, "approveProposal", proposalID)
+	})
 }
 
-func ApproveProposal(req ApprovalRequest) error {
-	client, err := ethclient.Dial(os.Getenv("RPC_URL"))
-	if err != nil {
-		return err
-	}
-	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(req.PrivateKey, "0x"))
-	if err != nil {
-		return err
-	}
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, big.NewInt(1337)) // Adjust ChainID
+func (c *Chain) ApproveProposal(ctx context.Context, req ApprovalRequest) error {
+	s, err := c.signers.Signer(ctx, req.PrivateKey)
 	if err != nil {
 		return err
 	}
 	proposalID := big.NewInt(req.ProposalID)
-	contractAddress := common.HexToAddress(os.Getenv("DIAMOND_ADDRESS"))
-	tx, err := ApproveOnChain(client, auth, contractAddress, proposalID)
+	submitted := time.Now()
+	tx, err := c.ApproveOnChain(ctx, s, proposalID)
 	if err != nil {
 		return err
 	}
-	log.Printf("Proposal approved with tx: %s", tx.Hash().Hex())
+	logger.InfoContext(logging.WithTxHash(ctx, tx.Hash().Hex()), "Proposal approved", "proposal_id", req.ProposalID, "from", s.Address().Hex())
+	go c.trackMined("approval", tx, submitted)
 	return nil
 }
@@ -0,0 +1,102 @@
+package blockchain
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"shared/chaintest"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// connect binds a worker chain to the mock Diamond and returns the hashes of
+// the transactions it signs.
+func connect(t *testing.T) (*chaintest.Chain, *Chain, <-chan common.Hash) {
+	t.Helper()
+	sim := chaintest.New(t)
+	c, err := Connect(sim.URLs(), sim.Diamond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	signed := make(chan common.Hash, 10)
+	c.OnSigned(func(_ context.Context, tx *types.Transaction) { signed <- tx.Hash() })
+	return sim, c, signed
+}
+
+// onlyCall waits for the signed transaction and returns the call it made.
+func onlyCall(t *testing.T, sim *chaintest.Chain, signed <-chan common.Hash) chaintest.Call {
+	t.Helper()
+	hash := <-signed
+	sim.WaitMined(t, hash)
+	calls := sim.Calls(t)
+	if len(calls) != 1 || calls[0].TxHash != hash {
+		t.Fatalf("got calls %+v, want one from %s", calls, hash.Hex())
+	}
+	return calls[0]
+}
+
+func proposalContract(t *testing.T) abi.ABI {
+	t.Helper()
+	parsed, err := abi.JSON(strings.NewReader(proposalABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestApproveProposal(t *testing.T) {
+	sim, c, signed := connect(t)
+
+	err := c.ApproveProposal(context.Background(), ApprovalRequest{ProposalID: 42, PrivateKey: "0x" + chaintest.Key})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call := onlyCall(t, sim, signed)
+	method, args := call.Method(t, proposalContract(t))
+	if method != "approveProposal" || args[0].(*big.Int).Int64() != 42 {
+		t.Fatalf("got %s%v, want approveProposal(42)", method, args)
+	}
+	if call.Value.Sign() != 0 {
+		t.Fatalf("approval sent %s wei", call.Value)
+	}
+	if signers := c.Signers(); len(signers) != 1 || signers[0] != call.From.Hex() {
+		t.Fatalf("signers = %v, want %s", signers, call.From.Hex())
+	}
+}
+
+func TestDepositEther(t *testing.T) {
+	sim, c, signed := connect(t)
+
+	err := c.DepositEther(context.Background(), DepositRequest{PrivateKey: chaintest.Key, Amount: "1.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call := onlyCall(t, sim, signed)
+	if method, _ := call.Method(t, proposalContract(t)); method != "depositEther" {
+		t.Fatalf("called %s, want depositEther", method)
+	}
+	want := new(big.Int).Mul(big.NewInt(15), big.NewInt(params.Ether/10))
+	if call.Value.Cmp(want) != 0 {
+		t.Fatalf("deposited %s wei, want %s", call.Value, want)
+	}
+}
+
+func TestDepositEtherRejectsInvalidAmount(t *testing.T) {
+	sim, c, _ := connect(t)
+
+	err := c.DepositEther(context.Background(), DepositRequest{PrivateKey: chaintest.Key, Amount: "lots"})
+	if err == nil || !strings.Contains(err.Error(), "invalid amount") {
+		t.Fatalf("err = %v, want an invalid amount error", err)
+	}
+	if calls := sim.Calls(t); len(calls) != 0 {
+		t.Fatalf("sent %d transactions for an invalid amount", len(calls))
+	}
+}
@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// minedTimeout bounds how long a submitted transaction is watched.
+const minedTimeout = 10 * time.Minute
+
+var (
+	txMinedSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "blockchain_tx_mined_seconds",
+		Help:    "Time from submission until the transaction was mined, by request type.",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 10),
+	}, []string{"type"})
+
+	txOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "blockchain_tx_total",
+		Help: "Mined transactions by request type and receipt status (success, reverted or timeout).",
+	}, []string{"type", "status"})
+
+	gasUsed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "blockchain_gas_used_total",
+		Help: "Gas used by mined transactions, by request type.",
+	}, []string{"type"})
+
+	gasSpent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "blockchain_gas_spent_wei_total",
+		Help: "Wei paid for gas by mined transactions, by request type.",
+	}, []string{"type"})
+)
+
+// trackMined waits for tx to be mined and records its latency and cost.
+func (c *Chain) trackMined(requestType string, tx *types.Transaction, submitted time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), minedTimeout)
+	defer cancel()
+
+	receipt, err := bind.WaitMined(ctx, c.Client, tx)
+	if err != nil {
+		logger.Warn("Stopped waiting for transaction to be mined", "tx_hash", tx.Hash().Hex(), "err", err)
+		txOutcomes.WithLabelValues(requestType, "timeout").Inc()
+		return
+	}
+
+	txMinedSeconds.WithLabelValues(requestType).Observe(time.Since(submitted).Seconds())
+	status := "success"
+	if receipt.Status == types.ReceiptStatusFailed {
+		status = "reverted"
+	}
+	txOutcomes.WithLabelValues(requestType, status).Inc()
+	gasUsed.WithLabelValues(requestType).Add(float64(receipt.GasUsed))
+	if receipt.EffectiveGasPrice != nil {
+		spent := new(big.Int).Mul(receipt.EffectiveGasPrice, new(big.Int).SetUint64(receipt.GasUsed))
+		wei, _ := new(big.Float).SetInt(spent).Float64()
+		gasSpent.WithLabelValues(requestType).Add(wei)
+	}
+}
@@ -1,20 +1,55 @@
 package blockchain
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"node1/config"
+	"shared/failover"
+	"shared/signer"
 
-	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
 )
 
-// ConnectToBlockchain connects to the Ethereum blockchain using RPC
-func ConnectToBlockchain() (*ethclient.Client, *rpc.Client, error) {
-	rpcURL := os.Getenv("RPC_URL")
-	rpcClient, err := rpc.Dial(rpcURL)
+// Chain is the gateway's connection to the blockchain. It is set up once at
+// boot and shared by all requests.
+type Chain struct {
+	Client   *failover.Client
+	Signer   *signer.Signer
+	Diamond  common.Address
+	contract *bind.BoundContract
+}
+
+// ConnectToBlockchain connects to the configured RPC endpoints and prepares
+// the approver's signer.
+func ConnectToBlockchain(ctx context.Context, cfg *config.Config) (*Chain, error) {
+	client, err := failover.Dial(failover.Config{URLs: cfg.RPC.URLs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Ethereum node: %v", err)
+	}
+
+	approver, err := signer.New(ctx, client, cfg.ApproverPrivateKey)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to connect to Ethereum node: %v", err)
+		client.Close()
+		return nil, err
 	}
-	client := ethclient.NewClient(rpcClient)
-	return client, rpcClient, nil
+
+	contractABI, err := LoadABI()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	diamond := common.HexToAddress(cfg.DiamondAddress)
+	return &Chain{
+		Client:   client,
+		Signer:   approver,
+		Diamond:  diamond,
+		contract: bind.NewBoundContract(diamond, contractABI, client, client, client),
+	}, nil
+}
+
+// Close closes the RPC connections.
+func (c *Chain) Close() {
+	c.Client.Close()
 }
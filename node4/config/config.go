@@ -0,0 +1,24 @@
+package config
+
+import (
+	sharedconfig "shared/config"
+)
+
+// Config is the gateway's configuration. See shared/config for the sources
+// each setting is read from.
+type Config struct {
+	Port               int                   `config:"port" default:"3005" validate:"port" usage:"HTTP port"`
+	DiamondAddress     string                `config:"diamondAddress" validate:"required,address" usage:"address of the Diamond contract"`
+	ApproverPrivateKey string                `config:"approverPrivateKey" validate:"required,hexkey" secret:"true" usage:"private key the gateway signs with"`
+	RPC                sharedconfig.RPC      `config:"rpc"`
+	Log                sharedconfig.Log      `config:"log"`
+	Health             sharedconfig.Health   `config:"health"`
+	Shutdown           sharedconfig.Shutdown `config:"shutdown"`
+}
+
+// Load reads the configuration, exiting with a message when it is invalid.
+func Load(service string) (*Config, sharedconfig.Effective) {
+	var cfg Config
+	effective := sharedconfig.MustLoad(service, &cfg)
+	return &cfg, effective
+}
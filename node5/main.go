@@ -1,30 +1,87 @@
 package main
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"node1/blockchain"
 	"node1/config"
 	"node1/handlers"
+	"os"
+	"shared/health"
+	"shared/lifecycle"
+	"shared/logging"
+	"shared/metrics"
+	"shared/tracing"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
-	// Load environment variables
-	if err := config.LoadEnv(); err != nil {
-		log.Fatalf("Error loading environment variables: %v", err)
+	cfg, effective := config.Load("node5")
+	if err := logging.Init("node5", cfg.Log.Level, cfg.Log.Levels); err != nil {
+		logging.Fatal("Invalid logging configuration", "err", err)
+	}
+	slog.Info("Configuration loaded", "config", effective.Map())
+
+	ctx, stop := lifecycle.SignalContext()
+	defer stop()
+
+	shutdownTracing, err := tracing.Init(context.Background(), "node5")
+	if err != nil {
+		logging.Fatal("Tracing initialization error", "err", err)
+	}
+
+	// Connect once; the client and signer are shared by every request
+	chain, err := blockchain.ConnectToBlockchain(ctx, cfg)
+	if err != nil {
+		logging.Fatal("Blockchain connection error", "err", err)
 	}
 
 	// Create a Fiber app
 	app := fiber.New()
+	app.Use(tracing.Middleware())
+	app.Use(logging.Middleware())
+	app.Use(metrics.Middleware())
+	metrics.Routes(app)
 
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.SendString("Node-5 is working!")
 	})
 
 	// Define API endpoints
-	app.Post("/approve-proposal", handlers.ApproveProposalHandler)
-	app.Post("/deposit-ether", handlers.DepositEtherHandler)
+	app.Post("/approve-proposal", handlers.ApproveProposalHandler(chain))
+	app.Post("/deposit-ether", handlers.DepositEtherHandler(chain))
+	chain.Client.Routes(app)
 
-	// Start the Fiber app on port 3006
-	log.Fatal(app.Listen(":3006"))
+	// Health, readiness and status
+	status := health.New("node5")
+	status.Config("port", cfg.Port)
+	status.Config("rpcEndpoints", len(chain.Client.Status()))
+	status.Config("diamondAddress", chain.Diamond.Hex())
+	status.Config("signer", chain.Signer.Address().Hex())
+	status.Config("chainId", chain.Signer.ChainID().String())
+	status.Ready("rpc", chain.Client.Ready(cfg.Health.MaxHeadAge))
+	status.Ready("signer", chain.Signer.Funded)
+	status.Status("rpc", func(ctx context.Context) any { return chain.Client.Status() })
+	status.Routes(app)
+
+	// Requests in progress finish, so transactions being submitted are sent
+	// and answered before the RPC connections close
+	var shutdown lifecycle.Shutdown
+	shutdown.Add("http", lifecycle.Drain(app))
+	shutdown.Add("rpc", func(context.Context) error {
+		chain.Close()
+		return nil
+	})
+	shutdown.Add("tracing", shutdownTracing)
+
+	// Start the Fiber app on the configured port
+	if err := lifecycle.Serve(ctx, app, fmt.Sprintf(":%d", cfg.Port)); err != nil {
+		logging.Fatal("Server stopped", "err", err)
+	}
+	stop()
+	if err := shutdown.Run(cfg.Shutdown.Timeout); err != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"polling/store"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// reservedParams are the /events query parameters with a fixed meaning; any
+// other parameter filters on a decoded event argument, e.g. ?proposalId=3.
+var reservedParams = map[string]bool{
+	"event":      true,
+	"from_block": true,
+	"to_block":   true,
+	"tx_hash":    true,
+	"address":    true,
+	"since":      true,
+	"until":      true,
+	"cursor":     true,
+	"limit":      true,
+	"order":      true,
+	// Resume position for /events/stream and /events/ws
+	"last_event_id": true,
+}
+
+// registerEventRoutes exposes the event store over HTTP.
+func registerEventRoutes(app *fiber.App, eventStore *store.Store) {
+	// Route to query detected events
+	app.Get("/events", func(c *fiber.Ctx) error {
+		q, err := parseEventQuery(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		page, err := eventStore.Query(q)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(page)
+	})
+
+	// Route to count events matching the same filters
+	app.Get("/events/count", func(c *fiber.Ctx) error {
+		q, err := parseEventQuery(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		count, err := eventStore.Count(q)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"count": count})
+	})
+}
+
+// parseEventQuery builds a store query from the request's query string.
+func parseEventQuery(c *fiber.Ctx) (store.Query, error) {
+	q := store.Query{
+		EventName: c.Query("event"),
+		TxHash:    c.Query("tx_hash"),
+		Address:   c.Query("address"),
+		Cursor:    c.Query("cursor"),
+		Args:      map[string]string{},
+	}
+
+	var err error
+	if q.FromBlock, err = parseUintParam(c, "from_block"); err != nil {
+		return q, err
+	}
+	if q.ToBlock, err = parseUintParam(c, "to_block"); err != nil {
+		return q, err
+	}
+	if q.Since, err = parseTimeParam(c, "since"); err != nil {
+		return q, err
+	}
+	if q.Until, err = parseTimeParam(c, "until"); err != nil {
+		return q, err
+	}
+	limit, err := parseUintParam(c, "limit")
+	if err != nil {
+		return q, err
+	}
+	q.Limit = int(min(limit, store.MaxLimit))
+
+	switch c.Query("order", "asc") {
+	case "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		return q, fmt.Errorf("order must be asc or desc")
+	}
+
+	for name, value := range c.Queries() {
+		if !reservedParams[name] {
+			q.Args[name] = value
+		}
+	}
+	return q, nil
+}
+
+func parseUintParam(c *fiber.Ctx, name string) (uint64, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return v, nil
+}
+
+// parseTimeParam accepts unix seconds or an RFC 3339 timestamp.
+func parseTimeParam(c *fiber.Ctx, name string) (uint64, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, nil
+	}
+	if v, err := strconv.ParseUint(raw, 10, 64); err == nil {
+		return v, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be unix seconds or RFC 3339", name)
+	}
+	return uint64(t.Unix()), nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"shared/config"
+)
+
+// Config is the poller's configuration. See shared/config for the sources
+// each setting is read from.
+type Config struct {
+	Port            int    `config:"port" default:"4003" validate:"port" usage:"HTTP port"`
+	ContractAddress string `config:"contractAddress" validate:"required,address" usage:"address of the Diamond, watched unless watchConfig is set"`
+	StartBlock      uint64 `config:"startBlock" usage:"block the Diamond is polled from when watchConfig is not set"`
+	WatchConfig     string `config:"watchConfig" usage:"JSON file listing the contracts to watch"`
+	ABIRegistryDir  string `config:"abiRegistryDir" usage:"directory of extra facet ABIs"`
+	AdminToken      string `config:"adminToken" secret:"true" usage:"bearer token required by the admin routes, which are disabled without one"`
+	EventDB         string `config:"eventDB" default:"events.db" validate:"required" usage:"path of the event store"`
+	PollMaxRange    uint64 `config:"pollMaxRange" default:"5000" usage:"most blocks fetched by one eth_getLogs call"`
+	MaxPollerLag    uint64 `config:"maxPollerLag" default:"50" usage:"blocks a poller may trail the head and stay ready"`
+	Retention       struct {
+		Blocks    uint64 `config:"blocks" usage:"blocks of events kept behind the head, 0 keeps all"`
+		MaxEvents int    `config:"maxEvents" usage:"most events kept, 0 keeps all"`
+	} `config:"retention"`
+	RPC      config.RPC      `config:"rpc"`
+	Log      config.Log      `config:"log"`
+	Health   config.Health   `config:"health"`
+	Shutdown config.Shutdown `config:"shutdown"`
+}
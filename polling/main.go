@@ -2,30 +2,32 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/big"
 	"os"
+	"polling/store"
+	"reflect"
+	"shared/config"
+	"shared/diamond"
+	"shared/failover"
+	"shared/health"
+	"shared/lifecycle"
+	"shared/logging"
+	"shared/metrics"
+	"shared/tracing"
+	"shared/watch"
 	"strings"
 	"time"
 
-	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/gofiber/fiber/v2"
 )
 
-type EventResponse struct {
-	BlockNumber uint64 `json:"block_number"`
-	TxHash      string `json:"tx_hash"`
-	EventName   string `json:"event_name"`
-	Details     string `json:"details"`
-}
-
-var eventLog []EventResponse // Holds a log of detected events
-
 // ABI definitions
 const InitializerABI = `[
     {
@@ -297,119 +299,359 @@ const proposalABI = `[
     }
   ]`
 
-// Track multiple contracts with their ABIs and addresses
-var contracts = map[string]string{
+// facetABIs are the ABIs of the diamond's facets. The diamond emits the
+// events of all of them from a single address.
+var facetABIs = map[string]string{
 	"Initializer": InitializerABI,
 	"Approval":    approvalABI,
 	"Proposal":    proposalABI,
 }
 
-func pollEvents(client *ethclient.Client, contractAbi abi.ABI, contractAddress string) {
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+// parseFacetABIs parses the built-in facet ABIs by facet name.
+func parseFacetABIs() (map[string]abi.ABI, error) {
+	facets := make(map[string]abi.ABI, len(facetABIs))
+	for name, facetABI := range facetABIs {
+		parsed, err := abi.JSON(strings.NewReader(facetABI))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s ABI: %w", name, err)
+		}
+		facets[name] = parsed
+	}
+	return facets, nil
+}
 
-	var lastProcessedBlock uint64
+// mergedABI combines the facet ABIs into the diamond's ABI.
+func mergedABI(facets map[string]abi.ABI) abi.ABI {
+	merged := abi.ABI{
+		Methods: make(map[string]abi.Method),
+		Events:  make(map[string]abi.Event),
+		Errors:  make(map[string]abi.Error),
+	}
+	for _, parsed := range facets {
+		for k, v := range parsed.Methods {
+			merged.Methods[k] = v
+		}
+		for k, v := range parsed.Events {
+			merged.Events[k] = v
+		}
+		for k, v := range parsed.Errors {
+			merged.Errors[k] = v
+		}
+	}
+	return merged
+}
 
-	for range ticker.C {
-		blockNumber, err := client.BlockNumber(context.Background())
+// decodeLogs turns the logs that match the ABI into stored events. Logs for
+// events outside the ABI are skipped.
+func decodeLogs(client *failover.Client, contractAbi abi.ABI, logs []types.Log) ([]store.EventResponse, error) {
+	var events []store.EventResponse
+	blockTimes := map[uint64]uint64{}
+	for _, vLog := range logs {
+		if len(vLog.Topics) == 0 {
+			continue
+		}
+		event, err := contractAbi.EventByID(vLog.Topics[0])
 		if err != nil {
-			log.Printf("Failed to get latest block number: %v", err)
 			continue
 		}
 
-		if blockNumber == lastProcessedBlock {
+		timestamp, err := blockTime(client, blockTimes, vLog.BlockNumber)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get timestamp of block %d: %w", vLog.BlockNumber, err)
+		}
+		args, err := processEvent(contractAbi, *event, vLog)
+		if err != nil {
+			logger.Warn("Failed to decode event", "event", event.Name, "tx_hash", vLog.TxHash.Hex(), "err", err)
 			continue
 		}
 
-		query := ethereum.FilterQuery{
-			Addresses: []common.Address{common.HexToAddress(contractAddress)},
-			FromBlock: big.NewInt(int64(lastProcessedBlock + 1)),
-			ToBlock:   big.NewInt(int64(blockNumber)),
+		eventResponse := store.EventResponse{
+			BlockNumber: vLog.BlockNumber,
+			BlockHash:   vLog.BlockHash.Hex(),
+			Timestamp:   timestamp,
+			TxHash:      vLog.TxHash.Hex(),
+			LogIndex:    vLog.Index,
+			Address:     vLog.Address.Hex(),
+			EventName:   event.Name,
+			Args:        args,
 		}
+		logger.Info("Event detected", "event", eventResponse.EventName, "block", eventResponse.BlockNumber, "tx_hash", eventResponse.TxHash)
+		events = append(events, eventResponse)
+	}
+	return events, nil
+}
 
-		logs, err := client.FilterLogs(context.Background(), query)
+// blockTime returns the timestamp of a block, caching headers already fetched.
+func blockTime(client *failover.Client, cache map[uint64]uint64, number uint64) (uint64, error) {
+	if t, ok := cache[number]; ok {
+		return t, nil
+	}
+	header, err := client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(number))
+	if err != nil {
+		return 0, err
+	}
+	cache[number] = header.Time
+	return header.Time, nil
+}
+
+// pruneEvents periodically applies the store's retention settings until ctx
+// is cancelled.
+func pruneEvents(ctx context.Context, eventStore *store.Store, client *failover.Client) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		head, err := client.BlockNumber(ctx)
 		if err != nil {
-			log.Printf("Failed to filter logs: %v", err)
+			logger.Warn("Failed to get latest block number", "err", err)
 			continue
 		}
+		removed, err := eventStore.Prune(head)
+		if err != nil {
+			logger.Error("Failed to prune events", "err", err)
+			continue
+		}
+		if removed > 0 {
+			logger.Info("Pruned events", "removed", removed)
+		}
+	}
+}
 
-		for _, vLog := range logs {
-			eventResponse := EventResponse{
-				BlockNumber: vLog.BlockNumber,
-				TxHash:      vLog.TxHash.Hex(),
-			}
-
-			// Process each event for the ABI
-			for name, event := range contractAbi.Events {
-				if vLog.Topics[0].Hex() == event.ID.Hex() {
-					eventResponse.EventName = name
-					details, err := processEvent(contractAbi, event, vLog)
-					if err != nil {
-						log.Printf("Failed to process event %s: %v", name, err)
-						continue
-					}
-					eventResponse.Details = details
-					break
-				}
-			}
+// processEvent decodes both the indexed topics and the data fields of a log
+// into arguments in ABI order.
+func processEvent(contractAbi abi.ABI, event abi.Event, vLog types.Log) (store.Args, error) {
+	values := map[string]interface{}{}
+	if err := contractAbi.UnpackIntoMap(values, event.Name, vLog.Data); err != nil {
+		return nil, err
+	}
+	if err := abi.ParseTopicsIntoMap(values, indexedInputs(event), vLog.Topics[1:]); err != nil {
+		return nil, err
+	}
 
-			if eventResponse.EventName != "" {
-				// Log and store the event only if EventName is populated
-				log.Printf("Event detected: %s, Block: %d, Tx: %s\n", eventResponse.EventName, eventResponse.BlockNumber, eventResponse.TxHash)
-				eventLog = append(eventLog, eventResponse)
-			}
+	args := make(store.Args, 0, len(event.Inputs))
+	for _, input := range event.Inputs {
+		value := formatArg(input.Type, values[input.Name])
+		// Indexed dynamic values are only available as their keccak256 hash
+		if hash, ok := values[input.Name].(common.Hash); ok {
+			value = hash.Hex()
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", input.Name, err)
 		}
+		args = append(args, store.Arg{Name: input.Name, Value: raw})
+	}
+	return args, nil
+}
 
-		lastProcessedBlock = blockNumber
+func indexedInputs(event abi.Event) abi.Arguments {
+	var indexed abi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
 	}
+	return indexed
 }
 
-// processEvent dynamically processes the events based on ABI and log data
-func processEvent(contractAbi abi.ABI, event abi.Event, vLog types.Log) (string, error) {
-	// Create a map to unpack event data into
-	eventData := map[string]interface{}{}
-	err := contractAbi.UnpackIntoMap(eventData, event.Name, vLog.Data)
-	if err != nil {
-		return "", err
+// formatArg converts a decoded ABI value into its JSON representation:
+// integers wider than 32 bits as decimal strings, addresses checksummed and
+// bytes as 0x-prefixed hex.
+func formatArg(t abi.Type, value interface{}) interface{} {
+	if value == nil {
+		return nil
 	}
+	v := reflect.ValueOf(value)
 
-	// Generate a human-readable output for the event
-	var details []string
-	for name, value := range eventData {
-		details = append(details, fmt.Sprintf("%s: %v", name, value))
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		if t.Size <= 32 {
+			return json.Number(fmt.Sprint(value))
+		}
+		return fmt.Sprint(value)
+	case abi.AddressTy:
+		if addr, ok := value.(common.Address); ok {
+			return addr.Hex()
+		}
+	case abi.BytesTy, abi.FixedBytesTy, abi.HashTy:
+		b := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+		return hexutil.Encode(b)
+	case abi.SliceTy, abi.ArrayTy:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = formatArg(*t.Elem, v.Index(i).Interface())
+		}
+		return items
+	case abi.TupleTy:
+		fields := make(store.Args, len(t.TupleElems))
+		for i, elem := range t.TupleElems {
+			raw, _ := json.Marshal(formatArg(*elem, v.Field(i).Interface()))
+			fields[i] = store.Arg{Name: t.TupleRawNames[i], Value: raw}
+		}
+		return fields
 	}
-	return strings.Join(details, ", "), nil
+	return value
 }
 
 func main() {
-	rpcURL := os.Getenv("RPC_URL")
-	contractAddress := os.Getenv("CONTRACT_ADDRESS")
+	var cfg Config
+	effective := config.MustLoad("polling", &cfg)
+	if err := logging.Init("polling", cfg.Log.Level, cfg.Log.Levels); err != nil {
+		logging.Fatal("Invalid logging configuration", "err", err)
+	}
+	slog.Info("Configuration loaded", "config", effective.Map())
 
-	// Connect to Ethereum client
-	client, err := ethclient.Dial(rpcURL)
+	ctx, stop := lifecycle.SignalContext()
+	defer stop()
+
+	shutdownTracing, err := tracing.Init(context.Background(), "polling")
 	if err != nil {
-		log.Fatalf("Failed to connect to Ethereum client: %v", err)
+		logging.Fatal("Failed to initialize tracing", "err", err)
 	}
 
-	// Start polling for each contract ABI
-	for contractName, contractABI := range contracts {
-		contractAbi, err := abi.JSON(strings.NewReader(contractABI))
-		if err != nil {
-			log.Fatalf("Failed to parse %s contract ABI: %v", contractName, err)
+	// Connect to the configured RPC endpoints
+	client, err := failover.Dial(failover.Config{URLs: cfg.RPC.URLs})
+	if err != nil {
+		logging.Fatal("Failed to connect to Ethereum client", "err", err)
+	}
+
+	// Open the event store
+	eventStore, err := store.Open(cfg.EventDB, store.Retention{
+		Blocks:    cfg.Retention.Blocks,
+		MaxEvents: cfg.Retention.MaxEvents,
+	})
+	if err != nil {
+		logging.Fatal("Failed to open event store", "err", err)
+	}
+
+	pruned := make(chan struct{})
+	go func() {
+		defer close(pruned)
+		pruneEvents(ctx, eventStore, client)
+	}()
+
+	hub := newEventHub()
+
+	facets, err := parseFacetABIs()
+	if err != nil {
+		logging.Fatal("Failed to build diamond ABI", "err", err)
+	}
+	contractAbi := mergedABI(facets)
+
+	// Discover the diamond's facets and decode with the ABIs of those present,
+	// falling back to every built-in facet if the loupe is unavailable
+	registry := diamond.NewRegistry(facets)
+	if cfg.ABIRegistryDir != "" {
+		if err := registry.LoadDir(cfg.ABIRegistryDir); err != nil {
+			logging.Fatal("Failed to load ABI registry", "err", err)
 		}
+	}
+	tracker, err := diamond.NewTracker(context.Background(), client, common.HexToAddress(cfg.ContractAddress), registry)
+	if err != nil {
+		slog.Warn("Facet discovery failed, using built-in facets", "err", err)
+	} else {
+		contractAbi = tracker.Layout().ABI
+	}
 
-		// Start polling for events in a separate goroutine for each contract
-		go pollEvents(client, contractAbi, contractAddress)
+	// Load the watch list, falling back to the diamond at contractAddress
+	var watches *watch.List
+	if cfg.WatchConfig != "" {
+		watches, err = watch.Load(cfg.WatchConfig, contractAbi)
+	} else {
+		watches, err = watch.Single(watch.Contract{
+			Name:       "diamond",
+			Address:    cfg.ContractAddress,
+			StartBlock: cfg.StartBlock,
+		}, contractAbi)
+	}
+	if err != nil {
+		logging.Fatal("Failed to load watch list", "err", err)
+	}
+
+	// Start one poller per watched contract
+	pollers := newPollerSet(client, eventStore, hub, cfg.PollMaxRange)
+	if err := watches.Run(pollers); err != nil {
+		logging.Fatal("Failed to start pollers", "err", err)
+	}
+
+	// Reload decoders when facets are added, replaced or removed
+	if tracker != nil {
+		tracker.OnChange(func(diamondABI abi.ABI) {
+			if err := watches.SetDefaultABI(diamondABI); err != nil {
+				slog.Error("Failed to apply new facets", "err", err)
+			}
+		})
+		go tracker.Run(ctx, 15*time.Second)
 	}
 
 	// Start Fiber server
 	app := fiber.New()
+	app.Use(tracing.Middleware())
+	app.Use(logging.Middleware())
+	app.Use(metrics.Middleware())
+	metrics.Routes(app)
+
+	// Routes to query and stream detected events
+	registerEventRoutes(app, eventStore)
+	registerStreamRoutes(app, eventStore, hub)
+
+	// Admin routes to change the watch list at runtime
+	watch.Routes(app, watches, cfg.AdminToken)
+	if tracker != nil {
+		tracker.Routes(app)
+	}
+	client.Routes(app)
+
+	// Health, readiness and status
+	status := health.New("polling")
+	status.Config("port", cfg.Port)
+	status.Config("rpcEndpoints", len(client.Status()))
+	status.Config("contractAddress", cfg.ContractAddress)
+	status.Config("watchConfig", cfg.WatchConfig)
+	status.Config("eventDB", cfg.EventDB)
+	status.Config("pollMaxRange", cfg.PollMaxRange)
+	status.Ready("rpc", client.Ready(cfg.Health.MaxHeadAge))
+	status.Ready("pollerLag", pollers.caughtUp(cfg.MaxPollerLag))
+	status.Status("rpc", func(ctx context.Context) any { return client.Status() })
+	status.Status("polling", pollers.status)
+	status.Routes(app)
 
-	// Route to check detected events
-	app.Get("/events", func(c *fiber.Ctx) error {
-		return c.JSON(eventLog)
+	// End the live streams so the server can drain, then let each poller
+	// store its current range and checkpoint before the store closes
+	var shutdown lifecycle.Shutdown
+	shutdown.Add("streams", func(context.Context) error {
+		hub.close()
+		return nil
 	})
+	shutdown.Add("http", lifecycle.Drain(app))
+	shutdown.Add("pollers", pollers.stopAll)
+	shutdown.Add("pruning", func(ctx context.Context) error {
+		select {
+		case <-pruned:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	shutdown.Add("store", lifecycle.Closer(eventStore))
+	shutdown.Add("rpc", func(context.Context) error {
+		client.Close()
+		return nil
+	})
+	shutdown.Add("tracing", shutdownTracing)
 
-	// Start the Fiber server on port 4003
-	log.Fatal(app.Listen(":4003"))
+	// Start the Fiber server on the configured port
+	if err := lifecycle.Serve(ctx, app, fmt.Sprintf(":%d", cfg.Port)); err != nil {
+		logging.Fatal("Server stopped", "err", err)
+	}
+	stop()
+	if err := shutdown.Run(cfg.Shutdown.Timeout); err != nil {
+		os.Exit(1)
+	}
 }
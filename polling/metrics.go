@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	pollDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "polling_poll_duration_seconds",
+		Help:    "Time to fetch, decode and store one block range, by contract.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"contract"})
+
+	logsPerRange = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "polling_logs_per_range",
+		Help:    "Logs returned per eth_getLogs range, by contract.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"contract"})
+
+	checkpointHeight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "polling_checkpoint_block",
+		Help: "Last block processed, by contract.",
+	}, []string{"contract"})
+
+	windowSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "polling_window_blocks",
+		Help: "Current eth_getLogs range size, by contract.",
+	}, []string{"contract"})
+
+	pollErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "polling_errors_total",
+		Help: "Ranges that failed to poll, by contract.",
+	}, []string{"contract"})
+)
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"polling/store"
+	"shared/failover"
+	"shared/health"
+	"shared/logging"
+	"shared/watch"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gofiber/fiber/v2"
+)
+
+var logger = logging.For("poller")
+
+const (
+	pollInterval = 1 * time.Second
+
+	// sparseLogs is the number of logs per range below which the window grows
+	sparseLogs = 100
+)
+
+// rangeErrors are fragments of the errors RPC providers return when a
+// FilterLogs range holds too many logs or spans too many blocks.
+var rangeErrors = []string{
+	"more than",
+	"too many",
+	"response size",
+	"limit exceeded",
+	"block range",
+	"range too large",
+	"exceed",
+}
+
+// poller follows one watched contract. It walks the chain in block windows
+// that shrink when the node rejects a range and grow while ranges are sparse.
+type poller struct {
+	client     *failover.Client
+	eventStore *store.Store
+	hub        *eventHub
+	contract   watch.Contract
+	address    common.Address
+	maxWindow  uint64
+	window     uint64
+}
+
+func newPoller(client *failover.Client, eventStore *store.Store, hub *eventHub, contract watch.Contract, maxWindow uint64) *poller {
+	maxWindow = max(maxWindow, 1)
+	return &poller{
+		client:     client,
+		eventStore: eventStore,
+		hub:        hub,
+		contract:   contract,
+		address:    common.HexToAddress(contract.Address),
+		maxWindow:  maxWindow,
+		window:     maxWindow,
+	}
+}
+
+// checkpointName is the key the poller's progress is stored under.
+func (p *poller) checkpointName() string {
+	return strings.ToLower(p.address.Hex())
+}
+
+// run polls until ctx is cancelled. Progress is checkpointed per address, so
+// a restart resumes where it left off.
+func (p *poller) run(ctx context.Context) {
+	next := p.contract.StartBlock
+	lastProcessedBlock, ok, err := p.eventStore.Checkpoint(p.checkpointName())
+	if err != nil {
+		logger.Error("Failed to load checkpoint", "contract", p.contract.Name, "err", err)
+		return
+	}
+	if ok {
+		next = lastProcessedBlock + 1
+		checkpointHeight.WithLabelValues(p.contract.Name).Set(float64(lastProcessedBlock))
+	}
+	logger.Info("Polling contract", "contract", p.contract.Name, "address", p.address.Hex(), "from_block", next)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Stopped polling contract", "contract", p.contract.Name)
+			return
+		case <-ticker.C:
+		}
+
+		head, err := p.client.BlockNumber(ctx)
+		if err != nil {
+			logger.Warn("Failed to get latest block number", "err", err)
+			continue
+		}
+
+		// Catch up to the head without waiting for the next tick
+		for next <= head && ctx.Err() == nil {
+			to, err := p.pollRange(ctx, next, head)
+			if err != nil && ctx.Err() != nil {
+				break
+			}
+			if err != nil {
+				logger.Warn("Failed to poll contract", "contract", p.contract.Name, "err", err)
+				pollErrors.WithLabelValues(p.contract.Name).Inc()
+				break
+			}
+			next = to + 1
+		}
+	}
+}
+
+// pollRange fetches, stores and publishes the logs of one window starting at
+// from, and returns the last block it covered.
+func (p *poller) pollRange(ctx context.Context, from, head uint64) (uint64, error) {
+	start := time.Now()
+	for {
+		to := min(from+p.window-1, head)
+		query := ethereum.FilterQuery{
+			Addresses: []common.Address{p.address},
+			Topics:    p.contract.Topics(),
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(to),
+		}
+
+		logs, err := p.client.FilterLogs(ctx, query)
+		if err != nil {
+			if isRangeError(err) && p.window > 1 {
+				p.window = max(p.window/2, 1)
+				logger.Info("Range rejected, shrinking window", "contract", p.contract.Name, "from_block", from, "to_block", to, "window", p.window, "err", err)
+				windowSize.WithLabelValues(p.contract.Name).Set(float64(p.window))
+				continue
+			}
+			return 0, fmt.Errorf("failed to filter logs: %w", err)
+		}
+
+		events, err := decodeLogs(p.client, p.contract.ABI, logs)
+		if err != nil {
+			return 0, err
+		}
+
+		// Only advance once the events and checkpoint are persisted; otherwise the
+		// same range is retried on the next tick
+		if err := p.eventStore.Append(p.checkpointName(), to, events); err != nil {
+			return 0, fmt.Errorf("failed to store events: %w", err)
+		}
+		p.hub.publish(events)
+
+		if len(logs) < sparseLogs && p.window < p.maxWindow {
+			p.window = min(p.window*2, p.maxWindow)
+		}
+		pollDuration.WithLabelValues(p.contract.Name).Observe(time.Since(start).Seconds())
+		logsPerRange.WithLabelValues(p.contract.Name).Observe(float64(len(logs)))
+		checkpointHeight.WithLabelValues(p.contract.Name).Set(float64(to))
+		windowSize.WithLabelValues(p.contract.Name).Set(float64(p.window))
+		return to, nil
+	}
+}
+
+func isRangeError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, fragment := range rangeErrors {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// pollerSet runs one poller per watched contract. It implements watch.Runner
+// so the watch list can start and stop pollers at runtime.
+type pollerSet struct {
+	client     *failover.Client
+	eventStore *store.Store
+	hub        *eventHub
+	maxWindow  uint64
+
+	mu      sync.Mutex
+	running map[string]runningPoller
+}
+
+type runningPoller struct {
+	contract watch.Contract
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func newPollerSet(client *failover.Client, eventStore *store.Store, hub *eventHub, maxWindow uint64) *pollerSet {
+	return &pollerSet{
+		client:     client,
+		eventStore: eventStore,
+		hub:        hub,
+		maxWindow:  maxWindow,
+		running:    make(map[string]runningPoller),
+	}
+}
+
+// Start launches a poller for the contract, first stopping any poller
+// already running under its name so two never write the same checkpoint.
+func (s *pollerSet) Start(c watch.Contract) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	s.mu.Lock()
+	previous, ok := s.running[c.Name]
+	s.running[c.Name] = runningPoller{contract: c, cancel: cancel, done: done}
+	s.mu.Unlock()
+
+	if ok {
+		previous.cancel()
+		<-previous.done
+	}
+
+	go func() {
+		defer close(done)
+		newPoller(s.client, s.eventStore, s.hub, c, s.maxWindow).run(ctx)
+	}()
+	return nil
+}
+
+// Stop cancels the named poller and waits for it to finish its current range.
+func (s *pollerSet) Stop(name string) {
+	s.mu.Lock()
+	p, ok := s.running[name]
+	delete(s.running, name)
+	s.mu.Unlock()
+
+	if ok {
+		p.cancel()
+		<-p.done
+	}
+}
+
+// stopAll cancels every poller and waits until ctx is done for each to
+// finish its current range, whose events and checkpoint are stored together.
+func (s *pollerSet) stopAll(ctx context.Context) error {
+	s.mu.Lock()
+	running := s.running
+	s.running = make(map[string]runningPoller)
+	s.mu.Unlock()
+
+	for _, p := range running {
+		p.cancel()
+	}
+	for _, p := range running {
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// pollerProgress is how far one poller has got.
+type pollerProgress struct {
+	Contract   string `json:"contract"`
+	Address    string `json:"address"`
+	Checkpoint uint64 `json:"checkpoint"`
+	Lag        uint64 `json:"lag"`
+}
+
+// progress reports each poller's checkpoint and its distance from head.
+func (s *pollerSet) progress(head uint64) ([]pollerProgress, error) {
+	s.mu.Lock()
+	contracts := make([]watch.Contract, 0, len(s.running))
+	for _, p := range s.running {
+		contracts = append(contracts, p.contract)
+	}
+	s.mu.Unlock()
+	sort.Slice(contracts, func(i, j int) bool { return contracts[i].Name < contracts[j].Name })
+
+	progress := make([]pollerProgress, 0, len(contracts))
+	for _, c := range contracts {
+		checkpoint, ok, err := s.eventStore.Checkpoint(strings.ToLower(common.HexToAddress(c.Address).Hex()))
+		if err != nil {
+			return nil, err
+		}
+		if !ok && c.StartBlock > 0 {
+			checkpoint = c.StartBlock - 1
+		}
+		progress = append(progress, pollerProgress{
+			Contract:   c.Name,
+			Address:    c.Address,
+			Checkpoint: checkpoint,
+			Lag:        head - min(checkpoint, head),
+		})
+	}
+	return progress, nil
+}
+
+// caughtUp fails when a poller trails the chain head by more than maxLag blocks.
+func (s *pollerSet) caughtUp(maxLag uint64) health.Check {
+	return func(ctx context.Context) error {
+		head, err := s.client.BlockNumber(ctx)
+		if err != nil {
+			return err
+		}
+		progress, err := s.progress(head)
+		if err != nil {
+			return err
+		}
+		var behind []string
+		for _, p := range progress {
+			if p.Lag > maxLag {
+				behind = append(behind, fmt.Sprintf("%s is %d blocks behind", p.Contract, p.Lag))
+			}
+		}
+		if len(behind) > 0 {
+			return fmt.Errorf("%s", strings.Join(behind, ", "))
+		}
+		return nil
+	}
+}
+
+// status is the /status section for the pollers.
+func (s *pollerSet) status(ctx context.Context) any {
+	head, err := s.client.BlockNumber(ctx)
+	if err != nil {
+		return fiber.Map{"error": err.Error()}
+	}
+	progress, err := s.progress(head)
+	if err != nil {
+		return fiber.Map{"error": err.Error()}
+	}
+	return fiber.Map{"head": head, "pollers": progress}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"path/filepath"
+	"polling/store"
+	"testing"
+	"time"
+
+	"shared/chaintest"
+	"shared/watch"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func diamondABI(t *testing.T) abi.ABI {
+	t.Helper()
+	facets, err := parseFacetABIs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mergedABI(facets)
+}
+
+func TestProcessEvent(t *testing.T) {
+	sim := chaintest.New(t)
+	contractABI := diamondABI(t)
+	recipient := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	event := contractABI.Events["ProposalAdded"]
+
+	receipt := sim.Emit(t, event, recipient, new(big.Int).Lsh(big.NewInt(1), 70))
+	args, err := processEvent(contractABI, event, *receipt.Logs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"recipient":"` + recipient.Hex() + `","amount":"1180591620717411303424"}`
+	if string(raw) != want {
+		t.Fatalf("args = %s, want %s", raw, want)
+	}
+}
+
+func TestPollerStoresEvents(t *testing.T) {
+	sim := chaintest.New(t)
+	contractABI := diamondABI(t)
+	eventStore, err := store.Open(filepath.Join(t.TempDir(), "events.db"), store.Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { eventStore.Close() })
+
+	approved := sim.Emit(t, contractABI.Events["ProposalApproved"], big.NewInt(4))
+	executed := sim.Emit(t, contractABI.Events["ProposalExecuted"], big.NewInt(4))
+	deposited := sim.Emit(t, contractABI.Events["DepositedEther"], sim.Emitter(), big.NewInt(5e17))
+
+	c := watch.Contract{Name: "diamond", Address: sim.Diamond.Hex(), ABI: contractABI}
+	p := newPoller(sim.Dial(t), eventStore, newEventHub(), c, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	var page store.Page
+	deadline := time.Now().Add(5 * time.Second)
+	for len(page.Events) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stored %d events, want 3", len(page.Events))
+		}
+		time.Sleep(50 * time.Millisecond)
+		if page, err = eventStore.Query(store.Query{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, want := range []struct {
+		name  string
+		block uint64
+		tx    common.Hash
+	}{
+		{"ProposalApproved", approved.BlockNumber.Uint64(), approved.TxHash},
+		{"ProposalExecuted", executed.BlockNumber.Uint64(), executed.TxHash},
+		{"DepositedEther", deposited.BlockNumber.Uint64(), deposited.TxHash},
+	} {
+		event := page.Events[i]
+		if event.EventName != want.name || event.BlockNumber != want.block || event.TxHash != want.tx.Hex() || event.Timestamp == 0 {
+			t.Fatalf("event %d = %+v, want %s in block %d", i, event, want.name, want.block)
+		}
+	}
+	if checkpoint, ok, err := eventStore.Checkpoint(p.checkpointName()); err != nil || !ok || checkpoint < deposited.BlockNumber.Uint64() {
+		t.Fatalf("checkpoint = %d, %v, %v; want at least block %d", checkpoint, ok, err, deposited.BlockNumber)
+	}
+}
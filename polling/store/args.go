@@ -0,0 +1,86 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Arg is one decoded event argument. Value holds the argument's JSON encoding.
+type Arg struct {
+	Name  string
+	Value json.RawMessage
+}
+
+// Args are an event's decoded arguments in ABI order. They are encoded as a
+// JSON object whose keys keep that order.
+type Args []Arg
+
+// MarshalJSON encodes the arguments as an ordered JSON object.
+func (a Args) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, arg := range a {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(arg.Name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		if len(arg.Value) == 0 {
+			buf.WriteString("null")
+		} else {
+			buf.Write(arg.Value)
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a JSON object, keeping the order of its keys.
+func (a *Args) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return fmt.Errorf("args must be a JSON object")
+	}
+	args := Args{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		name, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("invalid args key %v", tok)
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		args = append(args, Arg{Name: name, Value: value})
+	}
+	*a = args
+	return nil
+}
+
+// indexValue returns the string an argument is indexed under. Only scalar
+// values (strings, numbers and booleans) are indexed.
+func (arg Arg) indexValue() (string, bool) {
+	raw := bytes.TrimSpace(arg.Value)
+	if len(raw) == 0 {
+		return "", false
+	}
+	switch raw[0] {
+	case '"':
+		s, err := strconv.Unquote(string(raw))
+		return s, err == nil
+	case '{', '[', 'n':
+		return "", false
+	default:
+		return string(raw), true
+	}
+}
@@ -0,0 +1,256 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Query selects stored events. Zero-valued fields do not filter.
+type Query struct {
+	EventName  string
+	FromBlock  uint64
+	ToBlock    uint64
+	TxHash     string
+	Address    string
+	Since      uint64 // unix seconds, inclusive
+	Until      uint64 // unix seconds, inclusive
+	Args       map[string]string
+	Cursor     string
+	Limit      int
+	Descending bool
+}
+
+// Page is one page of query results. NextCursor is empty on the last page.
+type Page struct {
+	Events     []EventResponse `json:"events"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// Query returns the events matching q, one page at a time.
+func (s *Store) Query(q Query) (Page, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	page := Page{Events: []EventResponse{}}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var last []byte
+		err := scan(tx, q, func(key []byte, event EventResponse) bool {
+			if len(page.Events) == limit {
+				page.NextCursor = hex.EncodeToString(last)
+				return false
+			}
+			page.Events = append(page.Events, event)
+			last = key
+			return true
+		})
+		return err
+	})
+	return page, err
+}
+
+// Count returns the number of events matching q, ignoring pagination.
+func (s *Store) Count(q Query) (int, error) {
+	q.Cursor = ""
+	count := 0
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return scan(tx, q, func([]byte, EventResponse) bool {
+			count++
+			return true
+		})
+	})
+	return count, err
+}
+
+// scan walks the most selective index for q and calls fn for every matching
+// event in the requested order until fn returns false.
+func scan(tx *bolt.Tx, q Query, fn func(key []byte, event EventResponse) bool) error {
+	var cursorKey []byte
+	if q.Cursor != "" {
+		var err error
+		cursorKey, err = hex.DecodeString(q.Cursor)
+		if err != nil || len(cursorKey) != 16 {
+			return fmt.Errorf("invalid cursor %q", q.Cursor)
+		}
+	}
+
+	// Pick the index with the narrowest term; the remaining filters are
+	// checked per event
+	bucket, prefix := eventsBucket, []byte{}
+	switch {
+	case q.TxHash != "":
+		bucket, prefix = byTxBucket, termPrefix(strings.ToLower(q.TxHash))
+	case len(q.Args) > 0:
+		for name, value := range q.Args {
+			bucket, prefix = byArgBucket, termPrefix(argTerm(name, value))
+			break
+		}
+	case q.EventName != "":
+		bucket, prefix = byNameBucket, termPrefix(q.EventName)
+	}
+
+	events := tx.Bucket(eventsBucket)
+	argIndex := tx.Bucket(byArgBucket)
+	c := tx.Bucket(bucket).Cursor()
+
+	var k []byte
+	if q.Descending {
+		k = seekLast(c, prefix, q, cursorKey)
+	} else {
+		k = seekFirst(c, prefix, q, cursorKey)
+	}
+
+	for ; k != nil && bytes.HasPrefix(k, prefix); k = step(c, q.Descending) {
+		key := k[len(prefix):]
+		block := binary.BigEndian.Uint64(key[:8])
+		if q.FromBlock > 0 && block < q.FromBlock {
+			if q.Descending {
+				break
+			}
+			continue
+		}
+		if q.ToBlock > 0 && block > q.ToBlock {
+			if !q.Descending {
+				break
+			}
+			continue
+		}
+		if !hasArgs(argIndex, key, q.Args) {
+			continue
+		}
+
+		var event EventResponse
+		if err := json.Unmarshal(events.Get(key), &event); err != nil {
+			return err
+		}
+		if !matches(event, q) {
+			continue
+		}
+		if !fn(bytes.Clone(key), event) {
+			break
+		}
+	}
+	return nil
+}
+
+// seekFirst positions c on the first candidate for an ascending scan.
+func seekFirst(c *bolt.Cursor, prefix []byte, q Query, cursorKey []byte) []byte {
+	if cursorKey != nil {
+		k, _ := c.Seek(append(bytes.Clone(prefix), cursorKey...))
+		if k != nil && bytes.Equal(k[len(prefix):], cursorKey) {
+			k, _ = c.Next()
+		}
+		return k
+	}
+	k, _ := c.Seek(append(bytes.Clone(prefix), eventKey(q.FromBlock, 0)...))
+	return k
+}
+
+// seekLast positions c on the first candidate for a descending scan.
+func seekLast(c *bolt.Cursor, prefix []byte, q Query, cursorKey []byte) []byte {
+	var start []byte
+	switch {
+	case cursorKey != nil:
+		start = append(bytes.Clone(prefix), cursorKey...)
+	case q.ToBlock > 0:
+		start = append(bytes.Clone(prefix), eventKey(q.ToBlock+1, 0)...)
+	default:
+		// Seek past every key sharing the prefix
+		start = append(bytes.Clone(prefix), bytes.Repeat([]byte{0xff}, 17)...)
+	}
+
+	// Everything before start is a candidate, so step back from the first key
+	// at or after it
+	k, _ := c.Seek(start)
+	if k == nil {
+		k, _ = c.Last()
+	} else {
+		k, _ = c.Prev()
+	}
+	return k
+}
+
+func step(c *bolt.Cursor, descending bool) []byte {
+	var k []byte
+	if descending {
+		k, _ = c.Prev()
+	} else {
+		k, _ = c.Next()
+	}
+	return k
+}
+
+// hasArgs checks the argument index for every requested argument value.
+func hasArgs(argIndex *bolt.Bucket, key []byte, args map[string]string) bool {
+	for name, value := range args {
+		if argIndex.Get(indexKey(argTerm(name, value), key)) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether event satisfies every filter in q. It is used for
+// events that have not been read back from the store, such as live streams.
+func (q Query) Matches(event EventResponse) bool {
+	switch {
+	case q.FromBlock > 0 && event.BlockNumber < q.FromBlock:
+		return false
+	case q.ToBlock > 0 && event.BlockNumber > q.ToBlock:
+		return false
+	}
+	for name, want := range q.Args {
+		found := false
+		for _, arg := range event.Args {
+			if value, ok := arg.indexValue(); ok && arg.Name == name && strings.EqualFold(value, want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return matches(event, q)
+}
+
+// Cursor returns the pagination cursor positioned at the given event, so a
+// query with it resumes right after that event.
+func Cursor(block uint64, logIndex uint) string {
+	return hex.EncodeToString(eventKey(block, logIndex))
+}
+
+func matches(event EventResponse, q Query) bool {
+	switch {
+	case q.EventName != "" && event.EventName != q.EventName:
+		return false
+	case q.TxHash != "" && !strings.EqualFold(event.TxHash, q.TxHash):
+		return false
+	case q.Address != "" && !strings.EqualFold(event.Address, q.Address):
+		return false
+	case q.Since > 0 && event.Timestamp < q.Since:
+		return false
+	case q.Until > 0 && event.Timestamp > q.Until:
+		return false
+	}
+	return true
+}
+
+func termPrefix(term string) []byte {
+	return append([]byte(term), 0)
+}
@@ -0,0 +1,234 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	eventsBucket = []byte("events")
+	refsBucket   = []byte("refs")
+	byTxBucket   = []byte("by_tx")
+	byNameBucket = []byte("by_name")
+	byArgBucket  = []byte("by_arg")
+	metaBucket   = []byte("meta")
+
+	allBuckets = [][]byte{eventsBucket, refsBucket, byTxBucket, byNameBucket, byArgBucket, metaBucket}
+)
+
+// EventResponse is a decoded contract event as served by the API.
+type EventResponse struct {
+	BlockNumber uint64 `json:"block_number"`
+	BlockHash   string `json:"block_hash"`
+	Timestamp   uint64 `json:"timestamp"`
+	TxHash      string `json:"tx_hash"`
+	LogIndex    uint   `json:"log_index"`
+	Address     string `json:"address"`
+	EventName   string `json:"event_name"`
+	Args        Args   `json:"args"`
+}
+
+// Retention bounds how much history the store keeps. Zero values disable the
+// corresponding limit.
+type Retention struct {
+	Blocks    uint64 // keep events from the last N blocks
+	MaxEvents int    // keep at most N events
+}
+
+// Store persists polled events in a bbolt database. Events are keyed by block
+// number and log index, so the primary bucket doubles as the block index;
+// secondary buckets index transaction hash, event name and argument values.
+type Store struct {
+	db        *bolt.DB
+	retention Retention
+}
+
+// Open opens (or creates) the event database at path.
+func Open(path string, retention Retention) (*Store, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event store: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range allBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create event store buckets: %w", err)
+	}
+	return &Store{db: db, retention: retention}, nil
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Append stores a batch of events and advances the named checkpoint to block
+// in the same transaction, so a crash never records one without the other.
+// Events that are already stored are skipped.
+func (s *Store) Append(checkpoint string, block uint64, events []EventResponse) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, event := range events {
+			if err := putEvent(tx, event); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(metaBucket).Put(checkpointKey(checkpoint), uint64Bytes(block))
+	})
+}
+
+// Checkpoint returns the last block processed by the named poller.
+func (s *Store) Checkpoint(name string) (uint64, bool, error) {
+	var block uint64
+	var ok bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(metaBucket).Get(checkpointKey(name))
+		if raw != nil {
+			block, ok = binary.BigEndian.Uint64(raw), true
+		}
+		return nil
+	})
+	return block, ok, err
+}
+
+// Prune applies the retention settings relative to the given chain head and
+// returns the number of events removed.
+func (s *Store) Prune(head uint64) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var cutoff uint64
+		if s.retention.Blocks > 0 && head > s.retention.Blocks {
+			cutoff = head - s.retention.Blocks
+		}
+
+		// Both limits remove the oldest events first, so walk from the start
+		// until neither applies
+		events := tx.Bucket(eventsBucket)
+		total := events.Stats().KeyN
+		var stale [][]byte
+		c := events.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			tooOld := binary.BigEndian.Uint64(k[:8]) < cutoff
+			tooMany := s.retention.MaxEvents > 0 && total-len(stale) > s.retention.MaxEvents
+			if !tooOld && !tooMany {
+				break
+			}
+			stale = append(stale, bytes.Clone(k))
+		}
+
+		for _, key := range stale {
+			if err := deleteEvent(tx, key); err != nil {
+				return err
+			}
+		}
+		removed = len(stale)
+		return nil
+	})
+	return removed, err
+}
+
+func putEvent(tx *bolt.Tx, event EventResponse) error {
+	key := eventKey(event.BlockNumber, event.LogIndex)
+	events := tx.Bucket(eventsBucket)
+	if events.Get(key) != nil {
+		return nil
+	}
+
+	raw, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := events.Put(key, raw); err != nil {
+		return err
+	}
+
+	refs := []indexRef{
+		{Bucket: byTxBucket, Key: indexKey(strings.ToLower(event.TxHash), key)},
+		{Bucket: byNameBucket, Key: indexKey(event.EventName, key)},
+	}
+	for _, arg := range event.Args {
+		if value, ok := arg.indexValue(); ok {
+			refs = append(refs, indexRef{Bucket: byArgBucket, Key: indexKey(argTerm(arg.Name, value), key)})
+		}
+	}
+	for _, ref := range refs {
+		if err := tx.Bucket(ref.Bucket).Put(ref.Key, nil); err != nil {
+			return err
+		}
+	}
+
+	// Remember which index entries belong to the event so pruning can remove them
+	rawRefs, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(refsBucket).Put(key, rawRefs)
+}
+
+func deleteEvent(tx *bolt.Tx, key []byte) error {
+	var refs []indexRef
+	if raw := tx.Bucket(refsBucket).Get(key); raw != nil {
+		if err := json.Unmarshal(raw, &refs); err != nil {
+			return err
+		}
+	}
+	for _, ref := range refs {
+		if err := tx.Bucket(ref.Bucket).Delete(ref.Key); err != nil {
+			return err
+		}
+	}
+	if err := tx.Bucket(refsBucket).Delete(key); err != nil {
+		return err
+	}
+	return tx.Bucket(eventsBucket).Delete(key)
+}
+
+// indexRef names one secondary index entry.
+type indexRef struct {
+	Bucket []byte `json:"b"`
+	Key    []byte `json:"k"`
+}
+
+// eventKey orders events by block number, then log index within the block.
+func eventKey(block uint64, logIndex uint) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key[:8], block)
+	binary.BigEndian.PutUint64(key[8:], uint64(logIndex))
+	return key
+}
+
+// indexKey builds "<term>\x00<event key>" so all events for a term are
+// contiguous and in chain order.
+func indexKey(term string, key []byte) []byte {
+	out := make([]byte, 0, len(term)+1+len(key))
+	out = append(out, term...)
+	out = append(out, 0)
+	return append(out, key...)
+}
+
+// argTerm normalizes an argument for the index. Values are compared
+// case-insensitively so checksummed and lower-case addresses match.
+func argTerm(name, value string) string {
+	return name + "=" + strings.ToLower(value)
+}
+
+func checkpointKey(name string) []byte {
+	return []byte("checkpoint/" + name)
+}
+
+func uint64Bytes(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
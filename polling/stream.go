@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"polling/store"
+	"shared/logging"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+var streamLogger = logging.For("stream")
+
+const (
+	heartbeatInterval  = 15 * time.Second
+	subscriptionBuffer = 256
+)
+
+// errSubscriberTooSlow ends a stream whose client could not keep up. The
+// client is expected to reconnect with its last event ID and catch up from
+// the store.
+var errSubscriberTooSlow = errors.New("subscriber fell behind")
+
+// errShuttingDown ends every stream when the service stops, so the HTTP
+// server can drain. Clients resume from their last event ID elsewhere.
+var errShuttingDown = errors.New("service shutting down")
+
+// eventHub fans newly stored events out to live stream subscribers.
+type eventHub struct {
+	mu     sync.Mutex
+	subs   map[*subscription]struct{}
+	closed bool
+}
+
+type subscription struct {
+	query  store.Query
+	events chan store.EventResponse
+	err    error // why events was closed
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[*subscription]struct{})}
+}
+
+func (h *eventHub) subscribe(q store.Query) *subscription {
+	sub := &subscription{query: q, events: make(chan store.EventResponse, subscriptionBuffer)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		sub.err = errShuttingDown
+		close(sub.events)
+		return sub
+	}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+func (h *eventHub) unsubscribe(sub *subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+// publish delivers events to every matching subscriber without blocking the
+// poller. Subscribers whose buffer is full are disconnected.
+func (h *eventHub) publish(events []store.EventResponse) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		for _, event := range events {
+			if !sub.query.Matches(event) {
+				continue
+			}
+			select {
+			case sub.events <- event:
+			default:
+				delete(h.subs, sub)
+				sub.err = errSubscriberTooSlow
+				close(sub.events)
+			}
+			if _, ok := h.subs[sub]; !ok {
+				break
+			}
+		}
+	}
+}
+
+// close ends every stream and refuses new ones.
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		sub.err = errShuttingDown
+		close(sub.events)
+	}
+}
+
+// eventID identifies an event by its position in the chain, "block:logIndex".
+func eventID(event store.EventResponse) string {
+	return fmt.Sprintf("%d:%d", event.BlockNumber, event.LogIndex)
+}
+
+type position struct {
+	block    uint64
+	logIndex uint
+}
+
+func (p position) after(other position) bool {
+	return p.block > other.block || (p.block == other.block && p.logIndex > other.logIndex)
+}
+
+func parseEventID(id string) (position, error) {
+	block, logIndex, ok := strings.Cut(id, ":")
+	if !ok {
+		return position{}, fmt.Errorf("event ID must be block:logIndex")
+	}
+	b, err := strconv.ParseUint(block, 10, 64)
+	if err != nil {
+		return position{}, fmt.Errorf("invalid block in event ID: %w", err)
+	}
+	i, err := strconv.ParseUint(logIndex, 10, 32)
+	if err != nil {
+		return position{}, fmt.Errorf("invalid log index in event ID: %w", err)
+	}
+	return position{block: b, logIndex: uint(i)}, nil
+}
+
+// eventStream delivers the events matching a query: first the stored events
+// after the resume position, then live events as the poller stores them.
+type eventStream struct {
+	eventStore *store.Store
+	hub        *eventHub
+	query      store.Query
+	resume     *position
+}
+
+// run sends events until send or heartbeat fail, done is closed, the
+// subscriber falls behind or the hub closes.
+func (s *eventStream) run(send func(store.EventResponse) error, heartbeat func() error, done <-chan struct{}) error {
+	// Subscribe before reading the backlog so nothing stored in between is missed
+	sub := s.hub.subscribe(s.query)
+	defer s.hub.unsubscribe(sub)
+
+	var last position
+	if s.resume != nil {
+		last = *s.resume
+		q := s.query
+		q.Cursor = store.Cursor(last.block, last.logIndex)
+		q.Limit = store.MaxLimit
+		for {
+			page, err := s.eventStore.Query(q)
+			if err != nil {
+				return err
+			}
+			for _, event := range page.Events {
+				if err := send(event); err != nil {
+					return err
+				}
+				last = position{block: event.BlockNumber, logIndex: event.LogIndex}
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+	}
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				return sub.err
+			}
+			pos := position{block: event.BlockNumber, logIndex: event.LogIndex}
+			if s.resume != nil && !pos.after(last) {
+				continue
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+			last = pos
+		case <-ticker.C:
+			if err := heartbeat(); err != nil {
+				return err
+			}
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// newEventStream builds a stream from the request's filters and resume ID.
+// The resume ID is read from the Last-Event-ID header, or the last_event_id
+// query parameter for clients that cannot set headers.
+func newEventStream(c *fiber.Ctx, eventStore *store.Store, hub *eventHub) (*eventStream, error) {
+	q, err := parseEventQuery(c)
+	if err != nil {
+		return nil, err
+	}
+	q.Cursor, q.Limit, q.Descending = "", 0, false
+
+	stream := &eventStream{eventStore: eventStore, hub: hub, query: q}
+	id := c.Get("Last-Event-ID", c.Query("last_event_id"))
+	if id != "" {
+		pos, err := parseEventID(id)
+		if err != nil {
+			return nil, err
+		}
+		stream.resume = &pos
+	}
+	return stream, nil
+}
+
+// registerStreamRoutes exposes live events over Server-Sent Events and WebSocket.
+func registerStreamRoutes(app *fiber.App, eventStore *store.Store, hub *eventHub) {
+	app.Get("/events/stream", func(c *fiber.Ctx) error {
+		stream, err := newEventStream(c, eventStore, hub)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		c.Set("Content-Type", "text/event-stream")
+		c.Set("Cache-Control", "no-cache")
+		c.Set("Connection", "keep-alive")
+		c.Set("X-Accel-Buffering", "no")
+
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			send := func(event store.EventResponse) error {
+				data, err := json.Marshal(event)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "id: %s\ndata: %s\n\n", eventID(event), data)
+				return w.Flush()
+			}
+			heartbeat := func() error {
+				fmt.Fprint(w, ": heartbeat\n\n")
+				return w.Flush()
+			}
+
+			// Flush the headers right away so clients see the stream open
+			if err := heartbeat(); err != nil {
+				return
+			}
+			if err := stream.run(send, heartbeat, nil); err != nil {
+				streamLogger.Debug("Event stream closed", "err", err)
+			}
+		})
+		return nil
+	})
+
+	app.Use("/events/ws", func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return fiber.ErrUpgradeRequired
+		}
+		stream, err := newEventStream(c, eventStore, hub)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		c.Locals("stream", stream)
+		return c.Next()
+	})
+
+	app.Get("/events/ws", websocket.New(func(conn *websocket.Conn) {
+		stream := conn.Locals("stream").(*eventStream)
+
+		// The client never sends anything we act on; reading only detects
+		// when it goes away
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		send := func(event store.EventResponse) error {
+			return conn.WriteJSON(event)
+		}
+		heartbeat := func() error {
+			return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(heartbeatInterval))
+		}
+		if err := stream.run(send, heartbeat, done); err != nil {
+			streamLogger.Debug("Event WebSocket closed", "err", err)
+		}
+	}))
+}
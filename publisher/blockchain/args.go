@@ -0,0 +1,175 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// decodeArgs decodes a log's arguments into the envelope's encoding, which
+// argSchema describes.
+func decodeArgs(event abi.Event, vLog types.Log) (map[string]json.RawMessage, error) {
+	values, err := event.Inputs.NonIndexed().UnpackValues(vLog.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack data: %v", err)
+	}
+	if len(vLog.Topics) != 1+len(event.Inputs)-len(event.Inputs.NonIndexed()) {
+		return nil, fmt.Errorf("log has %d topics, %s needs %d", len(vLog.Topics), event.Sig, 1+len(event.Inputs)-len(event.Inputs.NonIndexed()))
+	}
+
+	args := make(map[string]json.RawMessage, len(event.Inputs))
+	data, topics := 0, vLog.Topics[1:]
+	for i, input := range event.Inputs {
+		var value interface{}
+		if input.Indexed {
+			value, err = topicValue(input.Type, topics[0])
+			topics = topics[1:]
+		} else {
+			value, err = argValue(input.Type, values[data])
+			data++
+		}
+		if err != nil {
+			return nil, fmt.Errorf("argument %s: %v", argName(input, i), err)
+		}
+		if args[argName(input, i)], err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// argName is the argument's name, or argN for unnamed arguments.
+func argName(input abi.Argument, i int) string {
+	if input.Name == "" {
+		return "arg" + strconv.Itoa(i)
+	}
+	return input.Name
+}
+
+// hashedWhenIndexed reports whether an indexed argument of type t is logged
+// as the keccak256 hash of its value.
+func hashedWhenIndexed(t abi.Type) bool {
+	switch t.T {
+	case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		return true
+	}
+	return false
+}
+
+// topicValue decodes an indexed argument from its topic.
+func topicValue(t abi.Type, topic common.Hash) (interface{}, error) {
+	if hashedWhenIndexed(t) {
+		return topic.Hex(), nil
+	}
+	parsed := make(map[string]interface{}, 1)
+	err := abi.ParseTopicsIntoMap(parsed, abi.Arguments{{Name: "v", Type: t, Indexed: true}}, []common.Hash{topic})
+	if err != nil {
+		return nil, err
+	}
+	return argValue(t, parsed["v"])
+}
+
+// argValue encodes an unpacked value by its ABI type.
+func argValue(t abi.Type, v interface{}) (interface{}, error) {
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		// Unpacked as *big.Int or as a sized Go integer
+		return fmt.Sprint(v), nil
+	case abi.BoolTy, abi.StringTy:
+		return v, nil
+	case abi.AddressTy:
+		address, ok := v.(common.Address)
+		if !ok {
+			return nil, fmt.Errorf("unexpected %T for address", v)
+		}
+		return address.Hex(), nil
+	case abi.BytesTy, abi.FixedBytesTy, abi.FunctionTy, abi.HashTy:
+		return hexutil.Encode(bytesOf(reflect.ValueOf(v))), nil
+	case abi.SliceTy, abi.ArrayTy:
+		rv := reflect.ValueOf(v)
+		values := make([]interface{}, rv.Len())
+		for i := range values {
+			value, err := argValue(*t.Elem, rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case abi.TupleTy:
+		rv := reflect.ValueOf(v)
+		fields := make(map[string]interface{}, len(t.TupleElems))
+		for i, elem := range t.TupleElems {
+			value, err := argValue(*elem, rv.Field(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			fields[tupleFieldName(t, i)] = value
+		}
+		return fields, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t.String())
+}
+
+func tupleFieldName(t abi.Type, i int) string {
+	if t.TupleRawNames[i] == "" {
+		return "field" + strconv.Itoa(i)
+	}
+	return t.TupleRawNames[i]
+}
+
+// bytesOf copies a byte slice or array.
+func bytesOf(rv reflect.Value) []byte {
+	b := make([]byte, rv.Len())
+	reflect.Copy(reflect.ValueOf(b), rv)
+	return b
+}
+
+// argSchema is the JSON Schema of an argument as decodeArgs encodes it.
+func argSchema(t abi.Type, indexed bool) map[string]interface{} {
+	schema := map[string]interface{}{"description": t.String()}
+	hexPattern := func(bytes string) {
+		schema["type"], schema["pattern"] = "string", "^0x[0-9a-fA-F]"+bytes+"$"
+	}
+	switch {
+	case indexed && hashedWhenIndexed(t):
+		hexPattern("{64}")
+		schema["description"] = "keccak256 of the indexed " + t.String()
+	case t.T == abi.IntTy:
+		schema["type"], schema["pattern"] = "string", "^-?[0-9]+$"
+	case t.T == abi.UintTy:
+		schema["type"], schema["pattern"] = "string", "^[0-9]+$"
+	case t.T == abi.BoolTy:
+		schema["type"] = "boolean"
+	case t.T == abi.StringTy:
+		schema["type"] = "string"
+	case t.T == abi.AddressTy:
+		hexPattern("{40}")
+	case t.T == abi.BytesTy:
+		hexPattern("*")
+		schema["pattern"] = "^0x([0-9a-fA-F]{2})*$"
+	case t.T == abi.FixedBytesTy, t.T == abi.FunctionTy, t.T == abi.HashTy:
+		hexPattern("{" + strconv.Itoa(2*t.GetType().Len()) + "}")
+	case t.T == abi.SliceTy:
+		schema["type"], schema["items"] = "array", argSchema(*t.Elem, false)
+	case t.T == abi.ArrayTy:
+		schema["type"], schema["items"] = "array", argSchema(*t.Elem, false)
+		schema["minItems"], schema["maxItems"] = t.Size, t.Size
+	case t.T == abi.TupleTy:
+		properties := make(map[string]interface{}, len(t.TupleElems))
+		required := make([]string, len(t.TupleElems))
+		for i, elem := range t.TupleElems {
+			required[i] = tupleFieldName(t, i)
+			properties[required[i]] = argSchema(*elem, false)
+		}
+		schema["type"], schema["properties"], schema["required"] = "object", properties, required
+		schema["additionalProperties"] = false
+	}
+	return schema
+}
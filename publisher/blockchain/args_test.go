@@ -0,0 +1,110 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http/httptest"
+	"shared/watch"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gofiber/fiber/v2"
+)
+
+const complexABI = `[{"type":"event","name":"Complex","anonymous":false,"inputs":[
+	{"name":"tag","type":"string","indexed":true},
+	{"name":"delta","type":"int64","indexed":true},
+	{"name":"pair","type":"uint8[2]","indexed":false},
+	{"name":"","type":"bytes","indexed":false},
+	{"name":"payee","type":"tuple","indexed":false,"components":[
+		{"name":"account","type":"address"},
+		{"name":"amount","type":"uint256"}]}]}]`
+
+func TestDecodeArgsOfEveryKind(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(complexABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := parsed.Events["Complex"]
+	account := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	payee := struct {
+		Account common.Address
+		Amount  *big.Int
+	}{account, big.NewInt(7)}
+	data, err := event.Inputs.NonIndexed().Pack([2]uint8{1, 2}, []byte{0xca, 0xfe}, payee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := crypto.Keccak256Hash([]byte("urgent"))
+	delta := common.BigToHash(new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(5)))
+
+	args, err := decodeArgs(event, types.Log{Topics: []common.Hash{event.ID, tag, delta}, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"tag":   `"` + tag.Hex() + `"`,
+		"delta": `"-5"`,
+		"pair":  `["1","2"]`,
+		"arg3":  `"0xcafe"`,
+		"payee": `{"account":"` + account.Hex() + `","amount":"7"}`,
+	}
+	for name, value := range want {
+		if string(args[name]) != value {
+			t.Errorf("%s = %s, want %s", name, args[name], value)
+		}
+	}
+
+	if _, err := decodeArgs(event, types.Log{Topics: []common.Hash{event.ID}, Data: data}); err == nil {
+		t.Fatal("decoded a log missing its indexed topics")
+	}
+
+	schema, _ := json.Marshal(EventSchema("diamond", event))
+	for _, fragment := range []string{
+		`"required":["tag","delta","pair","arg3","payee"]`,
+		`"pair":{"description":"uint8[2]","items":{"description":"uint8","pattern":"^[0-9]+$","type":"string"},"maxItems":2,"minItems":2,"type":"array"}`,
+		`"tag":{"description":"keccak256 of the indexed string","pattern":"^0x[0-9a-fA-F]{64}$","type":"string"}`,
+		`"signature":{"const":"Complex(string,int64,uint8[2],bytes,(address,uint256))"}`,
+	} {
+		if !strings.Contains(string(schema), fragment) {
+			t.Errorf("schema %s lacks %s", schema, fragment)
+		}
+	}
+}
+
+func TestSchemaRoutes(t *testing.T) {
+	watches, err := watch.Single(watch.Contract{Name: "diamond", Address: "0x16f2C2c173748f67126bfe3c28dD0a98210a2cDD"}, combinedABI(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	SchemaRoutes(app, watches)
+
+	for path, want := range map[string]string{
+		"/schemas":                                `"diamond":["ApproverAdded",`,
+		"/schemas/envelope":                       `"$id": "urn:contract-events:envelope:1.1"`,
+		"/schemas/diamond/ProposalApproved":       `"signature":{"const":"ProposalApproved(uint256)"}`,
+		"/proto/registry.json":                    `"contractevents.v1.Envelope"`,
+		"/proto/worker/v1/worker.proto":           `message ApprovalRequest {`,
+		"/proto/contractevents/v1/envelope.proto": `string replay = 16;`,
+	} {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != fiber.StatusOK || !strings.Contains(string(body), want) {
+			t.Errorf("GET %s: %d %s", path, resp.StatusCode, body)
+		}
+	}
+	for _, path := range []string{"/schemas/nope", "/schemas/diamond/Nope", "/proto/nope.proto"} {
+		if resp, _ := app.Test(httptest.NewRequest("GET", path, nil)); resp.StatusCode != fiber.StatusNotFound {
+			t.Errorf("GET %s: %d", path, resp.StatusCode)
+		}
+	}
+}
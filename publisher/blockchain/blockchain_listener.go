@@ -2,22 +2,29 @@ package blockchain
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"math/big"
-	"os"
 	"publisher/services"
+	"shared/envelope"
+	"shared/failover"
+	"shared/logging"
+	"shared/tracing"
+	"shared/watch"
 	"strings"
-	"time"
+	"sync"
+	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var logger = logging.For("listener")
+
 // Event ABI
 const InitializerABI = `[
     {
@@ -146,6 +153,25 @@ const approvalABI = `[
   ]`
 
 const proposalABI = `[
+    {
+      "anonymous": false,
+      "inputs": [
+        {
+          "indexed": true,
+          "internalType": "address",
+          "name": "sender",
+          "type": "address"
+        },
+        {
+          "indexed": false,
+          "internalType": "uint256",
+          "name": "amount",
+          "type": "uint256"
+        }
+      ],
+      "name": "DepositedEther",
+      "type": "event"
+    },
     {
       "anonymous": false,
       "inputs": [
@@ -270,30 +296,37 @@ const proposalABI = `[
     }
   ]`
 
-type EventPayload struct {
-	EventName        string                 `json:"eventName"`
-	Data             map[string]interface{} `json:"data"`
-	BlockNumber      uint64                 `json:"blockNumber"`
-	TransactionHash  string                 `json:"transactionHash"`
-	BlockHash        string                 `json:"blockHash"`
-	TransactionIndex uint                   `json:"transactionIndex"`
-	LogIndex         uint                   `json:"logIndex"`
-	Address          string                 `json:"address"`
+var facetABIs = map[string]string{
+	"Initializer": InitializerABI,
+	"Approval":    approvalABI,
+	"Proposal":    proposalABI,
 }
 
-var combinedABIs = []string{InitializerABI, approvalABI, proposalABI}
+// FacetABIs returns the built-in facet ABIs by facet name.
+func FacetABIs() (map[string]abi.ABI, error) {
+	facets := make(map[string]abi.ABI, len(facetABIs))
+	for name, abiString := range facetABIs {
+		parsed, err := abi.JSON(strings.NewReader(abiString))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s ABI: %v", name, err)
+		}
+		facets[name] = parsed
+	}
+	return facets, nil
+}
 
-func getCombinedABI() (abi.ABI, error) {
+// GetCombinedABI merges the facet ABIs into the diamond's ABI.
+func GetCombinedABI() (abi.ABI, error) {
 	parsedABI := abi.ABI{
 		Methods: make(map[string]abi.Method),
 		Events:  make(map[string]abi.Event),
 	}
 
-	for _, abiString := range combinedABIs {
-		tempABI, err := abi.JSON(strings.NewReader(abiString))
-		if err != nil {
-			return parsedABI, fmt.Errorf("failed to parse ABI: %v", err)
-		}
+	facets, err := FacetABIs()
+	if err != nil {
+		return parsedABI, err
+	}
+	for _, tempABI := range facets {
 		parsedABI = appendABI(parsedABI, tempABI)
 	}
 
@@ -315,106 +348,347 @@ func createEventSignatureMap(contractABI abi.ABI) map[string]abi.Event {
 	return eventMap
 }
 
-func ListenToContractEvents() {
-	err := godotenv.Load()
+// Listener subscribes to the logs of watched contracts and publishes their
+// decoded events. It implements watch.Runner, so contracts can be added and
+// removed at runtime. Each contract is kept subscribed by a supervisor; see
+// supervisor.go.
+type Listener struct {
+	client      *failover.Client
+	links       *tracing.TxLinks
+	checkpoints *checkpointFile
+
+	// publish hands on decoded events, to RabbitMQ unless PublishTo
+	// replaced it
+	publish func(ctx context.Context, env envelope.Envelope) error
+
+	// chainID is resolved with the first event, the timestamp of the
+	// latest block seen cached for the events that follow it
+	chainID   atomic.Uint64
+	blockMu   sync.Mutex
+	blockHash common.Hash
+	blockTime uint64
+
+	mu       sync.Mutex
+	running  map[string]*run
+	statuses map[string]*SubscriptionStatus
+}
+
+type run struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewListener connects to the Ethereum nodes at urls. Subscriptions need a
+// websocket endpoint; without one the listener polls for logs instead.
+func NewListener(urls []string) (*Listener, error) {
+	client, err := failover.Dial(failover.Config{URLs: urls})
 	if err != nil {
-		log.Fatalf("Error loading .env file")
+		return nil, fmt.Errorf("failed to connect to the Ethereum client: %v", err)
 	}
+	logger.Info("Connected to Ethereum RPC endpoints", "endpoints", len(urls))
 
-	contractAddress := os.Getenv("CONTRACT_ADDRESS")
-	if contractAddress == "" {
-		log.Fatalf("CONTRACT_ADDRESS environment variable not set")
-	}
+	return &Listener{
+		client: client,
+		publish: func(ctx context.Context, env envelope.Envelope) error {
+			return services.PublishEventToRabbitMQ(ctx, env)
+		},
+		running:  make(map[string]*run),
+		statuses: make(map[string]*SubscriptionStatus),
+	}, nil
+}
 
-	rpcUrl := os.Getenv("RPC_URL")
-	if contractAddress == "" {
-		log.Fatalf("CONTRACT_ADDRESS environment variable not set")
-	}
+// Client returns the listener's connection to the Ethereum node.
+func (l *Listener) Client() *failover.Client {
+	return l.client
+}
+
+// LinkTransactions links the events of transactions announced in links to
+// the traces that sent them.
+func (l *Listener) LinkTransactions(links *tracing.TxLinks) {
+	l.links = links
+}
+
+// PublishTo hands decoded events to publish instead of RabbitMQ. Call it
+// before Start.
+func (l *Listener) PublishTo(publish func(ctx context.Context, env envelope.Envelope) error) {
+	l.publish = publish
+}
 
-	client, err := ethclient.Dial(rpcUrl)
+// UseCheckpoints saves each contract's position to path when its listener
+// stops, and resumes from the saved positions. Call it before Start.
+func (l *Listener) UseCheckpoints(path string) error {
+	checkpoints, err := loadCheckpoints(path)
 	if err != nil {
-		log.Fatalf("Failed to connect to the Ethereum client: %v", err)
+		return err
 	}
-	defer client.Close()
+	l.checkpoints = checkpoints
+	return nil
+}
 
-	log.Println("Connected to Ethereum node via WebSocket.")
+// Start supervises the contract's subscription until the watch is stopped.
+// Subscriptions only deliver new logs, so the contract's start block does
+// not apply here. Connection failures are retried in the background.
+func (l *Listener) Start(c watch.Contract) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &run{cancel: cancel, done: make(chan struct{})}
 
-	combinedABI, err := getCombinedABI()
-	if err != nil {
-		log.Fatalf("Failed to get combined ABI: %v", err)
+	l.mu.Lock()
+	l.running[c.Name] = r
+	l.statuses[c.Name] = &SubscriptionStatus{Contract: c.Name, Address: c.Address, Mode: ModeSubscription}
+	l.mu.Unlock()
+
+	go func() {
+		defer close(r.done)
+		l.supervise(ctx, c)
+	}()
+	return nil
+}
+
+// Stop ends the named contract's subscription and waits for it to finish.
+func (l *Listener) Stop(name string) {
+	l.mu.Lock()
+	r, ok := l.running[name]
+	delete(l.running, name)
+	delete(l.statuses, name)
+	l.mu.Unlock()
+
+	if ok {
+		r.cancel()
+		<-r.done
 	}
-	eventSignatureMap := createEventSignatureMap(combinedABI)
-	query := ethereum.FilterQuery{
-		Addresses: []common.Address{common.HexToAddress(contractAddress)},
+}
+
+// StopAll ends every subscription and waits until ctx is done for the
+// listeners to hand on the log in progress and save their checkpoints.
+func (l *Listener) StopAll(ctx context.Context) error {
+	l.mu.Lock()
+	running := l.running
+	l.running = make(map[string]*run)
+	l.mu.Unlock()
+
+	for _, r := range running {
+		r.cancel()
 	}
-	logs := make(chan types.Log)
-	sub, err := client.SubscribeFilterLogs(context.Background(), query, logs)
-	if err != nil {
-		log.Fatalf("Failed to subscribe to event logs: %v", err)
+	for _, r := range running {
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
+	return nil
+}
+
+// ListenToContractEvents publishes the logs delivered by sub until the
+// subscription fails or ctx is cancelled. It returns the subscription error.
+func (l *Listener) ListenToContractEvents(ctx context.Context, c watch.Contract, sub ethereum.Subscription, logs <-chan types.Log, cursor *position) error {
 	defer sub.Unsubscribe()
 
-	log.Println("Successfully subscribed to contract events.")
+	eventSignatureMap := createEventSignatureMap(c.ABI)
 	for {
 		select {
+		case <-ctx.Done():
+			logger.Info("Stopped listening to contract events", "contract", c.Name)
+			return nil
 		case err := <-sub.Err():
-			log.Printf("Error while listening to event logs: %v. Reconnecting...", err)
-			time.Sleep(5 * time.Second)
-			return
+			return err
 		case vLog := <-logs:
-			event, ok := eventSignatureMap[vLog.Topics[0].Hex()]
-			if !ok {
-				log.Printf("Unknown event signature: %s", vLog.Topics[0].Hex())
-				continue
-			}
-
-			payload, err := createEventPayload(&event, combinedABI, vLog)
-			if err != nil {
-				log.Printf("Failed to parse log data: %v", err)
-				continue
-			}
-			err = services.PublishEventToRabbitMQ(payload)
-			if err != nil {
-				log.Printf("Failed to publish event to RabbitMQ: %v", err)
+			if err := l.handleLog(ctx, c, eventSignatureMap, vLog, cursor); err != nil {
+				return err
 			}
 		}
 	}
 }
 
-func createEventPayload(event *abi.Event, contractAbi abi.ABI, vLog types.Log) (EventPayload, error) {
-	dataMap := make(map[string]interface{})
-	err := contractAbi.UnpackIntoMap(dataMap, event.Name, vLog.Data)
-	if err != nil {
-		return EventPayload{}, fmt.Errorf("failed to unpack data: %v", err)
+// handleLog decodes and publishes one log, skipping logs removed by a reorg
+// and those at or before the cursor, which were already delivered by a
+// backfill or an earlier subscription. The cursor moves past the log once it
+// is published, or found not to be an event the listener can decode; any
+// other failure is returned, so that the log is fetched again.
+func (l *Listener) handleLog(ctx context.Context, c watch.Contract, eventSignatureMap map[string]abi.Event, vLog types.Log, cursor *position) error {
+	if vLog.Removed {
+		logger.Warn("Skipped a log removed by a reorg", "contract", c.Name, "block", vLog.BlockNumber, "log_index", vLog.Index, "tx_hash", vLog.TxHash.Hex())
+		return nil
+	}
+	if cursor.seen(vLog) {
+		return nil
+	}
+	l.setStatus(c.Name, func(s *SubscriptionStatus) { s.LastBlock = vLog.BlockNumber })
+	if head := l.client.Head(); head >= vLog.BlockNumber {
+		headLag.WithLabelValues(c.Name).Set(float64(head - vLog.BlockNumber))
+	}
+
+	// Anonymous events have no signature topic to recognise them by
+	if len(vLog.Topics) == 0 {
+		logger.Warn("Skipped a log without topics", "contract", c.Name, "tx_hash", vLog.TxHash.Hex())
+		eventsFailed.WithLabelValues("unknown", "decode").Inc()
+		cursor.advance(vLog)
+		return nil
+	}
+	event, ok := eventSignatureMap[vLog.Topics[0].Hex()]
+	if !ok {
+		logger.Warn("Unknown event signature", "contract", c.Name, "topic", vLog.Topics[0].Hex(), "tx_hash", vLog.TxHash.Hex())
+		eventsFailed.WithLabelValues("unknown", "decode").Inc()
+		cursor.advance(vLog)
+		return nil
+	}
+	eventsReceived.WithLabelValues(event.Name).Inc()
+
+	// Each event starts a trace of its own, linked to the request that sent
+	// the transaction when it came through the worker
+	opts := []trace.SpanStartOption{trace.WithAttributes(
+		attribute.String("eth.event", event.Name),
+		attribute.String("eth.contract", c.Name),
+		attribute.String("eth.tx_hash", vLog.TxHash.Hex()),
+		attribute.Int64("eth.block_number", int64(vLog.BlockNumber)),
+		attribute.Int("eth.log_index", int(vLog.Index)),
+	)}
+	if link, ok := l.links.Link(vLog.TxHash.Hex()); ok {
+		opts = append(opts, trace.WithLinks(link))
 	}
+	ctx, span := tracing.StartPublish(ctx, "events_queue", opts...)
+	defer span.End()
+	ctx = logging.WithTxHash(ctx, vLog.TxHash.Hex())
 
-	for i, input := range event.Inputs {
-		if input.Indexed {
-			dataMap[input.Name] = parseTopicValue(input.Type, vLog.Topics[i+1])
+	env, err := l.decode(ctx, c, event, vLog, noWait)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to decode event", "event", event.Name, "err", err)
+		eventsFailed.WithLabelValues(event.Name, "decode").Inc()
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, errUndecodable) {
+			cursor.advance(vLog)
+			return nil
 		}
+		return fmt.Errorf("failed to decode %s: %w", event.Name, err)
+	}
+	err = l.publish(ctx, env)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to publish event", "event", event.Name, "err", err)
+		eventsFailed.WithLabelValues(event.Name, "publish").Inc()
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to publish %s: %w", env.ID, err)
+	}
+	cursor.advance(vLog)
+	eventsPublished.WithLabelValues(event.Name).Inc()
+	logger.InfoContext(ctx, "Event published", "event", event.Name, "contract", c.Name, "block", vLog.BlockNumber, "log_index", vLog.Index)
+	return nil
+}
+
+// throttle is called before each call decode makes to the node, so replays
+// can limit them.
+type throttle func(ctx context.Context) error
+
+// noWait does not throttle live events.
+func noWait(context.Context) error { return nil }
+
+// errUndecodable is returned by decode for a log that does not match its
+// event's ABI, which no retry will change.
+var errUndecodable = errors.New("log does not match the event ABI")
+
+// decode builds the envelope of a log, with the transaction's sender and the
+// block's timestamp. Those are left out, with a warning, when the node
+// cannot be asked for them.
+func (l *Listener) decode(ctx context.Context, c watch.Contract, event abi.Event, vLog types.Log, wait throttle) (envelope.Envelope, error) {
+	chainID, err := l.resolveChainID(ctx, wait)
+	if err != nil {
+		return envelope.Envelope{}, err
+	}
+	env, err := newEnvelope(chainID, c, event, vLog)
+	if err != nil {
+		return envelope.Envelope{}, fmt.Errorf("%w: %v", errUndecodable, err)
+	}
+	env.From, err = transactionSender(ctx, l.client, vLog, wait)
+	if err != nil {
+		logger.WarnContext(ctx, "Failed to resolve transaction sender", "err", err)
+	}
+	env.BlockTimestamp, err = l.blockTimestamp(ctx, vLog.BlockHash, wait)
+	if err != nil {
+		logger.WarnContext(ctx, "Failed to resolve block timestamp", "block", vLog.BlockNumber, "err", err)
+	}
+	// A cancelled replay stops rather than publish an incomplete envelope
+	if err := ctx.Err(); err != nil {
+		return envelope.Envelope{}, err
 	}
+	return env, nil
+}
 
-	payload := EventPayload{
+// newEnvelope decodes a log of contract c on chain chainID. The sender and
+// block timestamp take calls to the node, and are left to the caller.
+func newEnvelope(chainID uint64, c watch.Contract, event abi.Event, vLog types.Log) (envelope.Envelope, error) {
+	args, err := decodeArgs(event, vLog)
+	if err != nil {
+		return envelope.Envelope{}, err
+	}
+	return envelope.Envelope{
+		ID:               envelope.ID(chainID, vLog.TxHash.Hex(), vLog.Index),
+		SchemaVersion:    envelope.SchemaVersion,
+		ChainID:          chainID,
+		Contract:         c.Name,
+		Address:          vLog.Address.Hex(),
 		EventName:        event.Name,
-		Data:             dataMap,
+		Signature:        event.Sig,
 		BlockNumber:      vLog.BlockNumber,
-		TransactionHash:  vLog.TxHash.Hex(),
 		BlockHash:        vLog.BlockHash.Hex(),
+		TransactionHash:  vLog.TxHash.Hex(),
 		TransactionIndex: vLog.TxIndex,
 		LogIndex:         vLog.Index,
-		Address:          vLog.Address.Hex(),
+		Args:             args,
+	}, nil
+}
+
+// resolveChainID returns the chain's ID, asking the node the first time.
+func (l *Listener) resolveChainID(ctx context.Context, wait throttle) (uint64, error) {
+	if id := l.chainID.Load(); id != 0 {
+		return id, nil
 	}
+	if err := wait(ctx); err != nil {
+		return 0, err
+	}
+	id, err := l.client.ChainID(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve the chain ID: %v", err)
+	}
+	l.chainID.Store(id.Uint64())
+	return id.Uint64(), nil
+}
 
-	return payload, nil
+// blockTimestamp returns the timestamp of the block with the given hash.
+// Logs arrive in block order, so only the latest block is cached.
+func (l *Listener) blockTimestamp(ctx context.Context, hash common.Hash, wait throttle) (uint64, error) {
+	l.blockMu.Lock()
+	cached, cachedTime := l.blockHash, l.blockTime
+	l.blockMu.Unlock()
+	if hash == cached {
+		return cachedTime, nil
+	}
+	if err := wait(ctx); err != nil {
+		return 0, err
+	}
+	header, err := l.client.HeaderByHash(ctx, hash)
+	if err != nil {
+		return 0, err
+	}
+	l.blockMu.Lock()
+	l.blockHash, l.blockTime = hash, header.Time
+	l.blockMu.Unlock()
+	return header.Time, nil
 }
 
-func parseTopicValue(argType abi.Type, topic common.Hash) interface{} {
-	switch argType.T {
-	case abi.AddressTy:
-		return common.HexToAddress(topic.Hex()).Hex()
-	case abi.UintTy, abi.IntTy:
-		return new(big.Int).SetBytes(topic[:]).String()
-	default:
-		return topic.Hex()
+// transactionSender resolves the account that sent the transaction which emitted the log.
+func transactionSender(ctx context.Context, client *failover.Client, vLog types.Log, wait throttle) (string, error) {
+	if err := wait(ctx); err != nil {
+		return "", err
+	}
+	tx, _, err := client.TransactionByHash(ctx, vLog.TxHash)
+	if err != nil {
+		return "", err
+	}
+	if err := wait(ctx); err != nil {
+		return "", err
+	}
+	sender, err := client.TransactionSender(ctx, tx, vLog.BlockHash, vLog.TxIndex)
+	if err != nil {
+		return "", err
 	}
+	return sender.Hex(), nil
 }
@@ -0,0 +1,208 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"shared/chaintest"
+	"shared/envelope"
+	"shared/watch"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func combinedABI(t *testing.T) abi.ABI {
+	t.Helper()
+	parsed, err := GetCombinedABI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestNewEnvelope(t *testing.T) {
+	sim := chaintest.New(t)
+	contractABI := combinedABI(t)
+	c := watch.Contract{Name: "diamond", Address: sim.Diamond.Hex(), ABI: contractABI}
+	sender := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+	tests := []struct {
+		event string
+		args  []interface{}
+		want  map[string]string
+	}{
+		{"DepositedEther", []interface{}{sender, big.NewInt(5e17)}, map[string]string{"sender": `"` + sender.Hex() + `"`, "amount": `"500000000000000000"`}},
+		{"ProposalApproved", []interface{}{big.NewInt(9)}, map[string]string{"proposalId": `"9"`}},
+		{"ThresholdSet", []interface{}{big.NewInt(2)}, map[string]string{"threshold": `"2"`}},
+	}
+	for _, test := range tests {
+		t.Run(test.event, func(t *testing.T) {
+			event := contractABI.Events[test.event]
+			receipt := sim.Emit(t, event, test.args...)
+			vLog := *receipt.Logs[0]
+
+			env, err := newEnvelope(1337, c, event, vLog)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if env.EventName != test.event || env.Signature != event.Sig || env.Contract != "diamond" ||
+				env.BlockNumber != receipt.BlockNumber.Uint64() || env.Address != sim.Diamond.Hex() {
+				t.Fatalf("unexpected envelope %+v", env)
+			}
+			if env.ID != fmt.Sprintf("1337:%s:%d", receipt.TxHash.Hex(), vLog.Index) || env.SchemaVersion != envelope.SchemaVersion {
+				t.Fatalf("envelope ID %s, version %s", env.ID, env.SchemaVersion)
+			}
+			if len(env.Args) != len(test.want) {
+				t.Fatalf("args = %s, want %v", env.Args, test.want)
+			}
+			for name, want := range test.want {
+				if got := string(env.Args[name]); got != want {
+					t.Errorf("%s = %s, want %s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// startListener runs a listener against sim with its checkpoints in path and
+// returns the envelopes it publishes.
+func startListener(t *testing.T, sim *chaintest.Chain, c watch.Contract, path string) (*Listener, <-chan envelope.Envelope) {
+	t.Helper()
+	l, err := NewListener(sim.URLs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(l.Client().Close)
+	published := make(chan envelope.Envelope, 10)
+	l.publish = func(_ context.Context, env envelope.Envelope) error {
+		published <- env
+		return nil
+	}
+	if err := l.UseCheckpoints(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Start(c); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.StopAll(context.Background()) })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for l.Connected(context.Background()) != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("listener did not connect: %+v", l.Statuses())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return l, published
+}
+
+func next(t *testing.T, published <-chan envelope.Envelope) envelope.Envelope {
+	t.Helper()
+	select {
+	case env := <-published:
+		return env
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event published")
+		return envelope.Envelope{}
+	}
+}
+
+func TestListenerPublishesAndResumesFromCheckpoint(t *testing.T) {
+	sim := chaintest.New(t)
+	contractABI := combinedABI(t)
+	c := watch.Contract{Name: "diamond", Address: sim.Diamond.Hex(), ABI: contractABI}
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+
+	l, published := startListener(t, sim, c, path)
+	recipient := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	receipt := sim.Emit(t, contractABI.Events["ProposalAdded"], recipient, big.NewInt(100))
+
+	env := next(t, published)
+	if env.EventName != "ProposalAdded" || string(env.Args["recipient"]) != `"`+recipient.Hex()+`"` ||
+		string(env.Args["amount"]) != `"100"` {
+		t.Fatalf("unexpected envelope %+v", env)
+	}
+	if env.From != sim.Emitter().Hex() || !sameLog(env, receipt.Logs[0]) {
+		t.Fatalf("envelope %+v does not match log %+v", env, receipt.Logs[0])
+	}
+	if env.ChainID != 1337 || env.BlockTimestamp == 0 {
+		t.Fatalf("chain ID %d, block timestamp %d", env.ChainID, env.BlockTimestamp)
+	}
+
+	// Events emitted while the publisher is down are backfilled on restart
+	if err := l.StopAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	missed := sim.Emit(t, contractABI.Events["ProposalExecuted"], big.NewInt(3))
+
+	_, published = startListener(t, sim, c, path)
+	env = next(t, published)
+	if env.EventName != "ProposalExecuted" || !sameLog(env, missed.Logs[0]) {
+		t.Fatalf("got %+v, want the missed ProposalExecuted", env)
+	}
+	select {
+	case extra := <-published:
+		t.Fatalf("published %s again", extra.EventName)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestHandleLogAdvancesPastPublishedLogsOnly(t *testing.T) {
+	sim := chaintest.New(t)
+	contractABI := combinedABI(t)
+	c := watch.Contract{Name: "diamond", Address: sim.Diamond.Hex(), ABI: contractABI}
+	l, err := NewListener(sim.URLs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(l.Client().Close)
+	var published []envelope.Envelope
+	failing := true
+	l.publish = func(_ context.Context, env envelope.Envelope) error {
+		if failing {
+			return errors.New("backlog full")
+		}
+		published = append(published, env)
+		return nil
+	}
+	events := createEventSignatureMap(contractABI)
+	vLog := *sim.Emit(t, contractABI.Events["ProposalApproved"], big.NewInt(1)).Logs[0]
+	var cursor position
+
+	removed := vLog
+	removed.Removed = true
+	if err := l.handleLog(context.Background(), c, events, removed, &cursor); err != nil || cursor.set {
+		t.Fatalf("removed log: %v, cursor %+v", err, cursor)
+	}
+	if err := l.handleLog(context.Background(), c, events, vLog, &cursor); err == nil || cursor.set {
+		t.Fatalf("failed publish: %v, cursor %+v", err, cursor)
+	}
+
+	failing = false
+	for range 2 {
+		if err := l.handleLog(context.Background(), c, events, vLog, &cursor); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(published) != 1 || !sameLog(published[0], &vLog) || cursor.block != vLog.BlockNumber || cursor.index != vLog.Index {
+		t.Fatalf("published %+v, cursor %+v", published, cursor)
+	}
+
+	anonymous := vLog
+	anonymous.Index++
+	anonymous.Topics = nil
+	if err := l.handleLog(context.Background(), c, events, anonymous, &cursor); err != nil || cursor.index != anonymous.Index || len(published) != 1 {
+		t.Fatalf("log without topics: %v, cursor %+v", err, cursor)
+	}
+}
+
+func sameLog(env envelope.Envelope, vLog *types.Log) bool {
+	return env.BlockNumber == vLog.BlockNumber && env.LogIndex == vLog.Index && env.TransactionHash == vLog.TxHash.Hex()
+}
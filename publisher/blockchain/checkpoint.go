@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"shared/watch"
+	"strings"
+	"sync"
+)
+
+// checkpoint is the last log a contract's listener handed on, saved when the
+// listener stops.
+type checkpoint struct {
+	Address string `json:"address"`
+	Block   uint64 `json:"block"`
+	Index   uint   `json:"index"`
+}
+
+// checkpointFile keeps the checkpoints of every watched contract in one JSON
+// file, so that after a restart the listeners backfill the logs emitted
+// while the publisher was down instead of starting from the head.
+type checkpointFile struct {
+	path string
+
+	mu    sync.Mutex
+	saved map[string]checkpoint
+}
+
+func loadCheckpoints(path string) (*checkpointFile, error) {
+	f := &checkpointFile{path: path, saved: make(map[string]checkpoint)}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoints: %w", err)
+	}
+	if err := json.Unmarshal(raw, &f.saved); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoints %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// resume returns the saved position of c, if it was last watched at the
+// same address.
+func (f *checkpointFile) resume(c watch.Contract) (position, bool) {
+	if f == nil {
+		return position{}, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	saved, ok := f.saved[c.Name]
+	if !ok || !strings.EqualFold(saved.Address, c.Address) {
+		return position{}, false
+	}
+	return position{block: saved.Block, index: saved.Index, set: true}, true
+}
+
+// save records the position of c and rewrites the file.
+func (f *checkpointFile) save(c watch.Contract, cursor position) error {
+	if f == nil || !cursor.set {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.saved[c.Name] = checkpoint{Address: c.Address, Block: cursor.block, Index: cursor.index}
+
+	raw, err := json.MarshalIndent(f.saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write a temporary file and rename it so a crash never leaves half a file
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,38 @@
+package blockchain
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	eventsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_events_received_total",
+		Help: "Contract logs received, by event name.",
+	}, []string{"event"})
+
+	eventsPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_events_published_total",
+		Help: "Events handed to the sinks, by event name.",
+	}, []string{"event"})
+
+	eventsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_events_failed_total",
+		Help: "Events that could not be decoded or published, by event name and stage.",
+	}, []string{"event", "stage"})
+
+	eventsReplayed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_events_replayed_total",
+		Help: "Past events published again by replays, by event name.",
+	}, []string{"event"})
+
+	headLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "publisher_head_lag_blocks",
+		Help: "Blocks between the chain head and the latest log handled, by contract.",
+	}, []string{"contract"})
+
+	reconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_reconnects_total",
+		Help: "Subscriptions lost and re-established, by contract.",
+	}, []string{"contract"})
+)
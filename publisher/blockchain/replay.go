@@ -0,0 +1,419 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"shared/admin"
+	"shared/envelope"
+	"shared/logging"
+	"shared/watch"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"golang.org/x/time/rate"
+)
+
+// Replay states.
+const (
+	ReplayRunning   = "running"
+	ReplayCompleted = "completed"
+	ReplayFailed    = "failed"
+	ReplayCancelled = "cancelled"
+)
+
+// Default throttling of replays, and how many finished replays are kept
+// for how long.
+const (
+	defaultReplayRate      = 10
+	defaultReplayRetention = 24 * time.Hour
+	defaultReplaysKept     = 100
+)
+
+// ErrReplayNotFound is returned for an unknown replay ID.
+var ErrReplayNotFound = errors.New("replay not found")
+
+// ReplayRequest asks for the past events of a watched contract to be
+// published again, to one sink or to one RabbitMQ queue.
+type ReplayRequest struct {
+	Contract  string `json:"contract"`
+	FromBlock uint64 `json:"fromBlock"`
+	// ToBlock is the last block replayed, the head when the replay starts
+	// if 0.
+	ToBlock uint64 `json:"toBlock,omitempty"`
+	// Events are the names of the events replayed, those the contract is
+	// watched for if empty.
+	Events []string `json:"events,omitempty"`
+
+	// Sink names the sink replayed events go to, Queue the RabbitMQ queue,
+	// which must already exist. Exactly one is set.
+	Sink  string `json:"sink,omitempty"`
+	Queue string `json:"queue,omitempty"`
+}
+
+// Replay is a replay's progress. Events are published in block order, so a
+// failed replay can be resumed with a new request from its NextBlock.
+type Replay struct {
+	ID string `json:"id"`
+	ReplayRequest
+	State string `json:"state"`
+	// NextBlock is the first block not yet replayed.
+	NextBlock  uint64     `json:"nextBlock"`
+	Published  int        `json:"published"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// ReplayTarget publishes one replayed event.
+type ReplayTarget func(ctx context.Context, env envelope.Envelope) error
+
+// ReplayOptions throttle replays to protect the RPC node.
+type ReplayOptions struct {
+	// BlockRange is the most blocks fetched per eth_getLogs call,
+	// maxBackfillRange if 0.
+	BlockRange uint64
+	// RequestsPerSecond limits the node calls of all replays together,
+	// each taking a token: every eth_getLogs, and for each event the two
+	// lookups of its transaction's sender and the lookup of its block,
+	// unless the previous event was in the same block. 10 if 0.
+	RequestsPerSecond float64
+	// Retention is how long a finished replay is listed, a day if 0, and
+	// Kept how many finished replays are at most, 100 if 0.
+	Retention time.Duration
+	Kept      int
+}
+
+// Replayer re-reads the logs of watched contracts for a block range and
+// publishes their events again, each marked with the replay's ID, in the
+// background. Live traffic is unaffected. Replays are kept in memory only,
+// and finished ones only for a while.
+type Replayer struct {
+	listener   *Listener
+	watches    *watch.List
+	target     func(r ReplayRequest) (ReplayTarget, error)
+	limiter    *rate.Limiter
+	blockRange uint64
+	retention  time.Duration
+	kept       int
+
+	mu      sync.Mutex
+	replays map[string]*replayRun
+}
+
+type replayRun struct {
+	Replay
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewReplayer replays the contracts on watches through the listener's node.
+// target returns where the events of a request go, or an error if its sink
+// or queue cannot be used.
+func NewReplayer(listener *Listener, watches *watch.List, target func(r ReplayRequest) (ReplayTarget, error), opts ReplayOptions) *Replayer {
+	if opts.BlockRange == 0 {
+		opts.BlockRange = maxBackfillRange
+	}
+	if opts.RequestsPerSecond <= 0 {
+		opts.RequestsPerSecond = defaultReplayRate
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = defaultReplayRetention
+	}
+	if opts.Kept <= 0 {
+		opts.Kept = defaultReplaysKept
+	}
+	return &Replayer{
+		listener:   listener,
+		watches:    watches,
+		target:     target,
+		limiter:    rate.NewLimiter(rate.Limit(opts.RequestsPerSecond), 1),
+		blockRange: opts.BlockRange,
+		retention:  opts.Retention,
+		kept:       opts.Kept,
+		replays:    make(map[string]*replayRun),
+	}
+}
+
+// Start checks the request and starts replaying it.
+func (r *Replayer) Start(req ReplayRequest) (Replay, error) {
+	if (req.Sink == "") == (req.Queue == "") {
+		return Replay{}, fmt.Errorf("exactly one of sink and queue is required")
+	}
+	c, ok := r.contract(req.Contract)
+	if !ok {
+		return Replay{}, fmt.Errorf("no watch named %s", req.Contract)
+	}
+	if len(req.Events) == 0 {
+		req.Events = c.Events
+	}
+	events := make(map[string]abi.Event)
+	var topics []common.Hash
+	for _, name := range req.Events {
+		event, ok := c.ABI.Events[name]
+		if !ok {
+			return Replay{}, fmt.Errorf("contract %s: event %s is not in its ABI", c.Name, name)
+		}
+		events[event.ID.Hex()] = event
+		topics = append(topics, event.ID)
+	}
+	if len(req.Events) == 0 {
+		events = createEventSignatureMap(c.ABI)
+	}
+	if req.ToBlock == 0 {
+		head, err := r.listener.client.BlockNumber(context.Background())
+		if err != nil {
+			return Replay{}, fmt.Errorf("failed to get the chain head: %v", err)
+		}
+		req.ToBlock = head
+	}
+	if req.FromBlock > req.ToBlock {
+		return Replay{}, fmt.Errorf("fromBlock %d is after toBlock %d", req.FromBlock, req.ToBlock)
+	}
+	publish, err := r.target(req)
+	if err != nil {
+		return Replay{}, err
+	}
+
+	query := ethereum.FilterQuery{Addresses: []common.Address{common.HexToAddress(c.Address)}}
+	if len(topics) > 0 {
+		query.Topics = [][]common.Hash{topics}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &replayRun{
+		Replay: Replay{
+			ID:            uuid.NewString(),
+			ReplayRequest: req,
+			State:         ReplayRunning,
+			NextBlock:     req.FromBlock,
+			StartedAt:     time.Now(),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	r.mu.Lock()
+	r.prune(time.Now())
+	r.replays[run.ID] = run
+	replay := run.Replay
+	r.mu.Unlock()
+
+	logger.Info("Replay started", "replay", run.ID, "contract", c.Name, "from", req.FromBlock, "to", req.ToBlock, "sink", req.Sink, "queue", req.Queue)
+	go func() {
+		defer close(run.done)
+		err := r.replay(ctx, run, c, query, events, publish)
+		r.finish(run, err)
+	}()
+	return replay, nil
+}
+
+// replay fetches the run's logs in ranges of at most blockRange blocks and
+// publishes their events.
+func (r *Replayer) replay(ctx context.Context, run *replayRun, c watch.Contract, query ethereum.FilterQuery, events map[string]abi.Event, publish ReplayTarget) error {
+	for from := run.FromBlock; from <= run.ToBlock; from += r.blockRange {
+		to := min(from+r.blockRange-1, run.ToBlock)
+		query.FromBlock = new(big.Int).SetUint64(from)
+		query.ToBlock = new(big.Int).SetUint64(to)
+		if err := r.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		logs, err := r.listener.client.FilterLogs(ctx, query)
+		if err != nil {
+			return fmt.Errorf("failed to fetch blocks %d to %d: %w", from, to, err)
+		}
+
+		for _, vLog := range logs {
+			if vLog.Removed || len(vLog.Topics) == 0 {
+				continue
+			}
+			event, ok := events[vLog.Topics[0].Hex()]
+			if !ok {
+				continue
+			}
+			logCtx := logging.WithTxHash(ctx, vLog.TxHash.Hex())
+			env, err := r.listener.decode(logCtx, c, event, vLog, r.limiter.Wait)
+			if err != nil {
+				return fmt.Errorf("failed to decode %s in block %d: %w", event.Name, vLog.BlockNumber, err)
+			}
+			env.Replay = run.ID
+			if err := publish(logCtx, env); err != nil {
+				return fmt.Errorf("failed to publish %s: %w", env.ID, err)
+			}
+			eventsReplayed.WithLabelValues(event.Name).Inc()
+			r.update(run, func(replay *Replay) { replay.Published++ })
+		}
+		r.update(run, func(replay *Replay) { replay.NextBlock = to + 1 })
+	}
+	return nil
+}
+
+func (r *Replayer) finish(run *replayRun, err error) {
+	now := time.Now()
+	r.update(run, func(replay *Replay) {
+		replay.FinishedAt = &now
+		switch {
+		case errors.Is(err, context.Canceled):
+			replay.State = ReplayCancelled
+		case err != nil:
+			replay.State = ReplayFailed
+			replay.Error = err.Error()
+		default:
+			replay.State = ReplayCompleted
+		}
+	})
+	log := logger.With("replay", run.ID, "published", run.Published, "next_block", run.NextBlock)
+	switch run.State {
+	case ReplayFailed:
+		log.Error("Replay failed", "err", err)
+	case ReplayCancelled:
+		log.Warn("Replay cancelled")
+	default:
+		log.Info("Replay completed")
+	}
+}
+
+// update changes the run's progress under the Replayer's lock, which
+// readers of the progress hold too.
+func (r *Replayer) update(run *replayRun, change func(replay *Replay)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change(&run.Replay)
+}
+
+// prune forgets the replays that finished more than the retention ago, and
+// the oldest finished ones past the number kept. Call it with the lock held.
+func (r *Replayer) prune(now time.Time) {
+	var finished []*replayRun
+	for id, run := range r.replays {
+		switch {
+		case run.FinishedAt == nil:
+		case now.Sub(*run.FinishedAt) > r.retention:
+			delete(r.replays, id)
+		default:
+			finished = append(finished, run)
+		}
+	}
+	if len(finished) <= r.kept {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].FinishedAt.After(*finished[j].FinishedAt) })
+	for _, run := range finished[r.kept:] {
+		delete(r.replays, run.ID)
+	}
+}
+
+func (r *Replayer) contract(name string) (watch.Contract, bool) {
+	for _, c := range r.watches.Contracts() {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return watch.Contract{}, false
+}
+
+// Replays returns every replay, the latest started first.
+func (r *Replayer) Replays() []Replay {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prune(time.Now())
+	replays := make([]Replay, 0, len(r.replays))
+	for _, run := range r.replays {
+		replays = append(replays, run.Replay)
+	}
+	sort.Slice(replays, func(i, j int) bool { return replays[i].StartedAt.After(replays[j].StartedAt) })
+	return replays
+}
+
+// Replay returns the replay with the given ID.
+func (r *Replayer) Replay(id string) (Replay, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run, ok := r.replays[id]
+	if !ok {
+		return Replay{}, fmt.Errorf("replay %s: %w", id, ErrReplayNotFound)
+	}
+	return run.Replay, nil
+}
+
+// Cancel stops the replay with the given ID and waits for it to finish.
+func (r *Replayer) Cancel(id string) (Replay, error) {
+	r.mu.Lock()
+	run, ok := r.replays[id]
+	r.mu.Unlock()
+	if !ok {
+		return Replay{}, fmt.Errorf("replay %s: %w", id, ErrReplayNotFound)
+	}
+	run.cancel()
+	<-run.done
+	return r.Replay(id)
+}
+
+// StopAll cancels the running replays and waits until ctx is done for them
+// to finish. Stop them before the sinks they publish to.
+func (r *Replayer) StopAll(ctx context.Context) error {
+	r.mu.Lock()
+	runs := make([]*replayRun, 0, len(r.replays))
+	for _, run := range r.replays {
+		runs = append(runs, run)
+	}
+	r.mu.Unlock()
+
+	for _, run := range runs {
+		run.cancel()
+	}
+	for _, run := range runs {
+		select {
+		case <-run.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// ReplayRoutes exposes the replays to requests sending token as a bearer
+// token. Without a token they are not served.
+func ReplayRoutes(router fiber.Router, r *Replayer, token string) {
+	routes, ok := admin.Group(router, "/admin/replays", token)
+	if !ok {
+		return
+	}
+
+	routes.Get("/", func(c *fiber.Ctx) error {
+		return c.JSON(r.Replays())
+	})
+
+	routes.Post("/", func(c *fiber.Ctx) error {
+		var request ReplayRequest
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+		replay, err := r.Start(request)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusAccepted).JSON(replay)
+	})
+
+	routes.Get("/:id", func(c *fiber.Ctx) error {
+		replay, err := r.Replay(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(replay)
+	})
+
+	routes.Delete("/:id", func(c *fiber.Ctx) error {
+		replay, err := r.Cancel(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(replay)
+	})
+}
@@ -0,0 +1,226 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"shared/chaintest"
+	"shared/envelope"
+	"shared/watch"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestReplayRepublishesPastEvents(t *testing.T) {
+	sim := chaintest.New(t)
+	contractABI := combinedABI(t)
+	watches, err := watch.Single(watch.Contract{Name: "diamond", Address: sim.Diamond.Hex()}, contractABI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewListener(sim.URLs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(l.Client().Close)
+
+	recipient := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	first := sim.Emit(t, contractABI.Events["ProposalApproved"], big.NewInt(1))
+	sim.Emit(t, contractABI.Events["ProposalAdded"], recipient, big.NewInt(100))
+	second := sim.Emit(t, contractABI.Events["ProposalApproved"], big.NewInt(2))
+	sim.Emit(t, contractABI.Events["ProposalApproved"], big.NewInt(3))
+
+	var mu sync.Mutex
+	var replayed []envelope.Envelope
+	r := NewReplayer(l, watches, func(req ReplayRequest) (ReplayTarget, error) {
+		if req.Sink != "test" {
+			return nil, errors.New("unknown sink")
+		}
+		return func(_ context.Context, env envelope.Envelope) error {
+			mu.Lock()
+			defer mu.Unlock()
+			replayed = append(replayed, env)
+			return nil
+		}, nil
+	}, ReplayOptions{BlockRange: 1, RequestsPerSecond: 1000})
+
+	replay, err := r.Start(ReplayRequest{
+		Contract:  "diamond",
+		FromBlock: first.BlockNumber.Uint64(),
+		ToBlock:   second.BlockNumber.Uint64(),
+		Events:    []string{"ProposalApproved"},
+		Sink:      "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay = waitForReplay(t, r, replay.ID)
+	if replay.State != ReplayCompleted || replay.Published != 2 || replay.NextBlock != second.BlockNumber.Uint64()+1 {
+		t.Fatalf("replay %+v", replay)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(replayed) != 2 || !sameLog(replayed[0], first.Logs[0]) || !sameLog(replayed[1], second.Logs[0]) {
+		t.Fatalf("replayed %+v", replayed)
+	}
+	for _, env := range replayed {
+		if env.Replay != replay.ID || env.From != sim.Emitter().Hex() || env.BlockTimestamp == 0 {
+			t.Errorf("replayed envelope %+v", env)
+		}
+	}
+
+	for _, req := range []ReplayRequest{
+		{Contract: "diamond", Sink: "test", Queue: "replays"},
+		{Contract: "nope", Sink: "test"},
+		{Contract: "diamond", Sink: "test", Events: []string{"Nope"}},
+		{Contract: "diamond", Sink: "test", FromBlock: 5, ToBlock: 4},
+		{Contract: "diamond", Sink: "nope"},
+	} {
+		if _, err := r.Start(req); err == nil {
+			t.Errorf("started %+v", req)
+		}
+	}
+}
+
+func TestFinishedReplaysArePruned(t *testing.T) {
+	r := NewReplayer(nil, nil, nil, ReplayOptions{Retention: time.Hour, Kept: 2})
+	now := time.Now()
+	finished := func(id string, ago time.Duration) {
+		at := now.Add(-ago)
+		r.replays[id] = &replayRun{Replay: Replay{ID: id, State: ReplayCompleted, StartedAt: at, FinishedAt: &at}}
+	}
+	r.replays["running"] = &replayRun{Replay: Replay{ID: "running", State: ReplayRunning, StartedAt: now.Add(-2 * time.Hour)}}
+	finished("expired", 2*time.Hour)
+	finished("oldest", 30*time.Minute)
+	finished("older", 20*time.Minute)
+	finished("latest", 10*time.Minute)
+
+	r.prune(now)
+	var kept []string
+	for _, replay := range r.Replays() {
+		kept = append(kept, replay.ID)
+	}
+	if strings.Join(kept, ",") != "latest,older,running" {
+		t.Fatalf("kept %v", kept)
+	}
+}
+
+func TestReplayRoutes(t *testing.T) {
+	sim := chaintest.New(t)
+	watches, err := watch.Single(watch.Contract{Name: "diamond", Address: sim.Diamond.Hex()}, combinedABI(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewListener(sim.URLs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(l.Client().Close)
+	r := NewReplayer(l, watches, func(ReplayRequest) (ReplayTarget, error) {
+		return func(context.Context, envelope.Envelope) error { return nil }, nil
+	}, ReplayOptions{})
+	app := fiber.New()
+	ReplayRoutes(app, r, "token")
+
+	request := func(method, path, body string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer token")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+	if status := request("POST", "/admin/replays", `{"contract":"diamond","sink":"all"}`); status != fiber.StatusAccepted {
+		t.Fatalf("POST: %d", status)
+	}
+	replays := r.Replays()
+	if len(replays) != 1 {
+		t.Fatalf("replays %+v", replays)
+	}
+	waitForReplay(t, r, replays[0].ID)
+	for _, test := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"POST", "/admin/replays", `{"contract":"nope","sink":"all"}`, fiber.StatusBadRequest},
+		{"GET", "/admin/replays/" + replays[0].ID, "", fiber.StatusOK},
+		{"DELETE", "/admin/replays/" + replays[0].ID, "", fiber.StatusOK},
+		{"GET", "/admin/replays/nope", "", fiber.StatusNotFound},
+		{"DELETE", "/admin/replays/nope", "", fiber.StatusNotFound},
+	} {
+		if status := request(test.method, test.path, test.body); status != test.want {
+			t.Errorf("%s %s: %d, want %d", test.method, test.path, status, test.want)
+		}
+	}
+	if resp, _ := app.Test(httptest.NewRequest("GET", "/admin/replays", nil)); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("GET without a token: %d", resp.StatusCode)
+	}
+
+	// Without a configured token the routes are not served at all
+	open := fiber.New()
+	ReplayRoutes(open, r, "")
+	if resp, _ := open.Test(httptest.NewRequest("GET", "/admin/replays", nil)); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("GET without a configured token: %d", resp.StatusCode)
+	}
+}
+
+func TestDecodeWaitsBeforeEachNodeCall(t *testing.T) {
+	sim := chaintest.New(t)
+	contractABI := combinedABI(t)
+	l, err := NewListener(sim.URLs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(l.Client().Close)
+	receipt := sim.Emit(t, contractABI.Events["ProposalApproved"], big.NewInt(1))
+
+	calls := 0
+	count := func(context.Context) error {
+		calls++
+		return nil
+	}
+	c := watch.Contract{Name: "diamond", Address: sim.Diamond.Hex()}
+	// The chain ID, the transaction, its sender and the block
+	if _, err := l.decode(context.Background(), c, contractABI.Events["ProposalApproved"], *receipt.Logs[0], count); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 4 {
+		t.Fatalf("waited %d times, want 4", calls)
+	}
+	// The chain ID and block are cached
+	calls = 0
+	if _, err := l.decode(context.Background(), c, contractABI.Events["ProposalApproved"], *receipt.Logs[0], count); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("waited %d times, want 2", calls)
+	}
+}
+
+func waitForReplay(t *testing.T, r *Replayer, id string) Replay {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		replay, err := r.Replay(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replay.State != ReplayRunning {
+			return replay
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("replay did not finish: %+v", replay)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,105 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"shared/codec"
+	"shared/envelope"
+	"shared/watch"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/gofiber/fiber/v2"
+)
+
+// EventSchema returns the JSON Schema of the envelopes published for event:
+// the envelope's schema, with the event's name, signature and arguments.
+func EventSchema(contract string, event abi.Event) map[string]interface{} {
+	properties := make(map[string]interface{}, len(event.Inputs))
+	required := make([]string, len(event.Inputs))
+	for i, input := range event.Inputs {
+		required[i] = argName(input, i)
+		properties[required[i]] = argSchema(input.Type, input.Indexed)
+	}
+	return map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         "urn:contract-events:" + contract + ":" + event.Name + ":" + envelope.SchemaVersion,
+		"title":       event.Sig,
+		"description": "Envelope of the " + event.Name + " events of " + contract,
+		"allOf":       []interface{}{map[string]interface{}{"$ref": envelope.SchemaID}},
+		"properties": map[string]interface{}{
+			"contract":  map[string]interface{}{"const": contract},
+			"eventName": map[string]interface{}{"const": event.Name},
+			"signature": map[string]interface{}{"const": event.Sig},
+			"args": map[string]interface{}{
+				"type":                 "object",
+				"properties":           properties,
+				"required":             required,
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+// SchemaRoutes serves the envelope's JSON Schemas: the envelope and
+// CloudEvent schemas, and one per event of each watched contract. The
+// Protobuf definitions and their registry file are under /proto.
+func SchemaRoutes(router fiber.Router, watches *watch.List) {
+	router.Get("/proto/*", func(c *fiber.Ctx) error {
+		name := c.Params("*")
+		raw, ok := codec.ProtoFile(name)
+		if !ok || strings.Contains(name, "..") {
+			return fiber.NewError(fiber.StatusNotFound, "no such file")
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		if strings.HasSuffix(name, ".json") {
+			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		}
+		return c.Send(raw)
+	})
+	router.Get("/schemas", func(c *fiber.Ctx) error {
+		index := map[string][]string{}
+		for _, contract := range watches.Contracts() {
+			events := make([]string, 0, len(contract.ABI.Events))
+			for name := range contract.ABI.Events {
+				if contract.EventEnabled(name) {
+					events = append(events, name)
+				}
+			}
+			sort.Strings(events)
+			index[contract.Name] = events
+		}
+		return c.JSON(fiber.Map{
+			"schemaVersion": envelope.SchemaVersion,
+			"schemas":       []string{"envelope", "cloudevent"},
+			"registry":      "/proto/registry.json",
+			"events":        index,
+		})
+	})
+	router.Get("/schemas/:name", func(c *fiber.Ctx) error {
+		schema, ok := envelope.Schema(c.Params("name"))
+		if !ok {
+			return fiber.NewError(fiber.StatusNotFound, "no such schema")
+		}
+		c.Set(fiber.HeaderContentType, "application/schema+json")
+		return c.Send(schema)
+	})
+	router.Get("/schemas/:contract/:event", func(c *fiber.Ctx) error {
+		for _, contract := range watches.Contracts() {
+			if contract.Name != c.Params("contract") {
+				continue
+			}
+			event, ok := contract.ABI.Events[c.Params("event")]
+			if !ok || !contract.EventEnabled(event.Name) {
+				break
+			}
+			schema, err := json.Marshal(EventSchema(contract.Name, event))
+			if err != nil {
+				return err
+			}
+			c.Set(fiber.HeaderContentType, "application/schema+json")
+			return c.Send(schema)
+		}
+		return fiber.NewError(fiber.StatusNotFound, "no such contract event")
+	})
+}
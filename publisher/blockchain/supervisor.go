@@ -0,0 +1,317 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand/v2"
+	"shared/failover"
+	"shared/watch"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// Delays between reconnection attempts grow from initialBackoff to maxBackoff.
+	initialBackoff = 1 * time.Second
+	maxBackoff     = 1 * time.Minute
+
+	// Polling mode checks for new logs this often, in ranges of at most
+	// maxBackfillRange blocks.
+	pollInterval     = 2 * time.Second
+	maxBackfillRange = 2000
+)
+
+// Listener modes.
+const (
+	ModeSubscription = "subscription"
+	ModePolling      = "polling"
+)
+
+// SubscriptionStatus describes the connection of one watched contract.
+type SubscriptionStatus struct {
+	Contract          string     `json:"contract"`
+	Address           string     `json:"address"`
+	Mode              string     `json:"mode"`
+	Connected         bool       `json:"connected"`
+	LastBlock         uint64     `json:"lastBlock"`
+	Reconnects        int        `json:"reconnects"`
+	LastError         string     `json:"lastError,omitempty"`
+	DisconnectedSince *time.Time `json:"disconnectedSince,omitempty"`
+}
+
+// position is the last log handed on, so that logs seen again after a
+// resubscription or backfill are skipped.
+type position struct {
+	block uint64
+	index uint
+	set   bool
+}
+
+// seen reports whether vLog is at or before the cursor.
+func (p *position) seen(vLog types.Log) bool {
+	return p.set && (vLog.BlockNumber < p.block || vLog.BlockNumber == p.block && vLog.Index <= p.index)
+}
+
+// advance moves the cursor to vLog.
+func (p *position) advance(vLog types.Log) {
+	p.block, p.index, p.set = vLog.BlockNumber, vLog.Index, true
+}
+
+// skipThrough marks every log up to and including block as seen.
+func (p *position) skipThrough(block uint64) {
+	if !p.set || block > p.block {
+		p.block, p.index, p.set = block, ^uint(0), true
+	}
+}
+
+// supervise keeps the contract subscribed until ctx is cancelled. After a
+// dropped subscription it resubscribes with jittered exponential backoff,
+// through whichever RPC endpoint is healthiest, and backfills the logs missed
+// while disconnected. If the endpoints cannot do subscriptions it polls. It
+// resumes from the contract's checkpoint, if any, and saves it on return.
+func (l *Listener) supervise(ctx context.Context, c watch.Contract) {
+	query := ethereum.FilterQuery{
+		Addresses: []common.Address{common.HexToAddress(c.Address)},
+		Topics:    c.Topics(),
+	}
+	eventSignatureMap := createEventSignatureMap(c.ABI)
+	cursor, resumed := l.checkpoints.resume(c)
+	if resumed {
+		logger.Info("Resuming from checkpoint", "contract", c.Name, "block", cursor.block)
+	}
+	defer func() {
+		if err := l.checkpoints.save(c, cursor); err != nil {
+			logger.Error("Failed to save checkpoint", "contract", c.Name, "err", err)
+		}
+	}()
+
+	for attempt := 0; ctx.Err() == nil; attempt++ {
+		if attempt > 0 {
+			if !sleep(ctx, backoff(attempt)) {
+				return
+			}
+		}
+
+		// Only logs after the current head are new to this listener
+		if !cursor.set {
+			head, err := l.client.BlockNumber(ctx)
+			if err != nil {
+				l.disconnected(c.Name, err)
+				continue
+			}
+			cursor.skipThrough(head)
+		}
+
+		logs := make(chan types.Log)
+		sub, err := l.client.SubscribeFilterLogs(ctx, query, logs)
+		if subscriptionsUnsupported(err) {
+			logger.Warn("Subscriptions are not supported, polling instead", "contract", c.Name, "err", err)
+			l.setStatus(c.Name, func(s *SubscriptionStatus) { s.Mode = ModePolling })
+			l.poll(ctx, c, query, eventSignatureMap, &cursor)
+			return
+		}
+		if err != nil {
+			l.disconnected(c.Name, err)
+			continue
+		}
+
+		if err := l.backfill(ctx, c, query, eventSignatureMap, &cursor); err != nil {
+			sub.Unsubscribe()
+			l.disconnected(c.Name, err)
+			continue
+		}
+		l.connected(c.Name)
+		logger.Info("Subscribed to contract events", "contract", c.Name)
+		attempt = 0
+
+		err = l.ListenToContractEvents(ctx, c, sub, logs, &cursor)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn("Subscription failed, reconnecting", "contract", c.Name, "err", err)
+		l.disconnected(c.Name, err)
+	}
+}
+
+// poll fetches new logs with eth_getLogs every pollInterval until ctx is
+// cancelled.
+func (l *Listener) poll(ctx context.Context, c watch.Contract, query ethereum.FilterQuery, eventSignatureMap map[string]abi.Event, cursor *position) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if err := l.backfill(ctx, c, query, eventSignatureMap, cursor); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			l.disconnected(c.Name, err)
+		} else {
+			l.connected(c.Name)
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Stopped polling contract events", "contract", c.Name)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// backfill publishes the logs between the cursor and the current head.
+func (l *Listener) backfill(ctx context.Context, c watch.Contract, query ethereum.FilterQuery, eventSignatureMap map[string]abi.Event, cursor *position) error {
+	head, err := l.client.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	// The cursor's own block is fetched again in case it was only partly seen
+	for from := cursor.block; from <= head; from += maxBackfillRange {
+		to := min(from+maxBackfillRange-1, head)
+		query.FromBlock = new(big.Int).SetUint64(from)
+		query.ToBlock = new(big.Int).SetUint64(to)
+		logs, err := l.client.FilterLogs(ctx, query)
+		if err != nil {
+			return err
+		}
+		for _, vLog := range logs {
+			if err := l.handleLog(ctx, c, eventSignatureMap, vLog, cursor); err != nil {
+				return err
+			}
+		}
+	}
+	cursor.skipThrough(head)
+	l.setStatus(c.Name, func(s *SubscriptionStatus) { s.LastBlock = max(s.LastBlock, head) })
+	headLag.WithLabelValues(c.Name).Set(0)
+	return nil
+}
+
+// subscriptionsUnsupported reports whether err means the endpoints cannot
+// push logs at all, rather than that they are unreachable.
+func subscriptionsUnsupported(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, failover.ErrNoWebSocket) || errors.Is(err, rpc.ErrNotificationsUnsupported) {
+		return true
+	}
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32601 // method not found
+}
+
+// backoff returns the delay before the given reconnection attempt: doubling
+// from initialBackoff up to maxBackoff, with jitter so that many listeners
+// do not reconnect in lockstep.
+func backoff(attempt int) time.Duration {
+	delay := maxBackoff
+	if attempt < 16 {
+		delay = min(initialBackoff<<(attempt-1), maxBackoff)
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// sleep waits for d and reports false if ctx was cancelled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (l *Listener) setStatus(name string, update func(s *SubscriptionStatus)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s, ok := l.statuses[name]; ok {
+		update(s)
+	}
+}
+
+func (l *Listener) connected(name string) {
+	l.setStatus(name, func(s *SubscriptionStatus) {
+		s.Connected = true
+		s.LastError = ""
+		s.DisconnectedSince = nil
+	})
+}
+
+func (l *Listener) disconnected(name string, err error) {
+	l.setStatus(name, func(s *SubscriptionStatus) {
+		if s.Connected {
+			s.Reconnects++
+			reconnects.WithLabelValues(name).Inc()
+		}
+		s.Connected = false
+		s.LastError = err.Error()
+		if s.DisconnectedSince == nil {
+			now := time.Now()
+			s.DisconnectedSince = &now
+		}
+	})
+}
+
+// Statuses reports the connection of every watched contract.
+func (l *Listener) Statuses() []SubscriptionStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	statuses := make([]SubscriptionStatus, 0, len(l.statuses))
+	for _, s := range l.statuses {
+		statuses = append(statuses, *s)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Contract < statuses[j].Contract })
+	return statuses
+}
+
+// Connected fails while any watched contract is disconnected.
+func (l *Listener) Connected(ctx context.Context) error {
+	var down []string
+	for _, s := range l.Statuses() {
+		if !s.Connected {
+			down = append(down, s.Contract)
+		}
+	}
+	if len(down) > 0 {
+		return fmt.Errorf("disconnected: %s", strings.Join(down, ", "))
+	}
+	return nil
+}
+
+// CaughtUp fails when a contract in polling mode trails the chain head by
+// more than maxLag blocks. Subscriptions push logs as they happen, so a
+// connected subscription is never behind.
+func (l *Listener) CaughtUp(maxLag uint64) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		head, err := l.client.BlockNumber(ctx)
+		if err != nil {
+			return err
+		}
+		var behind []string
+		for _, s := range l.Statuses() {
+			if s.Mode == ModePolling && head > s.LastBlock+maxLag {
+				behind = append(behind, fmt.Sprintf("%s is %d blocks behind", s.Contract, head-s.LastBlock))
+			}
+		}
+		if len(behind) > 0 {
+			return fmt.Errorf("%s", strings.Join(behind, ", "))
+		}
+		return nil
+	}
+}
+
+// Routes exposes the listener state.
+func (l *Listener) Routes(router fiber.Router) {
+	router.Get("/listeners", func(c *fiber.Ctx) error {
+		return c.JSON(l.Statuses())
+	})
+}
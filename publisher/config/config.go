@@ -0,0 +1,42 @@
+package config
+
+import (
+	sharedconfig "shared/config"
+)
+
+// Config is the publisher's configuration. See shared/config for the
+// sources each setting is read from.
+type Config struct {
+	Port            int                   `config:"port" default:"3000" validate:"port" usage:"HTTP port"`
+	ContractAddress string                `config:"contractAddress" validate:"required,address" usage:"address of the Diamond, watched unless watchConfig is set"`
+	WatchConfig     string                `config:"watchConfig" usage:"JSON file listing the contracts to watch"`
+	ABIRegistryDir  string                `config:"abiRegistryDir" usage:"directory of extra facet ABIs"`
+	AdminToken      string                `config:"adminToken" secret:"true" usage:"bearer token required by the admin routes, which are disabled without one"`
+	SinksConfig     string                `config:"sinksConfig" usage:"JSON file listing the sinks events are delivered to, RabbitMQ alone when empty"`
+	SinksBacklog    string                `config:"sinksBacklog" default:"sinks-backlog.json" usage:"file the events the sinks could not deliver before shutdown are saved to and sent from on the next start, empty to drop them"`
+	WebhooksFile    string                `config:"webhooksFile" default:"webhooks.db" usage:"database the webhook subscriptions and their deliveries are saved in, empty to keep them in memory"`
+	CheckpointFile  string                `config:"checkpointFile" default:"checkpoints.json" usage:"file the listeners save their position to on shutdown, empty to always start at the head"`
+	RabbitMQ        sharedconfig.RabbitMQ `config:"rabbitmq"`
+	RPC             sharedconfig.RPC      `config:"rpc"`
+	Log             sharedconfig.Log      `config:"log"`
+	Health          sharedconfig.Health   `config:"health"`
+	Shutdown        sharedconfig.Shutdown `config:"shutdown"`
+	Replay          Replay                `config:"replay"`
+}
+
+// Replay throttles the replays of past events, to protect the RPC node.
+type Replay struct {
+	BlockRange uint64  `config:"blockRange" default:"2000" usage:"most blocks a replay fetches per eth_getLogs call"`
+	Rate       float64 `config:"rate" default:"10" usage:"node requests per second of all replays together"`
+}
+
+// Load reads the configuration, exiting with a message when it is invalid.
+// It also points ConnectRabbitMQ at the configured broker.
+func Load() (*Config, sharedconfig.Effective) {
+	var cfg Config
+	effective := sharedconfig.MustLoad("publisher", &cfg)
+	mu.Lock()
+	rabbitMQURL = cfg.RabbitMQ.URL
+	mu.Unlock()
+	return &cfg, effective
+}
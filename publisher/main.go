@@ -2,24 +2,265 @@
 package main
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
 	"publisher/blockchain"
-	"publisher/utils"
+	"publisher/config"
+	"publisher/services"
+	"publisher/sinks"
+	"publisher/webhooks"
+	"shared/broker"
+	"shared/diamond"
+	"shared/envelope"
+	"shared/health"
+	"shared/lifecycle"
+	"shared/logging"
+	"shared/metrics"
+	"shared/tracing"
+	"shared/watch"
+	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
-	// Initialize logger
-	logger := utils.NewLogger()
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(replayCommand(os.Args[2:]))
+	}
+
+	cfg, effective := config.Load()
+	if err := logging.Init("publisher", cfg.Log.Level, cfg.Log.Levels); err != nil {
+		logging.Fatal("Invalid logging configuration", "err", err)
+	}
+	slog.Info("Configuration loaded", "config", effective.Map())
+
+	ctx, stop := lifecycle.SignalContext()
+	defer stop()
+
+	// Connect to the Ethereum node
+	listener, err := blockchain.NewListener(cfg.RPC.URLs)
+	if err != nil {
+		logging.Fatal("Failed to start listener", "err", err)
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), "publisher")
+	if err != nil {
+		logging.Fatal("Failed to initialize tracing", "err", err)
+	}
+
+	// Link events to the traces of the transactions the worker sent. Events
+	// are still published without links if the broker is not up yet.
+	links := tracing.NewTxLinks()
+	if err := consumeTxLinks(links); err != nil {
+		slog.Warn("Events will not be linked to transaction traces", "err", err)
+	}
+	listener.LinkTransactions(links)
+	// Deliver events to the configured sinks, to RabbitMQ alone by default
+	sinkConfigs := []sinks.Config{{Name: "rabbitmq", Type: sinks.TypeRabbitMQ}}
+	if cfg.SinksConfig != "" {
+		sinkConfigs, err = sinks.Load(cfg.SinksConfig)
+		if err != nil {
+			logging.Fatal("Failed to load sinks", "err", err)
+		}
+	}
+	eventSinks, err := sinks.New(sinkConfigs)
+	if err != nil {
+		logging.Fatal("Failed to open sinks", "err", err)
+	}
+	listener.PublishTo(eventSinks.Publish)
+
+	// Webhook subscriptions registered through the admin API are one more sink
+	hooks, err := webhooks.New(cfg.WebhooksFile, webhooks.Options{})
+	if err != nil {
+		logging.Fatal("Failed to load webhooks", "err", err)
+	}
+	if err := eventSinks.Attach("webhooks", hooks); err != nil {
+		logging.Fatal("Failed to add the webhooks sink", "err", err)
+	}
+	if cfg.SinksBacklog != "" {
+		if err := eventSinks.UseBacklogFile(cfg.SinksBacklog); err != nil {
+			logging.Fatal("Failed to load the sinks backlog", "err", err)
+		}
+	}
+
+	if cfg.CheckpointFile != "" {
+		if err := listener.UseCheckpoints(cfg.CheckpointFile); err != nil {
+			logging.Fatal("Failed to load checkpoints", "err", err)
+		}
+	}
+
+	combinedABI, err := blockchain.GetCombinedABI()
+	if err != nil {
+		logging.Fatal("Failed to get combined ABI", "err", err)
+	}
+
+	// Discover the diamond's facets and decode with the ABIs of those present,
+	// falling back to every built-in facet if the loupe is unavailable
+	facets, err := blockchain.FacetABIs()
+	if err != nil {
+		logging.Fatal("Failed to parse facet ABIs", "err", err)
+	}
+	registry := diamond.NewRegistry(facets)
+	if cfg.ABIRegistryDir != "" {
+		if err := registry.LoadDir(cfg.ABIRegistryDir); err != nil {
+			logging.Fatal("Failed to load ABI registry", "err", err)
+		}
+	}
+	tracker, err := diamond.NewTracker(context.Background(), listener.Client(), common.HexToAddress(cfg.ContractAddress), registry)
+	if err != nil {
+		slog.Warn("Facet discovery failed, using built-in facets", "err", err)
+	} else {
+		combinedABI = tracker.Layout().ABI
+	}
+
+	// Load the watch list, falling back to the diamond at contractAddress
+	var watches *watch.List
+	if cfg.WatchConfig != "" {
+		watches, err = watch.Load(cfg.WatchConfig, combinedABI)
+	} else {
+		watches, err = watch.Single(watch.Contract{
+			Name:    "diamond",
+			Address: cfg.ContractAddress,
+		}, combinedABI)
+	}
+	if err != nil {
+		logging.Fatal("Failed to load watch list", "err", err)
+	}
+
+	// Start listening to blockchain events for every watched contract
+	if err := watches.Run(listener); err != nil {
+		logging.Fatal("Failed to start listening", "err", err)
+	}
+
+	// Reload decoders when facets are added, replaced or removed
+	if tracker != nil {
+		tracker.OnChange(func(diamondABI abi.ABI) {
+			if err := watches.SetDefaultABI(diamondABI); err != nil {
+				slog.Error("Failed to apply new facets", "err", err)
+			}
+		})
+		go tracker.Run(ctx, 15*time.Second)
+	}
 
 	// Create a new Fiber app
 	app := fiber.New()
+	app.Use(tracing.Middleware())
+	app.Use(logging.Middleware())
+	app.Use(metrics.Middleware())
+	metrics.Routes(app)
+
+	// Admin routes to change the watch list and webhooks at runtime
+	watch.Routes(app, watches, cfg.AdminToken)
+	webhooks.Routes(app, hooks, cfg.AdminToken)
+	if tracker != nil {
+		tracker.Routes(app)
+	}
+	listener.Client().Routes(app)
+	listener.Routes(app)
+	blockchain.SchemaRoutes(app, watches)
+
+	// Replays publish past events again, to one sink or RabbitMQ queue
+	replayer := blockchain.NewReplayer(listener, watches, replayTarget(eventSinks), blockchain.ReplayOptions{
+		BlockRange:        cfg.Replay.BlockRange,
+		RequestsPerSecond: cfg.Replay.Rate,
+	})
+	blockchain.ReplayRoutes(app, replayer, cfg.AdminToken)
+
+	// Health, readiness and status
+	status := health.New("publisher")
+	status.Config("port", cfg.Port)
+	status.Config("rpcEndpoints", len(listener.Client().Status()))
+	status.Config("contractAddress", cfg.ContractAddress)
+	status.Config("watchConfig", cfg.WatchConfig)
+	status.Config("checkpointFile", cfg.CheckpointFile)
+	status.Config("sinksConfig", cfg.SinksConfig)
+	status.Config("sinksBacklog", cfg.SinksBacklog)
+	status.Config("webhooksFile", cfg.WebhooksFile)
+	status.Config("replayRate", cfg.Replay.Rate)
+	status.Config("rabbitmq", health.MaskURL(cfg.RabbitMQ.URL))
+	status.Ready("listeners", listener.Connected)
+	status.Ready("rpc", listener.Client().Ready(cfg.Health.MaxHeadAge))
+	if eventSinks.Uses(sinks.TypeRabbitMQ) {
+		status.Ready("rabbitmq", func(ctx context.Context) error {
+			_, _, err := config.ConnectRabbitMQ()
+			return err
+		})
+	}
+	status.Ready("listenerLag", listener.CaughtUp(50))
+	status.Status("rpc", func(ctx context.Context) any { return listener.Client().Status() })
+	status.Status("listeners", func(ctx context.Context) any { return listener.Statuses() })
+	status.Status("sinks", func(ctx context.Context) any { return eventSinks.Statuses() })
+	status.Status("replays", func(ctx context.Context) any { return replayer.Replays() })
+	status.Status("queues", health.QueueDepths(config.RabbitMQConnection, broker.EventsQueue.Name))
+	status.Routes(app)
 
-	// Start listening to blockchain events in a separate goroutine
-	go blockchain.ListenToContractEvents()
+	// Stop the listeners and replays once the admin routes are drained, so
+	// each finishes publishing the event in progress and the listeners save
+	// their checkpoints, then let the sinks drain their backlogs
+	var shutdown lifecycle.Shutdown
+	shutdown.Add("http", lifecycle.Drain(app))
+	shutdown.Add("replays", replayer.StopAll)
+	shutdown.Add("listeners", listener.StopAll)
+	shutdown.Add("sinks", eventSinks.Close)
+	shutdown.Add("rabbitmq", func(context.Context) error {
+		config.CloseRabbitMQ()
+		return nil
+	})
+	shutdown.Add("rpc", func(context.Context) error {
+		listener.Client().Close()
+		return nil
+	})
+	shutdown.Add("tracing", shutdownTracing)
+
+	slog.Info("Starting server", "port", cfg.Port)
+	if err := lifecycle.Serve(ctx, app, fmt.Sprintf(":%d", cfg.Port)); err != nil {
+		logging.Fatal("Server stopped", "err", err)
+	}
+	stop()
+	if err := shutdown.Run(cfg.Shutdown.Timeout); err != nil {
+		os.Exit(1)
+	}
+}
+
+// replayTarget publishes the events of a replay to the sink or RabbitMQ queue
+// it names. The queue must already exist, and cannot be one the services use
+// among themselves, where the envelopes would be taken for requests.
+func replayTarget(eventSinks *sinks.Set) func(req blockchain.ReplayRequest) (blockchain.ReplayTarget, error) {
+	return func(req blockchain.ReplayRequest) (blockchain.ReplayTarget, error) {
+		if req.Queue != "" {
+			if broker.Internal(req.Queue) || req.Queue == tracing.TxQueue {
+				return nil, fmt.Errorf("cannot replay to queue %s, which the services use", req.Queue)
+			}
+			if err := services.CheckQueue(req.Queue); err != nil {
+				return nil, err
+			}
+			return func(ctx context.Context, env envelope.Envelope) error {
+				return services.PublishEventToQueue(ctx, req.Queue, env)
+			}, nil
+		}
+		if !eventSinks.Has(req.Sink) {
+			return nil, fmt.Errorf("%w %s", sinks.ErrUnknownSink, req.Sink)
+		}
+		return func(ctx context.Context, env envelope.Envelope) error {
+			return eventSinks.PublishTo(ctx, req.Sink, env)
+		}, nil
+	}
+}
 
-	// Start the Fiber app
-	logger.Info("Starting server on port 3000...")
-	log.Fatal(app.Listen(":3000"))
+// consumeTxLinks reads the worker's transaction announcements on a channel of
+// its own, so they do not share flow control with event publishing.
+func consumeTxLinks(links *tracing.TxLinks) error {
+	conn, _, err := config.ConnectRabbitMQ()
+	if err != nil {
+		return err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	return links.Consume(broker.AMQP(ch))
 }
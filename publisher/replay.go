@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"publisher/blockchain"
+	"shared/lifecycle"
+	"strings"
+	"time"
+)
+
+// replayCommand runs "publisher replay": it asks a running publisher to
+// replay past events and follows the replay until it finishes. Interrupting
+// it cancels the replay.
+func replayCommand(args []string) int {
+	fs := flag.NewFlagSet("publisher replay", flag.ContinueOnError)
+	url := fs.String("url", "http://localhost:3000", "address of the running publisher")
+	token := fs.String("token", os.Getenv("ADMIN_TOKEN"), "admin token of the publisher (env ADMIN_TOKEN)")
+	contract := fs.String("contract", "diamond", "name of the watched contract to replay")
+	from := fs.Uint64("from", 0, "first block replayed")
+	to := fs.Uint64("to", 0, "last block replayed, the head if 0")
+	events := fs.String("events", "", "comma-separated events to replay, those watched if empty")
+	sink := fs.String("sink", "", "sink the events are published to")
+	queue := fs.String("queue", "", "existing RabbitMQ queue the events are published to, instead of a sink")
+	detach := fs.Bool("detach", false, "print the replay's ID and return without following it")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	request := blockchain.ReplayRequest{Contract: *contract, FromBlock: *from, ToBlock: *to, Sink: *sink, Queue: *queue}
+	if *events != "" {
+		request.Events = strings.Split(*events, ",")
+	}
+	client := replayClient{url: strings.TrimSuffix(*url, "/") + "/admin/replays", token: *token}
+	replay, err := client.do(http.MethodPost, "", request)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "publisher replay: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Replay %s of %s blocks %d to %d started\n", replay.ID, replay.Contract, replay.FromBlock, replay.ToBlock)
+	if *detach {
+		return 0
+	}
+
+	ctx, stop := lifecycle.SignalContext()
+	defer stop()
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for replay.State == blockchain.ReplayRunning {
+		select {
+		case <-ctx.Done():
+			replay, err = client.do(http.MethodDelete, replay.ID, nil)
+		case <-ticker.C:
+			replay, err = client.do(http.MethodGet, replay.ID, nil)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "publisher replay: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Replayed %d events, next block %d\n", replay.Published, replay.NextBlock)
+	}
+
+	fmt.Printf("Replay %s\n", replay.State)
+	if replay.State != blockchain.ReplayCompleted {
+		if replay.Error != "" {
+			fmt.Fprintf(os.Stderr, "publisher replay: %s\n", replay.Error)
+		}
+		return 1
+	}
+	return 0
+}
+
+// replayClient calls the publisher's replay routes.
+type replayClient struct {
+	url   string
+	token string
+}
+
+func (c replayClient) do(method, id string, body any) (blockchain.Replay, error) {
+	var replay blockchain.Replay
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return replay, err
+		}
+		reader = bytes.NewReader(raw)
+	}
+	url := c.url
+	if id != "" {
+		url += "/" + id
+	}
+	req, err := http.NewRequestWithContext(context.Background(), method, url, reader)
+	if err != nil {
+		return replay, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return replay, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var problem struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&problem)
+		return replay, fmt.Errorf("%s %s: %s %s", method, url, resp.Status, problem.Error)
+	}
+	return replay, json.NewDecoder(resp.Body).Decode(&replay)
+}
@@ -1,39 +1,97 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"publisher/config"
+	"shared/broker"
+	"shared/logging"
+	"shared/tracing"
 
 	"github.com/streadway/amqp"
 )
 
-func PublishEventToRabbitMQ(eventPayload interface{}) error {
-	_, ch, err := config.ConnectRabbitMQ()
+var logger = logging.For("rabbitmq")
+
+// PublishEventToRabbitMQ publishes the event on the shared RabbitMQ channel.
+func PublishEventToRabbitMQ(ctx context.Context, eventPayload interface{}) error {
+	_, b, err := config.ConnectRabbitMQ()
 	if err != nil {
 		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
 	}
+	return PublishEvent(ctx, b, eventPayload)
+}
+
+// PublishMessageToRabbitMQ publishes msg, an encoded event, on the shared
+// RabbitMQ channel.
+func PublishMessageToRabbitMQ(ctx context.Context, msg amqp.Publishing) error {
+	_, b, err := config.ConnectRabbitMQ()
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	return PublishMessage(ctx, b, msg)
+}
 
+// CheckQueue reports whether the named queue exists, with a passive declare
+// on a channel of its own: RabbitMQ closes the channel when the queue does
+// not exist, and the shared one must stay open.
+func CheckQueue(name string) error {
+	conn, _, err := config.ConnectRabbitMQ()
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+	if _, err := broker.AMQP(ch).Declare(broker.Queue{Name: name, Passive: true}); err != nil {
+		return fmt.Errorf("queue %s must be declared by its consumer first: %w", name, err)
+	}
+	return nil
+}
+
+// PublishEventToQueue publishes the event as JSON to the named queue on the
+// shared RabbitMQ channel.
+func PublishEventToQueue(ctx context.Context, queue string, eventPayload interface{}) error {
+	_, b, err := config.ConnectRabbitMQ()
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	return PublishEventTo(ctx, b, queue, eventPayload)
+}
+
+// PublishEvent publishes the event as JSON to the events queue on b.
+func PublishEvent(ctx context.Context, b broker.Broker, eventPayload interface{}) error {
+	return PublishEventTo(ctx, b, broker.EventsQueue.Name, eventPayload)
+}
+
+// PublishEventTo publishes the event as JSON to the named queue on b.
+func PublishEventTo(ctx context.Context, b broker.Broker, queue string, eventPayload interface{}) error {
 	payloadJSON, err := json.Marshal(eventPayload)
 	if err != nil {
 		return fmt.Errorf("failed to serialize event payload: %w", err)
 	}
+	return publish(ctx, b, queue, amqp.Publishing{
+		ContentType: "application/json",
+		Body:        payloadJSON,
+	})
+}
 
-	err = ch.Publish(
-		"",
-		"events_queue",
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        []byte(payloadJSON),
-		},
-	)
-	if err != nil {
+// PublishMessage publishes msg to the events queue on b, adding the trace
+// context of ctx to its headers.
+func PublishMessage(ctx context.Context, b broker.Broker, msg amqp.Publishing) error {
+	return publish(ctx, b, broker.EventsQueue.Name, msg)
+}
+
+func publish(ctx context.Context, b broker.Broker, queue string, msg amqp.Publishing) error {
+	msg.Headers = tracing.Inject(ctx, msg.Headers)
+	if err := b.Publish(queue, msg); err != nil {
 		return fmt.Errorf("failed to publish event to RabbitMQ: %w", err)
 	}
 
-	log.Printf("Event successfully published to RabbitMQ: %s", string(payloadJSON))
+	// Payloads can be large; they are only logged when debugging
+	logger.DebugContext(ctx, "Event published to RabbitMQ", "queue", queue, "payload", json.RawMessage(msg.Body))
 	return nil
 }
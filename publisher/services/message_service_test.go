@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"shared/broker"
+	"testing"
+	"time"
+)
+
+func TestPublishEvent(t *testing.T) {
+	m := broker.NewMemory()
+	subscriber := m.Channel()
+	if _, err := subscriber.Declare(broker.EventsQueue); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := subscriber.Consume(broker.EventsQueue.Name, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := map[string]interface{}{"eventName": "ProposalApproved", "data": map[string]string{"proposalId": "3"}}
+	if err := PublishEvent(context.Background(), m.Channel(), payload); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case d := <-deliveries:
+		if d.ContentType != "application/json" || string(d.Body) != `{"data":{"proposalId":"3"},"eventName":"ProposalApproved"}` {
+			t.Fatalf("got %s %s", d.ContentType, d.Body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event not published")
+	}
+}
+
+func TestPublishEventToQueue(t *testing.T) {
+	m := broker.NewMemory()
+	if _, err := m.Channel().Declare(broker.Queue{Name: "replays", Durable: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := PublishEventTo(context.Background(), m.Channel(), "replays", map[string]string{"replay": "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	if m.Len("replays") != 1 || m.Len(broker.EventsQueue.Name) != 0 {
+		t.Fatalf("replays holds %d, events queue %d", m.Len("replays"), m.Len(broker.EventsQueue.Name))
+	}
+}
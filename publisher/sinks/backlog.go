@@ -0,0 +1,112 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// unsent is an event a sink had not delivered when the Set closed, as saved
+// in the backlog file.
+type unsent struct {
+	Sink        string            `json:"sink"`
+	Name        string            `json:"name"`
+	Address     string            `json:"address"`
+	ID          string            `json:"id"`
+	Body        []byte            `json:"body"`
+	ContentType string            `json:"contentType,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+}
+
+// UseBacklogFile makes Close save the events the sinks have not delivered by
+// the shutdown deadline to path, instead of dropping them, and queues those
+// a previous run saved there. The listeners save their checkpoints past the
+// events they hand to the sinks, so without the file those events would
+// never be delivered.
+func (s *Set) UseBacklogFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read sinks backlog: %w", err)
+	}
+	var saved []unsent
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &saved); err != nil {
+			return fmt.Errorf("failed to parse sinks backlog %s: %w", path, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backlogFile = path
+	for _, u := range saved {
+		e := Event{Name: u.Name, Address: u.Address, ID: u.ID, Body: u.Body, ContentType: u.ContentType, Attributes: u.Attributes}
+		q := s.queue(u.Sink)
+		if q == nil {
+			logger.Warn("Saved event dropped, its sink is no longer configured", "sink", u.Sink, "event", e.Name, "id", e.ID)
+			continue
+		}
+		select {
+		case q.events <- pending{ctx: context.Background(), event: e}:
+		default:
+			logger.Warn("Saved event dropped, the sink's backlog is full", "sink", u.Sink, "event", e.Name, "id", e.ID)
+			q.drop()
+		}
+	}
+	if len(saved) > 0 {
+		logger.Info("Queued the events saved on the last shutdown", "events", len(saved))
+	}
+	return nil
+}
+
+// saveBacklog writes the events the sinks left undelivered to the backlog
+// file, removing it when there are none.
+func (s *Set) saveBacklog() error {
+	var saved []unsent
+	for _, q := range s.queues {
+		for _, p := range q.unsent {
+			e := p.event
+			saved = append(saved, unsent{
+				Sink:        q.config.Name,
+				Name:        e.Name,
+				Address:     e.Address,
+				ID:          e.ID,
+				Body:        e.Body,
+				ContentType: e.ContentType,
+				Attributes:  e.Attributes,
+			})
+		}
+	}
+	if len(saved) == 0 {
+		if err := os.Remove(s.backlogFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	raw, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write a temporary file and rename it so a crash never leaves half a file
+	tmp, err := os.CreateTemp(filepath.Dir(s.backlogFile), filepath.Base(s.backlogFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.backlogFile); err != nil {
+		return err
+	}
+	logger.Warn("Saved the events the sinks did not deliver before shutdown", "events", len(saved), "file", s.backlogFile)
+	return nil
+}
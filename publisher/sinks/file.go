@@ -0,0 +1,40 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// file appends each event's payload as one line of JSON, for audit trails
+// and for tools that tail a file.
+type file struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func newFile(c Config) (*file, error) {
+	f, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("sink %s: %w", c.Name, err)
+	}
+	return &file{f: f}, nil
+}
+
+func (s *file) Send(_ context.Context, e Event) error {
+	line := make([]byte, 0, len(e.Body)+1)
+	line = append(append(line, e.Body...), '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A single write keeps lines whole even if another process appends too
+	_, err := s.f.Write(line)
+	return err
+}
+
+func (s *file) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
@@ -0,0 +1,74 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// kafkaREST produces to a topic through a Kafka REST proxy speaking the
+// Confluent v2 API; it does not talk to the brokers itself. Records are
+// keyed by contract address so each contract's events stay in order on one
+// partition.
+type kafkaREST struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+func newKafkaREST(c Config) *kafkaREST {
+	return &kafkaREST{
+		endpoint: strings.TrimSuffix(c.URL, "/") + "/topics/" + url.PathEscape(c.Topic),
+		headers:  c.Headers,
+		client:   &http.Client{},
+	}
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (k *kafkaREST) Send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(map[string][]kafkaRecord{
+		"records": {{Key: e.Address, Value: e.Body}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	for key, value := range k.headers {
+		req.Header.Set(key, value)
+	}
+
+	// The proxy answers 200 even when a record fails, with the error in
+	// its offset
+	var produced struct {
+		Offsets []struct {
+			Error *string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := post(k.client, req, &produced); err != nil {
+		return err
+	}
+	for _, offset := range produced.Offsets {
+		if offset.Error != nil {
+			return fmt.Errorf("the Kafka REST proxy rejected the record: %s", *offset.Error)
+		}
+	}
+	return nil
+}
+
+func (k *kafkaREST) Close() error {
+	k.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,18 @@
+package sinks
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	sinkEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_sink_events_total",
+		Help: "Events handled by each sink, by outcome: delivered, failed (an attempt, retried) or dropped.",
+	}, []string{"sink", "outcome"})
+
+	sinkBacklog = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "publisher_sink_backlog",
+		Help: "Events waiting to be delivered, by sink.",
+	}, []string{"sink"})
+)
@@ -0,0 +1,66 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// jetStream publishes to a JetStream subject and waits for the stream to
+// acknowledge each event. Events carry their ID as the message ID, so the
+// stream discards the duplicates a retry can produce.
+type jetStream struct {
+	conn    *nats.Conn
+	js      jetstream.JetStream
+	subject string
+}
+
+func newNATS(c Config) (*jetStream, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("sink %s: invalid url: %w", c.Name, err)
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return nil, fmt.Errorf("sink %s: url must start with nats:// or tls://", c.Name)
+	}
+	// The server need not be up yet: the client keeps reconnecting, and
+	// sends fail, to be retried, until it is
+	conn, err := nats.Connect(c.URL,
+		nats.Name("publisher"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("sink %s: %w", c.Name, err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("sink %s: %w", c.Name, err)
+	}
+	return &jetStream{conn: conn, js: js, subject: c.Subject}, nil
+}
+
+func (j *jetStream) Send(ctx context.Context, e Event) error {
+	msg := nats.NewMsg(strings.ReplaceAll(j.subject, "{event}", e.Name))
+	msg.Data = e.Body
+	for name, value := range e.cloudEventHeaders("ce-") {
+		msg.Header.Set(name, value)
+	}
+	if e.ContentType != "" {
+		msg.Header.Set("Content-Type", e.ContentType)
+	}
+	// The Set retries failed sends, so a subject without a stream fails
+	// straight away
+	_, err := j.js.PublishMsg(ctx, msg, jetstream.WithMsgID(e.ID), jetstream.WithRetryAttempts(0))
+	return err
+}
+
+func (j *jetStream) Close() error {
+	j.conn.Close()
+	return nil
+}
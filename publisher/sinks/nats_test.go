@@ -0,0 +1,178 @@
+package sinks
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// fakeJetStream accepts NATS connections and acknowledges each HPUB as
+// answer says, recording the publications.
+type fakeJetStream struct {
+	listener  net.Listener
+	published chan string
+	connects  chan string
+	conns     chan net.Conn
+}
+
+func newFakeJetStream(t *testing.T, answer func(subject, header string) (op, reply string)) *fakeJetStream {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	f := &fakeJetStream{
+		listener:  listener,
+		published: make(chan string, 10),
+		connects:  make(chan string, 10),
+		conns:     make(chan net.Conn, 10),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			f.conns <- conn
+			go f.serve(conn, answer)
+		}
+	}()
+	return f
+}
+
+func (f *fakeJetStream) url(userinfo string) string {
+	return "nats://" + userinfo + f.listener.Addr().String()
+}
+
+func (f *fakeJetStream) serve(conn net.Conn, answer func(subject, header string) (op, reply string)) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"version\":\"2.10.0\",\"proto\":1,\"headers\":true,\"max_payload\":1048576}\r\n")
+	sid := "1"
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		op, args, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		switch op {
+		case "CONNECT":
+			f.connects <- args
+		case "PING":
+			fmt.Fprintf(conn, "PONG\r\n")
+		case "SUB":
+			// SUB <subject> <sid>, the client's reply inbox
+			fields := strings.Fields(args)
+			sid = fields[len(fields)-1]
+		case "HPUB":
+			// HPUB <subject> <reply-to> <header size> <total size>
+			fields := strings.Fields(args)
+			headerSize, _ := strconv.Atoi(fields[2])
+			totalSize, _ := strconv.Atoi(fields[3])
+			payload := make([]byte, totalSize+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			header, body := string(payload[:headerSize]), string(payload[headerSize:totalSize])
+			f.published <- fields[0] + " " + body
+			op, reply := answer(fields[0], header)
+			if op == "HMSG" {
+				fmt.Fprintf(conn, "HMSG %s %s %d %d\r\n%s\r\n", fields[1], sid, len(reply), len(reply), reply)
+			} else {
+				fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", fields[1], sid, len(reply), reply)
+			}
+		}
+	}
+}
+
+func TestNATSPublishesToJetStream(t *testing.T) {
+	f := newFakeJetStream(t, func(subject, header string) (string, string) {
+		if !strings.Contains(header, "Nats-Msg-Id: 0xabc:2\r\n") || !strings.Contains(header, "ce-id: 0xabc:2\r\n") {
+			return "MSG", `{"error":{"code":400,"description":"missing message ID"}}`
+		}
+		switch subject {
+		case "events.ProposalApproved":
+			return "MSG", `{"stream":"EVENTS","seq":1}`
+		case "events.Full":
+			return "MSG", `{"error":{"code":503,"err_code":10077,"description":"maximum messages exceeded"}}`
+		}
+		return "HMSG", "NATS/1.0 503\r\n\r\n"
+	})
+
+	sink, err := newNATS(Config{Name: "js", URL: f.url("publisher:secret@"), Subject: "events.{event}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	e := Event{
+		Name:       "ProposalApproved",
+		ID:         "0xabc:2",
+		Body:       []byte(`{"eventName":"ProposalApproved"}`),
+		Attributes: map[string]string{"id": "0xabc:2"},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sink.Send(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-f.published; got != `events.ProposalApproved {"eventName":"ProposalApproved"}` {
+		t.Fatalf("published %q", got)
+	}
+	if connect := <-f.connects; !strings.Contains(connect, `"user":"publisher"`) || !strings.Contains(connect, `"pass":"secret"`) {
+		t.Fatalf("CONNECT %s", connect)
+	}
+
+	e.Name = "Full"
+	if err := sink.Send(ctx, e); err == nil || !strings.Contains(err.Error(), "maximum messages exceeded") {
+		t.Fatalf("err = %v", err)
+	}
+	e.Name = "Unbound"
+	if err := sink.Send(ctx, e); !errors.Is(err, jetstream.ErrNoStreamResponse) {
+		t.Fatalf("err = %v, want %v", err, jetstream.ErrNoStreamResponse)
+	}
+
+	// The connection is reused between sends
+	select {
+	case connect := <-f.connects:
+		t.Fatalf("connected again: %s", connect)
+	default:
+	}
+}
+
+func TestNATSReconnectsAfterTheConnectionFails(t *testing.T) {
+	f := newFakeJetStream(t, func(string, string) (string, string) {
+		return "MSG", `{"stream":"EVENTS","seq":1}`
+	})
+	sink, err := newNATS(Config{Name: "js", URL: f.url("token@"), Subject: "events"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	e := Event{Name: "ProposalApproved", ID: "0xabc:2", Body: []byte(`{}`)}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := sink.Send(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if connect := <-f.connects; !strings.Contains(connect, `"auth_token":"token"`) {
+		t.Fatalf("CONNECT %s", connect)
+	}
+
+	(<-f.conns).Close()
+	<-f.connects
+	if err := sink.Send(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,39 @@
+package sinks
+
+import (
+	"context"
+	"publisher/services"
+
+	"github.com/streadway/amqp"
+)
+
+// rabbitMQ publishes to the events queue on the publisher's shared channel,
+// as the publisher always has.
+type rabbitMQ struct{}
+
+func newRabbitMQ() *rabbitMQ {
+	return &rabbitMQ{}
+}
+
+// Send publishes e's body as is. In the binary format the CloudEvents
+// attributes go in application properties prefixed "cloudEvents:", as the
+// AMQP binding names them.
+func (rabbitMQ) Send(ctx context.Context, e Event) error {
+	var headers amqp.Table
+	if len(e.Attributes) > 0 {
+		headers = amqp.Table{}
+		for key, value := range e.cloudEventHeaders("cloudEvents:") {
+			headers[key] = value
+		}
+	}
+	return services.PublishMessageToRabbitMQ(ctx, amqp.Publishing{
+		ContentType: e.contentType(),
+		Headers:     headers,
+		Body:        e.Body,
+	})
+}
+
+// Close leaves the shared connection to the publisher's shutdown.
+func (rabbitMQ) Close() error {
+	return nil
+}
@@ -0,0 +1,372 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"shared/envelope"
+	"shared/logging"
+	"sync"
+	"time"
+)
+
+var logger = logging.For("sinks")
+
+// ErrUnknownSink is returned for a sink name that is not in the Set.
+var ErrUnknownSink = errors.New("unknown sink")
+
+// Set fans events out to its sinks. Every sink has a backlog drained by a
+// goroutine of its own, which retries failed sends with exponential backoff.
+type Set struct {
+	mu          sync.RWMutex
+	closed      bool
+	queues      []*queue
+	backlogFile string
+}
+
+// queue is one sink with its filter, backlog and delivery counters.
+type queue struct {
+	config Config
+	sink   Sink
+	events chan pending
+
+	// stopping is cancelled when the shutdown deadline passes, abandoning
+	// the send in progress and the rest of the backlog, which are set aside
+	// in unsent
+	stopping context.Context
+	stop     context.CancelFunc
+	done     chan struct{}
+	unsent   []pending
+
+	mu          sync.Mutex
+	delivered   uint64
+	dropped     uint64
+	lastError   string
+	lastErrorAt time.Time
+}
+
+type pending struct {
+	ctx   context.Context
+	event Event
+}
+
+// Status is a sink's state as shown on the status page.
+type Status struct {
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Backlog     int       `json:"backlog"`
+	Delivered   uint64    `json:"delivered"`
+	Dropped     uint64    `json:"dropped"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// New opens the sinks described by configs and starts delivering to them.
+func New(configs []Config) (*Set, error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("at least one sink is required")
+	}
+	names := make(map[string]bool, len(configs))
+	for i := range configs {
+		configs[i].applyDefaults()
+		if err := configs[i].validate(); err != nil {
+			return nil, err
+		}
+		if names[configs[i].Name] {
+			return nil, fmt.Errorf("sink %s is configured twice", configs[i].Name)
+		}
+		names[configs[i].Name] = true
+	}
+
+	s := &Set{}
+	for _, c := range configs {
+		sink, err := open(c)
+		if err != nil {
+			s.Close(context.Background())
+			return nil, err
+		}
+		s.add(c, sink)
+	}
+	return s, nil
+}
+
+func (s *Set) add(c Config, sink Sink) {
+	stopping, stop := context.WithCancel(context.Background())
+	q := &queue{
+		config:   c,
+		sink:     sink,
+		events:   make(chan pending, c.Backlog),
+		stopping: stopping,
+		stop:     stop,
+		done:     make(chan struct{}),
+	}
+	s.queues = append(s.queues, q)
+	go q.run()
+}
+
+// Publish sends an event's envelope to every sink whose filters select it,
+// in the format of each sink. It waits for room in full backlogs until ctx
+// is done; delivery itself happens in the background.
+func (s *Set) Publish(ctx context.Context, env envelope.Envelope) error {
+	e, err := newEvent(env)
+	if err != nil {
+		return err
+	}
+	return s.Send(ctx, e)
+}
+
+// PublishTo sends an event's envelope to the named sink alone, if its
+// filters select it. Unlike Publish it waits for room in the sink's backlog,
+// until ctx is done, so that a replay of many events is held back by the
+// sink rather than dropped.
+func (s *Set) PublishTo(ctx context.Context, name string, env envelope.Envelope) error {
+	e, err := newEvent(env)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return fmt.Errorf("sinks are closed")
+	}
+	q := s.queue(name)
+	if q == nil {
+		return fmt.Errorf("%w %s", ErrUnknownSink, name)
+	}
+	if !q.config.Selects(e) {
+		return nil
+	}
+	if err := q.enqueue(ctx, e); err != nil {
+		return fmt.Errorf("sink %s: %w", name, err)
+	}
+	return nil
+}
+
+// newEvent wraps an envelope, as JSON, for the sinks.
+func newEvent(env envelope.Envelope) (Event, error) {
+	body, err := json.Marshal(env)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to serialize event envelope: %w", err)
+	}
+	return Event{
+		Name:       env.EventName,
+		Address:    env.Address,
+		ID:         env.ID,
+		Body:       body,
+		Attributes: env.CloudEventAttributes(),
+	}, nil
+}
+
+// Send queues e, encoded in each sink's format, for every sink whose
+// filters select it. A sink whose backlog is full holds the caller back
+// until it has room or ctx is done, so that a slow sink slows the listeners
+// down rather than losing events. When Send fails, the sinks that had room
+// have queued e already, and get it again if the caller retries.
+func (s *Set) Send(ctx context.Context, e Event) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return fmt.Errorf("sinks are closed")
+	}
+
+	var errs []error
+	for _, q := range s.queues {
+		if !q.config.Selects(e) {
+			continue
+		}
+		if err := q.enqueue(ctx, e); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", q.config.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// enqueue adds e, in the sink's format, to the backlog, waiting for room
+// until ctx is done. The event outlives ctx, but keeps its trace.
+func (q *queue) enqueue(ctx context.Context, e Event) error {
+	encoded, err := q.config.encode(e)
+	if err != nil {
+		q.drop()
+		return err
+	}
+	p := pending{ctx: context.WithoutCancel(ctx), event: encoded}
+	// A backlog with room takes the event even when ctx is done already
+	select {
+	case q.events <- p:
+	default:
+		select {
+		case q.events <- p:
+		case <-ctx.Done():
+			return fmt.Errorf("backlog of %d events is full: %w", q.config.Backlog, ctx.Err())
+		}
+	}
+	sinkBacklog.WithLabelValues(q.config.Name).Set(float64(len(q.events)))
+	return nil
+}
+
+// Attach adds a sink created outside the sinks config file, such as the
+// webhook subscriptions, with the default backlog and retries. Its name
+// cannot be one the config file already uses.
+func (s *Set) Attach(name string, sink Sink) error {
+	c := Config{Name: name, Type: TypeAttached}
+	c.applyDefaults()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queue(name) != nil {
+		return fmt.Errorf("sink %s is configured twice", name)
+	}
+	s.add(c, sink)
+	return nil
+}
+
+// Has reports whether the Set has a sink of the given name.
+func (s *Set) Has(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.queue(name) != nil
+}
+
+func (s *Set) queue(name string) *queue {
+	for _, q := range s.queues {
+		if q.config.Name == name {
+			return q
+		}
+	}
+	return nil
+}
+
+// Uses reports whether any sink is of the given type.
+func (s *Set) Uses(sinkType string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, q := range s.queues {
+		if q.config.Type == sinkType {
+			return true
+		}
+	}
+	return false
+}
+
+// Statuses reports every sink's backlog and delivery counters.
+func (s *Set) Statuses() []Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	statuses := make([]Status, 0, len(s.queues))
+	for _, q := range s.queues {
+		q.mu.Lock()
+		statuses = append(statuses, Status{
+			Name:        q.config.Name,
+			Type:        q.config.Type,
+			Backlog:     len(q.events),
+			Delivered:   q.delivered,
+			Dropped:     q.dropped,
+			LastError:   q.lastError,
+			LastErrorAt: q.lastErrorAt,
+		})
+		q.mu.Unlock()
+	}
+	return statuses
+}
+
+// Close stops accepting events and waits until ctx is done for the sinks to
+// drain their backlogs. Events still queued after that are saved to the
+// backlog file, if there is one, and dropped otherwise. The sinks are closed
+// either way.
+func (s *Set) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		for _, q := range s.queues {
+			close(q.events)
+		}
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	for _, q := range s.queues {
+		select {
+		case <-q.done:
+		case <-ctx.Done():
+			q.stop()
+			<-q.done
+			errs = append(errs, fmt.Errorf("sink %s: %w", q.config.Name, ctx.Err()))
+		}
+		q.stop()
+		if err := q.sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", q.config.Name, err))
+		}
+		if s.backlogFile == "" {
+			for _, p := range q.unsent {
+				logger.WarnContext(p.ctx, "Event dropped on shutdown", "sink", q.config.Name, "event", p.event.Name, "id", p.event.ID)
+				q.drop()
+			}
+		}
+	}
+	if s.backlogFile != "" {
+		if err := s.saveBacklog(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to save sinks backlog: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (q *queue) run() {
+	defer close(q.done)
+	for p := range q.events {
+		q.deliver(p)
+		sinkBacklog.WithLabelValues(q.config.Name).Set(float64(len(q.events)))
+	}
+}
+
+// deliver sends p until it succeeds, its attempts run out or the queue is
+// stopped, which sets it aside for Close.
+func (q *queue) deliver(p pending) {
+	log := logger.With("sink", q.config.Name, "event", p.event.Name, "id", p.event.ID)
+	backoff := time.Duration(q.config.Retry.Backoff)
+	for attempt := 1; ; attempt++ {
+		if q.stopping.Err() != nil {
+			q.unsent = append(q.unsent, p)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(p.ctx, time.Duration(q.config.Timeout))
+		stop := context.AfterFunc(q.stopping, cancel)
+		err := q.sink.Send(ctx, p.event)
+		stop()
+		cancel()
+		if err == nil {
+			q.mu.Lock()
+			q.delivered++
+			q.mu.Unlock()
+			sinkEvents.WithLabelValues(q.config.Name, "delivered").Inc()
+			log.DebugContext(p.ctx, "Event delivered", "attempt", attempt)
+			return
+		}
+
+		q.mu.Lock()
+		q.lastError = err.Error()
+		q.lastErrorAt = time.Now()
+		q.mu.Unlock()
+		sinkEvents.WithLabelValues(q.config.Name, "failed").Inc()
+		if q.config.Retry.Attempts > 0 && attempt >= q.config.Retry.Attempts {
+			log.ErrorContext(p.ctx, "Event dropped after its last attempt", "attempts", attempt, "err", err)
+			q.drop()
+			return
+		}
+		log.WarnContext(p.ctx, "Failed to deliver event, retrying", "attempt", attempt, "retry_in", backoff.String(), "err", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-q.stopping.Done():
+		}
+		backoff = min(2*backoff, time.Duration(q.config.Retry.MaxBackoff))
+	}
+}
+
+func (q *queue) drop() {
+	q.mu.Lock()
+	q.dropped++
+	q.mu.Unlock()
+	sinkEvents.WithLabelValues(q.config.Name, "dropped").Inc()
+}
@@ -0,0 +1,59 @@
+package sinks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries the signature of a webhook request,
+// "t=<unix time>,v1=<hex>", where v1 is the HMAC-SHA256 of
+// "<unix time>.<body>" keyed by the webhook's secret. Webhook sinks and
+// subscriptions sign alike. Signing the time lets receivers reject replays.
+const SignatureHeader = "X-Webhook-Signature"
+
+// Sign returns the signature header value for body sent at t.
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + mac(secret, timestamp, body)
+}
+
+// Verify checks a signature header value against body, rejecting
+// signatures made more than tolerance ago. Receivers written in Go can use
+// it as is; others reimplement these few lines.
+func Verify(secret, signature string, body []byte, tolerance time.Duration) error {
+	var timestamp, v1 string
+	for _, part := range strings.Split(signature, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			v1 = value
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || v1 == "" {
+		return errors.New("malformed signature")
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("signature is %s old", age.Round(time.Second))
+	}
+	if !hmac.Equal([]byte(v1), []byte(mac(secret, timestamp, body))) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+func mac(secret, timestamp string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,285 @@
+// Package sinks delivers the publisher's events to the systems consuming
+// them. Each configured sink has its own filter, backlog and retries, so a
+// slow or unreachable sink does not hold up the others.
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"shared/codec"
+	"shared/envelope"
+	"strings"
+	"time"
+)
+
+// Sink types, as named in the sinks config file.
+const (
+	TypeRabbitMQ  = "rabbitmq"
+	TypeKafkaREST = "kafka-rest"
+	TypeNATS      = "nats"
+	TypeWebhook   = "webhook"
+	TypeFile      = "file"
+
+	// TypeAttached is the type of sinks created outside the config file,
+	// which Attach adds.
+	TypeAttached = "attached"
+)
+
+// Formats a sink can send events in.
+const (
+	// FormatEnvelope sends the bare envelope, and is the default.
+	FormatEnvelope = "envelope"
+	// FormatCloudEvents sends structured-mode CloudEvents, the envelope
+	// being their data.
+	FormatCloudEvents = "cloudevents"
+	// FormatCloudEventsBinary sends the envelope with the CloudEvents
+	// attributes as message headers. Kafka REST proxy and file sinks have
+	// no headers to carry them.
+	FormatCloudEventsBinary = "cloudevents-binary"
+	// FormatProtobuf sends the envelope encoded as Protobuf; see package
+	// codec. Kafka REST proxy and file sinks only carry JSON.
+	FormatProtobuf = "protobuf"
+)
+
+// Event is one decoded contract event on its way to the sinks.
+type Event struct {
+	Name    string // event name, such as ProposalApproved
+	Address string // contract that emitted it
+	ID      string // envelope ID, the same on every retry
+	Body    []byte // JSON payload
+
+	// ContentType is the body's media type, application/json if empty.
+	ContentType string
+	// Attributes are the event's CloudEvents attributes. Sinks in the
+	// binary format send them as headers; others leave them unset.
+	Attributes map[string]string
+}
+
+// Sink delivers events to one destination. Send is retried by the Set until
+// it succeeds, so it should not retry itself.
+type Sink interface {
+	Send(ctx context.Context, e Event) error
+	Close() error
+}
+
+// Config describes one sink in the sinks config file.
+type Config struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Format string `json:"format,omitempty"`
+
+	Filter
+
+	Backlog int      `json:"backlog,omitempty"`
+	Timeout Duration `json:"timeout,omitempty"`
+	Retry   Retry    `json:"retry"`
+
+	// URL is the Kafka REST proxy, NATS server or webhook endpoint. Kafka
+	// sinks need a REST proxy in front of the brokers; NATS credentials go
+	// in the URL's user info.
+	URL     string            `json:"url,omitempty"`
+	Topic   string            `json:"topic,omitempty"`   // Kafka REST proxy
+	Subject string            `json:"subject,omitempty"` // NATS; {event} is replaced by the event name
+	Path    string            `json:"path,omitempty"`    // file
+	Headers map[string]string `json:"headers,omitempty"` // Kafka REST proxy and webhook requests
+	Secret  string            `json:"secret,omitempty"`  // webhook; signs each request, see Sign
+}
+
+// Filter selects events by name and by the address of the contract that
+// emitted them. Empty lists select every event.
+type Filter struct {
+	Events    []string `json:"events,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// Selects reports whether the filter lets e through.
+func (f Filter) Selects(e Event) bool {
+	return matches(f.Events, e.Name, false) && matches(f.Addresses, e.Address, true)
+}
+
+// Retry is a sink's retry policy. Attempts of 0 retries until the event is
+// delivered or the publisher stops.
+type Retry struct {
+	Attempts   int      `json:"attempts,omitempty"`
+	Backoff    Duration `json:"backoff,omitempty"`
+	MaxBackoff Duration `json:"maxBackoff,omitempty"`
+}
+
+// Duration is a time.Duration written as a string such as "1s" in JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(raw []byte) error {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5s\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Defaults applied to settings a sink leaves unset.
+const (
+	defaultBacklog    = 1000
+	defaultTimeout    = 10 * time.Second
+	defaultBackoff    = time.Second
+	defaultMaxBackoff = 30 * time.Second
+)
+
+func (c *Config) applyDefaults() {
+	if c.Backlog == 0 {
+		c.Backlog = defaultBacklog
+	}
+	if c.Timeout == 0 {
+		c.Timeout = Duration(defaultTimeout)
+	}
+	if c.Retry.Backoff == 0 {
+		c.Retry.Backoff = Duration(defaultBackoff)
+	}
+	if c.Retry.MaxBackoff == 0 {
+		c.Retry.MaxBackoff = Duration(defaultMaxBackoff)
+	}
+}
+
+func (c Config) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("sink name is required")
+	}
+	if c.Backlog < 0 || c.Retry.Attempts < 0 {
+		return fmt.Errorf("sink %s: backlog and retry attempts cannot be negative", c.Name)
+	}
+	switch c.Format {
+	case "", FormatEnvelope, FormatCloudEvents:
+	case FormatCloudEventsBinary, FormatProtobuf:
+		if c.Type == TypeKafkaREST || c.Type == TypeFile {
+			return fmt.Errorf("sink %s: %s sinks cannot send the %s format", c.Name, c.Type, c.Format)
+		}
+	default:
+		return fmt.Errorf("sink %s: unknown format %q", c.Name, c.Format)
+	}
+	if c.Type == "kafka" {
+		return fmt.Errorf("sink %s: Kafka is reached through a REST proxy, use type %s with the proxy's url", c.Name, TypeKafkaREST)
+	}
+	required := map[string][]string{
+		TypeKafkaREST: {"url", c.URL, "topic", c.Topic},
+		TypeNATS:      {"url", c.URL, "subject", c.Subject},
+		TypeWebhook:   {"url", c.URL, "secret", c.Secret},
+		TypeFile:      {"path", c.Path},
+	}
+	fields, ok := required[c.Type]
+	if !ok && c.Type != TypeRabbitMQ {
+		return fmt.Errorf("sink %s: unknown type %q", c.Name, c.Type)
+	}
+	for i := 0; i < len(fields); i += 2 {
+		if fields[i+1] == "" {
+			return fmt.Errorf("sink %s: %s is required for %s sinks", c.Name, fields[i], c.Type)
+		}
+	}
+	return nil
+}
+
+// matches reports whether value is in allowed, or allowed is empty.
+// Addresses are compared ignoring case, as checksums vary.
+func matches(allowed []string, value string, foldCase bool) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if a == value || foldCase && strings.EqualFold(a, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// encode returns e as the sink sends it, in the sink's format. Events
+// without CloudEvents attributes are sent as they are.
+func (c Config) encode(e Event) (Event, error) {
+	attributes := e.Attributes
+	e.Attributes = nil
+	if attributes == nil {
+		return e, nil
+	}
+	switch c.Format {
+	case FormatCloudEvents:
+		body, err := envelope.StructuredCloudEvent(attributes, e.Body)
+		if err != nil {
+			return e, err
+		}
+		e.Body, e.ContentType = body, envelope.ContentTypeCloudEvent
+	case FormatCloudEventsBinary:
+		e.Attributes = attributes
+		e.ContentType = attributes["datacontenttype"]
+	case FormatProtobuf:
+		var env envelope.Envelope
+		if err := json.Unmarshal(e.Body, &env); err != nil {
+			return e, err
+		}
+		body, contentType, err := codec.Marshal(codec.ContentTypeProtobuf, &env)
+		if err != nil {
+			return e, err
+		}
+		e.Body, e.ContentType = body, contentType
+	}
+	return e, nil
+}
+
+// contentType is e's content type.
+func (e Event) contentType() string {
+	if e.ContentType == "" {
+		return envelope.ContentTypeJSON
+	}
+	return e.ContentType
+}
+
+// cloudEventHeaders returns e's CloudEvents attributes as headers named
+// with prefix, as the binary format sends them. The datacontenttype goes in
+// the transport's content type instead.
+func (e Event) cloudEventHeaders(prefix string) map[string]string {
+	headers := make(map[string]string, len(e.Attributes))
+	for name, value := range e.Attributes {
+		if name != "datacontenttype" {
+			headers[prefix+name] = value
+		}
+	}
+	return headers
+}
+
+// Load reads the sinks config file, a JSON array of Config.
+func Load(path string) ([]Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sinks config: %w", err)
+	}
+	var configs []Config
+	if err := json.Unmarshal(raw, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse sinks config %s: %w", path, err)
+	}
+	return configs, nil
+}
+
+// open creates the sink described by c.
+func open(c Config) (Sink, error) {
+	switch c.Type {
+	case TypeRabbitMQ:
+		return newRabbitMQ(), nil
+	case TypeKafkaREST:
+		return newKafkaREST(c), nil
+	case TypeNATS:
+		return newNATS(c)
+	case TypeWebhook:
+		return newWebhook(c), nil
+	case TypeFile:
+		return newFile(c)
+	}
+	return nil, fmt.Errorf("sink %s: unknown type %q", c.Name, c.Type)
+}
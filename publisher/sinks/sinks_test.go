@@ -0,0 +1,448 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"shared/codec"
+	"shared/envelope"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a sink that fails its first fail sends.
+type recorder struct {
+	mu   sync.Mutex
+	fail int
+	sent []Event
+	// block, when set, holds every send until it is closed
+	block chan struct{}
+}
+
+func (r *recorder) Send(ctx context.Context, e Event) error {
+	if r.block != nil {
+		select {
+		case <-r.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail > 0 {
+		r.fail--
+		return errors.New("unavailable")
+	}
+	r.sent = append(r.sent, e)
+	return nil
+}
+
+func (r *recorder) Close() error { return nil }
+
+func (r *recorder) names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for _, e := range r.sent {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func newSet(t *testing.T, sinks map[*recorder]Config) *Set {
+	t.Helper()
+	s := &Set{}
+	for sink, c := range sinks {
+		c.applyDefaults()
+		c.Retry.Backoff = Duration(time.Millisecond)
+		if err := c.validate(); err != nil {
+			t.Fatal(err)
+		}
+		s.add(c, sink)
+	}
+	return s
+}
+
+func event(name, address string) envelope.Envelope {
+	return envelope.Envelope{
+		ID:              envelope.ID(1337, "0xabc", 2),
+		SchemaVersion:   envelope.SchemaVersion,
+		ChainID:         1337,
+		Contract:        "diamond",
+		Address:         address,
+		EventName:       name,
+		TransactionHash: "0xabc",
+		LogIndex:        2,
+	}
+}
+
+func TestSetFiltersAndRetriesPerSink(t *testing.T) {
+	all := &recorder{fail: 2}
+	proposals := &recorder{}
+	diamond := &recorder{}
+	s := newSet(t, map[*recorder]Config{
+		all:       {Name: "all", Type: TypeRabbitMQ},
+		proposals: {Name: "proposals", Type: TypeRabbitMQ, Filter: Filter{Events: []string{"ProposalApproved"}}},
+		diamond:   {Name: "diamond", Type: TypeRabbitMQ, Filter: Filter{Addresses: []string{"0xD1A"}}},
+	})
+
+	for _, e := range []envelope.Envelope{
+		event("ProposalApproved", "0xd1a"),
+		event("ApproverAdded", "0xd1a"),
+		event("ProposalApproved", "0xother"),
+	} {
+		if err := s.Publish(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for sink, want := range map[*recorder]string{
+		all:       "ProposalApproved ApproverAdded ProposalApproved",
+		proposals: "ProposalApproved ProposalApproved",
+		diamond:   "ProposalApproved ApproverAdded",
+	} {
+		if got := strings.Join(sink.names(), " "); got != want {
+			t.Errorf("sent %q, want %q", got, want)
+		}
+	}
+	if id := all.sent[0].ID; id != "1337:0xabc:2" {
+		t.Errorf("event ID = %q", id)
+	}
+
+	statuses := s.Statuses()
+	for _, status := range statuses {
+		if status.Name == "all" && (status.Delivered != 3 || status.LastError != "unavailable") {
+			t.Errorf("status = %+v", status)
+		}
+	}
+}
+
+func TestSetDropsWhatItCannotDeliver(t *testing.T) {
+	limited := &recorder{fail: 100}
+	blocked := &recorder{block: make(chan struct{})}
+	s := newSet(t, map[*recorder]Config{
+		limited: {Name: "limited", Type: TypeRabbitMQ, Retry: Retry{Attempts: 3}},
+		blocked: {Name: "blocked", Type: TypeRabbitMQ, Backlog: 1},
+	})
+
+	// The blocked sink holds one event in flight and one in its backlog,
+	// and holds the third back until the publisher gives up on it. The
+	// other sink still gets all three.
+	var errs []error
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		errs = append(errs, s.Publish(ctx, event("ProposalAdded", "0x1")))
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if errs[0] != nil || errs[1] != nil || !errors.Is(errs[2], context.DeadlineExceeded) || !strings.Contains(errs[2].Error(), "sink blocked") {
+		t.Fatalf("errors = %v", errs)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := s.Close(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close = %v, want the deadline", err)
+	}
+	want := map[string]uint64{"limited": 3, "blocked": 2}
+	for _, status := range s.Statuses() {
+		if status.Delivered != 0 || status.Dropped != want[status.Name] {
+			t.Errorf("status = %+v, want %d dropped", status, want[status.Name])
+		}
+	}
+	if err := s.Publish(context.Background(), event("ProposalAdded", "0x1")); err == nil {
+		t.Fatal("published after Close")
+	}
+}
+
+func TestSetSavesItsBacklogOnShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sinks-backlog.json")
+	blocked := &recorder{block: make(chan struct{})}
+	s := newSet(t, map[*recorder]Config{blocked: {Name: "blocked", Type: TypeRabbitMQ}})
+	if err := s.UseBacklogFile(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ProposalAdded", "ProposalApproved"} {
+		if err := s.Publish(context.Background(), event(name, "0x1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close = %v, want the deadline", err)
+	}
+	if status := s.Statuses()[0]; status.Dropped != 0 {
+		t.Fatalf("status = %+v, want nothing dropped", status)
+	}
+
+	// The next run delivers both events, in order, and removes the file
+	// once it drains
+	delivered := &recorder{}
+	s = newSet(t, map[*recorder]Config{delivered: {Name: "blocked", Type: TypeRabbitMQ}})
+	if err := s.UseBacklogFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if names := delivered.names(); len(names) != 2 || names[0] != "ProposalAdded" || names[1] != "ProposalApproved" {
+		t.Fatalf("delivered %v", names)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("backlog file left behind: %v", err)
+	}
+}
+
+func TestPublishToWaitsForTheNamedSink(t *testing.T) {
+	blocked := &recorder{block: make(chan struct{})}
+	other := &recorder{}
+	s := newSet(t, map[*recorder]Config{
+		blocked: {Name: "blocked", Type: TypeRabbitMQ, Backlog: 1, Filter: Filter{Events: []string{"ProposalAdded"}}},
+		other:   {Name: "other", Type: TypeRabbitMQ},
+	})
+
+	// One event in flight and one in the backlog; the third waits for room
+	for i := 0; i < 2; i++ {
+		if err := s.PublishTo(context.Background(), "blocked", event("ProposalAdded", "0x1")); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.PublishTo(ctx, "blocked", event("ProposalAdded", "0x1")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("PublishTo = %v, want the deadline", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.PublishTo(context.Background(), "blocked", event("ProposalAdded", "0x1")) }()
+	close(blocked.block)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Filters still apply, and other sinks are left alone
+	if err := s.PublishTo(context.Background(), "blocked", event("ApproverAdded", "0x1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PublishTo(context.Background(), "nope", event("ProposalAdded", "0x1")); !errors.Is(err, ErrUnknownSink) {
+		t.Fatalf("PublishTo = %v, want ErrUnknownSink", err)
+	}
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(blocked.names(), " "); got != "ProposalAdded ProposalAdded ProposalAdded" || len(other.sent) != 0 {
+		t.Fatalf("sent %q to the named sink, %d to the other", got, len(other.sent))
+	}
+	if !s.Has("other") || s.Has("nope") {
+		t.Fatal("Has does not match the configured sinks")
+	}
+}
+
+func TestAttachRejectsATakenName(t *testing.T) {
+	s := newSet(t, map[*recorder]Config{{}: {Name: "other", Type: TypeRabbitMQ}})
+	if err := s.Attach("other", &recorder{}); err == nil {
+		t.Fatal("attached a second sink named other")
+	}
+	if err := s.Attach("webhooks", &recorder{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewValidatesConfigs(t *testing.T) {
+	for _, configs := range [][]Config{
+		nil,
+		{{Type: TypeRabbitMQ}},
+		{{Name: "a", Type: "smoke-signals"}},
+		{{Name: "a", Type: TypeKafkaREST, URL: "http://proxy"}},
+		{{Name: "a", Type: "kafka", URL: "kafka:9092", Topic: "events"}},
+		{{Name: "a", Type: TypeRabbitMQ}, {Name: "a", Type: TypeRabbitMQ}},
+		{{Name: "a", Type: TypeWebhook, URL: "http://hook"}},
+		{{Name: "a", Type: TypeNATS, URL: "http://nats", Subject: "events"}},
+		{{Name: "a", Type: TypeRabbitMQ, Format: "xml"}},
+		{{Name: "a", Type: TypeFile, Path: "events.jsonl", Format: FormatCloudEventsBinary}},
+		{{Name: "a", Type: TypeKafkaREST, URL: "http://proxy", Topic: "events", Format: FormatProtobuf}},
+	} {
+		if s, err := New(configs); err == nil {
+			s.Close(context.Background())
+			t.Errorf("New(%+v) succeeded", configs)
+		}
+	}
+}
+
+func TestSetEncodesPerSinkFormat(t *testing.T) {
+	bare, structured, binary, protobuf := &recorder{}, &recorder{}, &recorder{}, &recorder{}
+	s := newSet(t, map[*recorder]Config{
+		bare:       {Name: "bare", Type: TypeRabbitMQ},
+		structured: {Name: "structured", Type: TypeRabbitMQ, Format: FormatCloudEvents},
+		binary:     {Name: "binary", Type: TypeRabbitMQ, Format: FormatCloudEventsBinary},
+		protobuf:   {Name: "protobuf", Type: TypeRabbitMQ, Format: FormatProtobuf},
+	})
+	env := event("ProposalApproved", "0xd1a")
+	if err := s.Publish(context.Background(), env); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if e := bare.sent[0]; e.contentType() != envelope.ContentTypeJSON || e.Attributes != nil {
+		t.Errorf("bare event %+v", e)
+	}
+	if decoded, err := envelope.Decode(bare.sent[0].Body); err != nil || decoded.ID != env.ID {
+		t.Errorf("bare body %s: %v", bare.sent[0].Body, err)
+	}
+
+	e := structured.sent[0]
+	var ce map[string]json.RawMessage
+	if err := json.Unmarshal(e.Body, &ce); err != nil || e.ContentType != envelope.ContentTypeCloudEvent || e.Attributes != nil {
+		t.Fatalf("structured event %+v: %v", e, err)
+	}
+	if string(ce["specversion"]) != `"1.0"` || string(ce["type"]) != `"ethereum.event.ProposalApproved"` || string(ce["source"]) != `"eip155:1337:0xd1a"` {
+		t.Errorf("structured event %s", e.Body)
+	}
+	if decoded, err := envelope.Decode(e.Body); err != nil || decoded.ID != env.ID {
+		t.Errorf("structured event data: %+v, %v", decoded, err)
+	}
+
+	e = binary.sent[0]
+	headers := e.cloudEventHeaders("ce-")
+	if e.ContentType != envelope.ContentTypeJSON || headers["ce-id"] != env.ID || headers["ce-subject"] != "diamond" {
+		t.Errorf("binary event %+v, headers %v", e, headers)
+	}
+	if _, ok := headers["ce-datacontenttype"]; ok {
+		t.Error("datacontenttype sent as a header")
+	}
+
+	e = protobuf.sent[0]
+	decoded, err := envelope.DecodeContent(e.ContentType, e.Body)
+	if !codec.IsProtobuf(e.ContentType) || err != nil || decoded.ID != env.ID || decoded.Contract != "diamond" {
+		t.Errorf("protobuf event %s: %+v, %v", e.ContentType, decoded, err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sinks.json")
+	os.WriteFile(path, []byte(`[{"name": "hook", "type": "webhook", "url": "http://hook", "secret": "s", "timeout": "2s", "retry": {"attempts": 4, "backoff": "250ms"}}]`), 0o644)
+
+	configs, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := configs[0]
+	if c.Timeout != Duration(2*time.Second) || c.Retry.Attempts != 4 || c.Retry.Backoff != Duration(250*time.Millisecond) {
+		t.Fatalf("config = %+v", c)
+	}
+
+	os.WriteFile(path, []byte(`[{"name": "hook", "timeout": 5}]`), 0o644)
+	if _, err := Load(path); err == nil {
+		t.Fatal("loaded a numeric duration")
+	}
+}
+
+func TestFileAppendsLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	for _, body := range []string{`{"n":1}`, `{"n":2}`} {
+		// Each run appends to what earlier runs wrote
+		sink, err := newFile(Config{Name: "audit", Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Send(context.Background(), Event{Body: []byte(body)}); err != nil {
+			t.Fatal(err)
+		}
+		sink.Close()
+	}
+	raw, _ := os.ReadFile(path)
+	if string(raw) != "{\"n\":1}\n{\"n\":2}\n" {
+		t.Fatalf("file = %q", raw)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	status := http.StatusOK
+	var got *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write([]byte("try later"))
+	}))
+	defer server.Close()
+
+	sink := newWebhook(Config{URL: server.URL, Secret: "s3cret", Headers: map[string]string{"Authorization": "Bearer t"}})
+	e := Event{Name: "ProposalApproved", ID: "1337:0xabc:2", Body: []byte(`{"eventName":"ProposalApproved"}`)}
+	if err := sink.Send(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != string(e.Body) || got.Header.Get("Authorization") != "Bearer t" ||
+		got.Header.Get("X-Event-Id") != "1337:0xabc:2" || got.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("request %v %s", got.Header, body)
+	}
+	if err := Verify("s3cret", got.Header.Get(SignatureHeader), body, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// In the binary format the attributes travel as ce- headers
+	e.Attributes = map[string]string{"specversion": "1.0", "id": e.ID, "datacontenttype": "application/json"}
+	if err := sink.Send(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	if got.Header.Get("Ce-Specversion") != "1.0" || got.Header.Get("Ce-Id") != e.ID || got.Header.Get("Ce-Datacontenttype") != "" {
+		t.Fatalf("binary request %v", got.Header)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := sink.Send(context.Background(), e); err == nil || !strings.Contains(err.Error(), "503 Service Unavailable: try later") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestKafkaRESTProxy(t *testing.T) {
+	reply := `{"offsets":[{"partition":0,"offset":7,"error_code":null,"error":null}]}`
+	var path, contentType string
+	var produced struct {
+		Records []struct {
+			Key   string          `json:"key"`
+			Value json.RawMessage `json:"value"`
+		} `json:"records"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&produced)
+		w.Write([]byte(reply))
+	}))
+	defer server.Close()
+
+	sink := newKafkaREST(Config{URL: server.URL + "/", Topic: "contract-events"})
+	e := Event{Address: "0xd1a", Body: []byte(`{"eventName":"ProposalApproved"}`)}
+	if err := sink.Send(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/topics/contract-events" || contentType != "application/vnd.kafka.json.v2+json" {
+		t.Fatalf("posted %s to %s", contentType, path)
+	}
+	if len(produced.Records) != 1 || produced.Records[0].Key != "0xd1a" || string(produced.Records[0].Value) != string(e.Body) {
+		t.Fatalf("records = %+v", produced.Records)
+	}
+
+	reply = `{"offsets":[{"partition":null,"offset":null,"error_code":40403,"error":"Topic not found."}]}`
+	if err := sink.Send(context.Background(), e); err == nil || !strings.Contains(err.Error(), "Topic not found.") {
+		t.Fatalf("err = %v", err)
+	}
+}
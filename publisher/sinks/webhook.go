@@ -0,0 +1,79 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// webhook POSTs each event's JSON payload to a URL, signed with its secret
+// as the webhook subscriptions are. Any status other than 2xx is a failure
+// and the event is retried.
+type webhook struct {
+	url     string
+	secret  string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newWebhook(c Config) *webhook {
+	return &webhook{url: c.URL, secret: c.Secret, headers: c.Headers, client: &http.Client{}}
+}
+
+func (w *webhook) Send(ctx context.Context, e Event) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(e.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", e.contentType())
+	req.Header.Set("X-Event-Id", e.ID)
+	req.Header.Set("X-Event-Name", e.Name)
+	req.Header.Set(SignatureHeader, Sign(w.secret, time.Now(), e.Body))
+	for key, value := range e.cloudEventHeaders("ce-") {
+		req.Header.Set(key, value)
+	}
+	for key, value := range w.headers {
+		req.Header.Set(key, value)
+	}
+	return post(w.client, req, nil)
+}
+
+func (w *webhook) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+// post sends req with the trace context of its own context, fails on any
+// status other than 2xx and decodes a JSON response into out unless nil.
+func post(client *http.Client, req *http.Request, out interface{}) error {
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		if len(body) > 512 {
+			body = body[:512]
+		}
+		return fmt.Errorf("%s responded %s: %s", req.URL.Host, resp.Status, bytes.TrimSpace(body))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse the response from %s: %w", req.URL.Host, err)
+	}
+	return nil
+}
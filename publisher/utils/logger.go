@@ -1,26 +0,0 @@
-package utils
-
-import (
-	"log"
-	"os"
-)
-
-type Logger struct {
-	infoLogger  *log.Logger
-	errorLogger *log.Logger
-}
-
-func NewLogger() *Logger {
-	return &Logger{
-		infoLogger:  log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile),
-		errorLogger: log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile),
-	}
-}
-
-func (l *Logger) Info(v ...interface{}) {
-	l.infoLogger.Println(v...)
-}
-
-func (l *Logger) Error(v ...interface{}) {
-	l.errorLogger.Println(v...)
-}
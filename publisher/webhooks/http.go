@@ -0,0 +1,95 @@
+package webhooks
+
+import (
+	"errors"
+	"shared/admin"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Routes exposes the subscriptions and their deliveries to requests sending
+// token as a bearer token. Without a token they are not served: a
+// subscription makes the publisher post to any URL it is given.
+func Routes(router fiber.Router, m *Manager, token string) {
+	routes, ok := admin.Group(router, "/admin/webhooks", token)
+	if !ok {
+		return
+	}
+
+	routes.Get("/", func(c *fiber.Ctx) error {
+		return c.JSON(m.Subscriptions())
+	})
+
+	routes.Post("/", func(c *fiber.Ctx) error {
+		var request Subscription
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+		sub, err := m.Subscribe(request)
+		if err != nil {
+			return respondError(c, err)
+		}
+		return c.Status(fiber.StatusCreated).JSON(sub)
+	})
+
+	routes.Get("/:id", func(c *fiber.Ctx) error {
+		sub, err := m.Subscription(c.Params("id"))
+		if err != nil {
+			return respondError(c, err)
+		}
+		return c.JSON(sub)
+	})
+
+	routes.Delete("/:id", func(c *fiber.Ctx) error {
+		if err := m.Unsubscribe(c.Params("id")); err != nil {
+			return respondError(c, err)
+		}
+		return c.JSON(fiber.Map{"message": "Webhook removed"})
+	})
+
+	routes.Post("/:id/enable", func(c *fiber.Ctx) error {
+		sub, err := m.Enable(c.Params("id"))
+		if err != nil {
+			return respondError(c, err)
+		}
+		return c.JSON(sub)
+	})
+
+	routes.Get("/:id/deliveries", func(c *fiber.Ctx) error {
+		deliveries, err := m.Deliveries(c.Params("id"), c.Query("status"))
+		if err != nil {
+			return respondError(c, err)
+		}
+		if deliveries == nil {
+			deliveries = []Delivery{}
+		}
+		return c.JSON(deliveries)
+	})
+
+	routes.Get("/:id/deliveries/:delivery", func(c *fiber.Ctx) error {
+		d, err := m.Delivery(c.Params("id"), c.Params("delivery"))
+		if err != nil {
+			return respondError(c, err)
+		}
+		return c.JSON(d)
+	})
+
+	routes.Post("/:id/deliveries/:delivery/redeliver", func(c *fiber.Ctx) error {
+		d, err := m.Redeliver(c.Params("id"), c.Params("delivery"))
+		if err != nil {
+			return respondError(c, err)
+		}
+		return c.Status(fiber.StatusAccepted).JSON(d)
+	})
+}
+
+func respondError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusBadRequest
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+}
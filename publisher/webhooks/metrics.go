@@ -0,0 +1,18 @@
+package webhooks
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	deliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_webhook_attempts_total",
+		Help: "Webhook delivery attempts, by outcome: delivered, retried or failed (the last attempt).",
+	}, []string{"outcome"})
+
+	disabled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "publisher_webhooks_disabled_total",
+		Help: "Webhook subscriptions disabled for failing persistently.",
+	})
+)
@@ -0,0 +1,141 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	subscriptionsBucket = []byte("subscriptions")
+	deliveriesBucket    = []byte("deliveries")
+)
+
+// store saves the subscriptions and deliveries in a bbolt database, one
+// record each, so that a change writes only what changed. It holds the
+// secrets, so it is only readable by the publisher's user. A nil store keeps
+// nothing.
+type store struct {
+	db *bolt.DB
+}
+
+func openStore(path string) (*store, error) {
+	if path == "" {
+		return nil, nil
+	}
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open webhooks: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{subscriptionsBucket, deliveriesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create webhooks buckets: %w", err)
+	}
+	return &store{db: db}, nil
+}
+
+func (s *store) close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// load reads every subscription, and the deliveries oldest first.
+func (s *store) load() ([]*Subscription, []*Delivery, error) {
+	if s == nil {
+		return nil, nil, nil
+	}
+	var subscriptions []*Subscription
+	var deliveries []*Delivery
+	err := s.db.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(subscriptionsBucket).ForEach(func(_, raw []byte) error {
+			var sub Subscription
+			if err := json.Unmarshal(raw, &sub); err != nil {
+				return err
+			}
+			subscriptions = append(subscriptions, &sub)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(deliveriesBucket).ForEach(func(_, raw []byte) error {
+			var d Delivery
+			if err := json.Unmarshal(raw, &d); err != nil {
+				return err
+			}
+			deliveries = append(deliveries, &d)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read webhooks: %w", err)
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool { return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt) })
+	return subscriptions, deliveries, nil
+}
+
+// change is one transaction's worth of records to write and delete.
+type change struct {
+	subscriptions []*Subscription
+	deliveries    []*Delivery
+	// removed are the IDs of deleted subscriptions, pruned the IDs of
+	// forgotten deliveries
+	removed []string
+	pruned  []string
+}
+
+// save writes a change in one transaction. Call it with the manager's lock
+// held, as the records are read while they are encoded.
+func (s *store) save(c change) error {
+	if s == nil {
+		return nil
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		subscriptions, deliveries := tx.Bucket(subscriptionsBucket), tx.Bucket(deliveriesBucket)
+		for _, sub := range c.subscriptions {
+			if err := put(subscriptions, sub.ID, sub); err != nil {
+				return err
+			}
+		}
+		for _, d := range c.deliveries {
+			if err := put(deliveries, d.ID, d); err != nil {
+				return err
+			}
+		}
+		for _, id := range c.removed {
+			if err := subscriptions.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		for _, id := range c.pruned {
+			if err := deliveries.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save webhooks: %w", err)
+	}
+	return nil
+}
+
+func put(b *bolt.Bucket, id string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(id), raw)
+}
@@ -0,0 +1,585 @@
+// Package webhooks delivers contract events to HTTP endpoints registered at
+// runtime through the admin API. Deliveries are signed with the
+// subscription's secret (see sinks.Sign), retried with exponential backoff and
+// recorded, and endpoints that keep failing are disabled until re-enabled.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"publisher/sinks"
+	"shared/logging"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var logger = logging.For("webhooks")
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+)
+
+// Subscription is an endpoint receiving the events its filter selects.
+type Subscription struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	sinks.Filter
+
+	// Secret signs the deliveries. It is only shown when the subscription
+	// is created.
+	Secret string `json:"secret,omitempty"`
+
+	Disabled            bool      `json:"disabled"`
+	DisabledReason      string    `json:"disabledReason,omitempty"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	CreatedAt           time.Time `json:"createdAt"`
+}
+
+// Delivery is one event sent, or being sent, to one subscription.
+type Delivery struct {
+	ID             string          `json:"id"`
+	Subscription   string          `json:"subscription"`
+	EventID        string          `json:"eventId"`
+	EventName      string          `json:"eventName"`
+	RedeliveryOf   string          `json:"redeliveryOf,omitempty"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"responseStatus,omitempty"`
+	LastError      string          `json:"lastError,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	LastAttemptAt  *time.Time      `json:"lastAttemptAt,omitempty"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"`
+	Body           json.RawMessage `json:"body"`
+}
+
+// Options tune delivery. Zero values take the defaults noted.
+type Options struct {
+	Attempts     int           // per delivery, 8
+	Backoff      time.Duration // before the second attempt, doubling after; 5s
+	MaxBackoff   time.Duration // 10m
+	Timeout      time.Duration // per attempt, 10s
+	DisableAfter int           // consecutive failed deliveries disabling an endpoint, 5
+	Retain       int           // finished deliveries kept, 1000
+	Concurrency  int           // attempts in flight, 8
+}
+
+func (o *Options) applyDefaults() {
+	defaults := Options{Attempts: 8, Backoff: 5 * time.Second, MaxBackoff: 10 * time.Minute, Timeout: 10 * time.Second, DisableAfter: 5, Retain: 1000, Concurrency: 8}
+	if o.Attempts == 0 {
+		o.Attempts = defaults.Attempts
+	}
+	if o.Backoff == 0 {
+		o.Backoff = defaults.Backoff
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = defaults.MaxBackoff
+	}
+	if o.Timeout == 0 {
+		o.Timeout = defaults.Timeout
+	}
+	if o.DisableAfter == 0 {
+		o.DisableAfter = defaults.DisableAfter
+	}
+	if o.Retain == 0 {
+		o.Retain = defaults.Retain
+	}
+	if o.Concurrency == 0 {
+		o.Concurrency = defaults.Concurrency
+	}
+}
+
+// Manager keeps the subscriptions and delivers events to them. It is a
+// sinks.Sink: Send records a delivery per matching subscription and returns,
+// and the deliveries are attempted in the background.
+type Manager struct {
+	opts   Options
+	store  *store
+	client *http.Client
+	slots  chan struct{}
+
+	// stopping cancels the attempts in flight when the manager closes
+	stopping context.Context
+	stop     context.CancelFunc
+	inflight sync.WaitGroup
+
+	mu            sync.Mutex
+	closed        bool
+	subscriptions map[string]*Subscription
+	deliveries    map[string]*Delivery
+	order         []*Delivery // oldest first
+	timers        map[string]*time.Timer
+}
+
+// New returns a manager saving its subscriptions and deliveries in the
+// database at path, and resumes the deliveries pending there. An empty path
+// keeps them in memory only.
+func New(path string, opts Options) (*Manager, error) {
+	opts.applyDefaults()
+	db, err := openStore(path)
+	if err != nil {
+		return nil, err
+	}
+	subscriptions, deliveries, err := db.load()
+	if err != nil {
+		db.close()
+		return nil, err
+	}
+	stopping, stop := context.WithCancel(context.Background())
+	m := &Manager{
+		opts:  opts,
+		store: db,
+		client: &http.Client{
+			// A redirect is a misconfigured endpoint, not a delivery
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		slots:         make(chan struct{}, opts.Concurrency),
+		stopping:      stopping,
+		stop:          stop,
+		subscriptions: make(map[string]*Subscription),
+		deliveries:    make(map[string]*Delivery),
+		timers:        make(map[string]*time.Timer),
+	}
+	for _, sub := range subscriptions {
+		m.subscriptions[sub.ID] = sub
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range deliveries {
+		if _, ok := m.subscriptions[d.Subscription]; !ok {
+			continue
+		}
+		m.deliveries[d.ID] = d
+		m.order = append(m.order, d)
+		if d.Status == StatusPending {
+			m.schedule(d)
+		}
+	}
+	return m, nil
+}
+
+// Subscribe registers an endpoint. A secret is generated unless s has one;
+// the returned subscription is the only place it is shown.
+func (m *Manager) Subscribe(s Subscription) (Subscription, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Subscription{}, fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if s.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return Subscription{}, err
+		}
+		s.Secret = hex.EncodeToString(secret)
+	}
+	sub := &Subscription{
+		ID:        uuid.NewString(),
+		URL:       s.URL,
+		Filter:    s.Filter,
+		Secret:    s.Secret,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.store.save(change{subscriptions: []*Subscription{sub}}); err != nil {
+		return Subscription{}, err
+	}
+	m.subscriptions[sub.ID] = sub
+	logger.Info("Webhook subscribed", "subscription", sub.ID, "url", sub.URL)
+	return *sub, nil
+}
+
+// Subscriptions lists the subscriptions, oldest first, without secrets.
+func (m *Manager) Subscriptions() []Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subs := make([]Subscription, 0, len(m.subscriptions))
+	for _, s := range m.subscriptions {
+		subs = append(subs, redacted(s))
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs
+}
+
+// Subscription returns a subscription without its secret.
+func (m *Manager) Subscription(id string) (Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.subscriptions[id]
+	if !ok {
+		return Subscription{}, fmt.Errorf("subscription %s: %w", id, ErrNotFound)
+	}
+	return redacted(s), nil
+}
+
+func redacted(s *Subscription) Subscription {
+	view := *s
+	view.Secret = ""
+	return view
+}
+
+// Unsubscribe removes a subscription and its deliveries, abandoning those
+// still pending.
+func (m *Manager) Unsubscribe(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.subscriptions[id]; !ok {
+		return fmt.Errorf("subscription %s: %w", id, ErrNotFound)
+	}
+	var removed []string
+	for _, d := range m.order {
+		if d.Subscription == id {
+			removed = append(removed, d.ID)
+		}
+	}
+	if err := m.store.save(change{removed: []string{id}, pruned: removed}); err != nil {
+		return err
+	}
+
+	delete(m.subscriptions, id)
+	kept := m.order[:0]
+	for _, d := range m.order {
+		if d.Subscription == id {
+			m.unschedule(d.ID)
+			delete(m.deliveries, d.ID)
+			continue
+		}
+		kept = append(kept, d)
+	}
+	clear(m.order[len(kept):])
+	m.order = kept
+	logger.Info("Webhook unsubscribed", "subscription", id)
+	return nil
+}
+
+// Enable re-enables a subscription that was disabled for failing.
+func (m *Manager) Enable(id string) (Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.subscriptions[id]
+	if !ok {
+		return Subscription{}, fmt.Errorf("subscription %s: %w", id, ErrNotFound)
+	}
+	enabled := *s
+	enabled.Disabled, enabled.DisabledReason, enabled.ConsecutiveFailures = false, "", 0
+	if err := m.store.save(change{subscriptions: []*Subscription{&enabled}}); err != nil {
+		return Subscription{}, err
+	}
+	*s = enabled
+	logger.Info("Webhook enabled", "subscription", id)
+	return redacted(s), nil
+}
+
+// Deliveries lists a subscription's deliveries, newest first, optionally
+// only those with the given status.
+func (m *Manager) Deliveries(subscription, status string) ([]Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.subscriptions[subscription]; !ok {
+		return nil, fmt.Errorf("subscription %s: %w", subscription, ErrNotFound)
+	}
+	var deliveries []Delivery
+	for i := len(m.order) - 1; i >= 0; i-- {
+		d := m.order[i]
+		if d.Subscription == subscription && (status == "" || d.Status == status) {
+			deliveries = append(deliveries, *d)
+		}
+	}
+	return deliveries, nil
+}
+
+// Delivery returns one of a subscription's deliveries.
+func (m *Manager) Delivery(subscription, id string) (Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.deliveries[id]
+	if !ok || d.Subscription != subscription {
+		return Delivery{}, fmt.Errorf("delivery %s: %w", id, ErrNotFound)
+	}
+	return *d, nil
+}
+
+// Redeliver sends a finished delivery's event again, as a new delivery with
+// attempts of its own.
+func (m *Manager) Redeliver(subscription, id string) (Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.deliveries[id]
+	if !ok || d.Subscription != subscription {
+		return Delivery{}, fmt.Errorf("delivery %s: %w", id, ErrNotFound)
+	}
+	s := m.subscriptions[subscription]
+	if s == nil {
+		return Delivery{}, fmt.Errorf("subscription %s: %w", subscription, ErrNotFound)
+	}
+	if s.Disabled {
+		return Delivery{}, fmt.Errorf("subscription %s is disabled, enable it first: %w", subscription, ErrConflict)
+	}
+	if d.Status == StatusPending {
+		return Delivery{}, fmt.Errorf("delivery %s is still pending: %w", id, ErrConflict)
+	}
+	redelivery := newDelivery(s, d.EventID, d.EventName, d.Body)
+	redelivery.RedeliveryOf = d.ID
+	if err := m.record(redelivery); err != nil {
+		return Delivery{}, err
+	}
+	return *redelivery, nil
+}
+
+// Send records a delivery of e for every enabled subscription selecting it.
+// It fails only if the deliveries cannot be saved, in which case none is
+// made, so that the sinks' retry does not send e twice.
+func (m *Manager) Send(_ context.Context, e sinks.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return fmt.Errorf("webhooks are closed")
+	}
+	var deliveries []*Delivery
+	for _, s := range m.subscriptions {
+		if !s.Disabled && s.Selects(e) {
+			deliveries = append(deliveries, newDelivery(s, e.ID, e.Name, e.Body))
+		}
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return m.record(deliveries...)
+}
+
+// newDelivery returns a pending delivery of an event to s.
+func newDelivery(s *Subscription, eventID, eventName string, body json.RawMessage) *Delivery {
+	now := time.Now().UTC()
+	return &Delivery{
+		ID:            uuid.NewString(),
+		Subscription:  s.ID,
+		EventID:       eventID,
+		EventName:     eventName,
+		Status:        StatusPending,
+		CreatedAt:     now,
+		NextAttemptAt: &now,
+		Body:          body,
+	}
+}
+
+// record saves new deliveries and schedules their first attempts. Nothing is
+// recorded if they cannot be saved.
+func (m *Manager) record(deliveries ...*Delivery) error {
+	if err := m.store.save(change{deliveries: deliveries}); err != nil {
+		return err
+	}
+	for _, d := range deliveries {
+		m.deliveries[d.ID] = d
+		m.order = append(m.order, d)
+		m.schedule(d)
+	}
+	m.persist(change{pruned: m.prune()})
+	return nil
+}
+
+// persist saves a change to deliveries already made, logging a failure. Such
+// a delivery goes ahead anyway: at worst it is attempted again, or not at
+// all, after a restart.
+func (m *Manager) persist(c change) {
+	if err := m.store.save(c); err != nil {
+		logger.Error("Failed to save webhooks", "err", err)
+	}
+}
+
+// Close stops delivering, abandoning the attempts in flight, which resume
+// from the saved deliveries on the next start.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	for id := range m.timers {
+		m.unschedule(id)
+	}
+	m.mu.Unlock()
+
+	m.stop()
+	m.inflight.Wait()
+	m.client.CloseIdleConnections()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.store.close()
+}
+
+func (m *Manager) schedule(d *Delivery) {
+	delay := time.Duration(0)
+	if d.NextAttemptAt != nil {
+		delay = max(time.Until(*d.NextAttemptAt), 0)
+	}
+	m.inflight.Add(1)
+	m.timers[d.ID] = time.AfterFunc(delay, func() {
+		defer m.inflight.Done()
+		m.attempt(d.ID)
+	})
+}
+
+func (m *Manager) unschedule(id string) {
+	if timer, ok := m.timers[id]; ok {
+		if timer.Stop() {
+			m.inflight.Done()
+		}
+		delete(m.timers, id)
+	}
+}
+
+// attempt makes one attempt of a pending delivery and schedules the next
+// one if it fails.
+func (m *Manager) attempt(id string) {
+	m.mu.Lock()
+	delete(m.timers, id)
+	d, s := m.deliveries[id], (*Subscription)(nil)
+	if d != nil {
+		s = m.subscriptions[d.Subscription]
+	}
+	if m.closed || d == nil || s == nil || d.Status != StatusPending {
+		m.mu.Unlock()
+		return
+	}
+	endpoint, secret, delivery := s.URL, s.Secret, *d
+	m.mu.Unlock()
+
+	select {
+	case m.slots <- struct{}{}:
+	case <-m.stopping.Done():
+		return
+	}
+	status, err := m.post(endpoint, secret, delivery)
+	<-m.slots
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Attempts cut short by shutdown do not count; the delivery resumes on
+	// the next start. Those of a subscription removed meanwhile are dropped.
+	if m.closed || d.Status != StatusPending || m.deliveries[id] != d {
+		return
+	}
+	now := time.Now().UTC()
+	d.Attempts++
+	d.LastAttemptAt = &now
+	d.ResponseStatus = status
+	log := logger.With("subscription", s.ID, "delivery", d.ID, "event", d.EventName, "attempt", d.Attempts)
+	changed := change{subscriptions: []*Subscription{s}, deliveries: []*Delivery{d}}
+
+	switch {
+	case err == nil:
+		d.Status, d.LastError, d.NextAttemptAt = StatusDelivered, "", nil
+		s.ConsecutiveFailures = 0
+		deliveries.WithLabelValues(StatusDelivered).Inc()
+		log.Debug("Webhook delivered")
+	case d.Attempts >= m.opts.Attempts:
+		d.Status, d.LastError, d.NextAttemptAt = StatusFailed, err.Error(), nil
+		s.ConsecutiveFailures++
+		deliveries.WithLabelValues(StatusFailed).Inc()
+		log.Error("Webhook delivery failed after its last attempt", "err", err)
+		if s.ConsecutiveFailures >= m.opts.DisableAfter {
+			abandoned := m.disable(s, fmt.Sprintf("%d consecutive deliveries failed, the last with: %s", s.ConsecutiveFailures, err))
+			changed.deliveries = append(changed.deliveries, abandoned...)
+		}
+	default:
+		backoff := min(m.opts.Backoff<<(d.Attempts-1), m.opts.MaxBackoff)
+		next := now.Add(backoff)
+		d.LastError, d.NextAttemptAt = err.Error(), &next
+		deliveries.WithLabelValues("retried").Inc()
+		log.Warn("Webhook delivery failed, retrying", "retry_in", backoff.String(), "err", err)
+		m.schedule(d)
+	}
+	changed.pruned = m.prune()
+	m.persist(changed)
+}
+
+// post sends one attempt and returns the response status, if any.
+func (m *Manager) post(endpoint, secret string, d Delivery) (int, error) {
+	ctx, cancel := context.WithTimeout(m.stopping, m.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(d.Body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "publisher-webhooks")
+	req.Header.Set("X-Webhook-Id", d.ID)
+	req.Header.Set("X-Event-Id", d.EventID)
+	req.Header.Set("X-Event-Name", d.EventName)
+	req.Header.Set(sinks.SignatureHeader, sinks.Sign(secret, time.Now(), d.Body))
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// disable stops deliveries to s until it is enabled again, and returns the
+// pending deliveries it failed.
+func (m *Manager) disable(s *Subscription, reason string) []*Delivery {
+	s.Disabled, s.DisabledReason = true, reason
+	var abandoned []*Delivery
+	for _, d := range m.order {
+		if d.Subscription == s.ID && d.Status == StatusPending {
+			m.unschedule(d.ID)
+			d.Status, d.LastError, d.NextAttemptAt = StatusFailed, "endpoint disabled", nil
+			abandoned = append(abandoned, d)
+		}
+	}
+	disabled.Inc()
+	logger.Warn("Webhook disabled", "subscription", s.ID, "url", s.URL, "reason", reason)
+	return abandoned
+}
+
+// prune forgets the oldest finished deliveries beyond the retention limit,
+// and returns their IDs.
+func (m *Manager) prune() []string {
+	finished := 0
+	for _, d := range m.order {
+		if d.Status != StatusPending {
+			finished++
+		}
+	}
+	excess := finished - m.opts.Retain
+	if excess <= 0 {
+		return nil
+	}
+	var pruned []string
+	kept := m.order[:0]
+	for _, d := range m.order {
+		if excess > 0 && d.Status != StatusPending {
+			delete(m.deliveries, d.ID)
+			pruned = append(pruned, d.ID)
+			excess--
+			continue
+		}
+		kept = append(kept, d)
+	}
+	clear(m.order[len(kept):])
+	m.order = kept
+	return pruned
+}
@@ -0,0 +1,301 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"publisher/sinks"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// receiver is a local endpoint answering with the statuses queued in
+// responses, then 200, and recording what it received.
+type receiver struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses []int
+	requests  []*http.Request
+	bodies    []string
+}
+
+func newReceiver(t *testing.T, responses ...int) *receiver {
+	t.Helper()
+	r := &receiver{responses: responses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, string(body))
+		status := http.StatusOK
+		if len(r.responses) > 0 {
+			status, r.responses = r.responses[0], r.responses[1:]
+		}
+		r.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) received() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func newManager(t *testing.T, path string, opts Options) *Manager {
+	t.Helper()
+	if opts.Backoff == 0 {
+		opts.Backoff = time.Millisecond
+	}
+	m, err := New(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func subscribe(t *testing.T, m *Manager, s Subscription) Subscription {
+	t.Helper()
+	sub, err := m.Subscribe(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sub
+}
+
+var approved = sinks.Event{
+	Name:    "ProposalApproved",
+	Address: "0xd1a",
+	ID:      "0xabc:2",
+	Body:    []byte(`{"eventName":"ProposalApproved","data":{"proposalId":"3"}}`),
+}
+
+// settle waits for a subscription's deliveries to finish.
+func settle(t *testing.T, m *Manager, subscription string, want int) []Delivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		deliveries, err := m.Deliveries(subscription, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pending := 0
+		for _, d := range deliveries {
+			if d.Status == StatusPending {
+				pending++
+			}
+		}
+		if len(deliveries) == want && pending == 0 {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deliveries = %+v", deliveries)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestDeliveriesAreSignedAndRetried(t *testing.T) {
+	r := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+	m := newManager(t, "", Options{})
+	sub := subscribe(t, m, Subscription{URL: r.URL, Filter: sinks.Filter{Events: []string{"ProposalApproved"}}})
+	if len(sub.Secret) != 64 {
+		t.Fatalf("generated secret %q", sub.Secret)
+	}
+
+	m.Send(context.Background(), approved)
+	m.Send(context.Background(), sinks.Event{Name: "ApproverAdded", Body: []byte(`{}`)})
+
+	d := settle(t, m, sub.ID, 1)[0]
+	if d.Status != StatusDelivered || d.Attempts != 3 || d.ResponseStatus != 200 || d.EventID != "0xabc:2" || d.LastError != "" {
+		t.Fatalf("delivery = %+v", d)
+	}
+	if r.received() != 3 {
+		t.Fatalf("received %d requests, want 3", r.received())
+	}
+
+	req, body := r.requests[2], r.bodies[2]
+	if body != string(approved.Body) || req.Header.Get("X-Webhook-Id") != d.ID || req.Header.Get("X-Event-Name") != "ProposalApproved" {
+		t.Fatalf("request %v %s", req.Header, body)
+	}
+	if err := sinks.Verify(sub.Secret, req.Header.Get(sinks.SignatureHeader), []byte(body), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := sinks.Verify("another secret", req.Header.Get(sinks.SignatureHeader), []byte(body), time.Minute); err == nil {
+		t.Fatal("verified with the wrong secret")
+	}
+	if listed, _ := m.Subscription(sub.ID); listed.Secret != "" {
+		t.Fatal("secret shown after creation")
+	}
+}
+
+func TestFailingEndpointsAreDisabled(t *testing.T) {
+	r := newReceiver(t, 500, 500, 500, 500, 500, 500)
+	m := newManager(t, "", Options{Attempts: 2, DisableAfter: 2, Concurrency: 1})
+	sub := subscribe(t, m, Subscription{URL: r.URL, Secret: "s"})
+
+	m.Send(context.Background(), approved)
+	settle(t, m, sub.ID, 1)
+	m.Send(context.Background(), approved)
+	deliveries := settle(t, m, sub.ID, 2)
+	for _, d := range deliveries {
+		if d.Status != StatusFailed || d.Attempts != 2 || d.ResponseStatus != 500 {
+			t.Fatalf("delivery = %+v", d)
+		}
+	}
+	s, _ := m.Subscription(sub.ID)
+	if !s.Disabled || !strings.Contains(s.DisabledReason, "2 consecutive deliveries failed") {
+		t.Fatalf("subscription = %+v", s)
+	}
+
+	// Disabled endpoints get nothing, and cannot be redelivered to
+	m.Send(context.Background(), approved)
+	if _, err := m.Redeliver(sub.ID, deliveries[0].ID); err == nil {
+		t.Fatal("redelivered to a disabled endpoint")
+	}
+	if n := len(settle(t, m, sub.ID, 2)); n != 2 || r.received() != 4 {
+		t.Fatalf("%d deliveries, %d requests after disabling", n, r.received())
+	}
+
+	// Once enabled, a redelivery goes through
+	if _, err := m.Enable(sub.ID); err != nil {
+		t.Fatal(err)
+	}
+	redelivery, err := m.Redeliver(sub.ID, deliveries[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := settle(t, m, sub.ID, 3)[0]
+	if d.ID != redelivery.ID || d.RedeliveryOf != deliveries[0].ID || d.Status != StatusFailed {
+		t.Fatalf("redelivery = %+v", d)
+	}
+}
+
+func TestDeliveriesSurviveRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.db")
+	down := newReceiver(t, 503)
+	m, err := New(path, Options{Backoff: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := subscribe(t, m, Subscription{URL: down.URL, Secret: "kept"})
+	m.Send(context.Background(), approved)
+	for down.received() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pending delivery resumes when its next attempt is due
+	m = newManager(t, path, Options{})
+	deliveries, _ := m.Deliveries(sub.ID, StatusPending)
+	if len(deliveries) != 1 || deliveries[0].Attempts != 1 || deliveries[0].NextAttemptAt == nil {
+		t.Fatalf("pending = %+v", deliveries)
+	}
+	if m.subscriptions[sub.ID].Secret != "kept" {
+		t.Fatal("secret not saved")
+	}
+}
+
+func TestSendRecordsNothingItCannotSave(t *testing.T) {
+	r := newReceiver(t)
+	m := newManager(t, filepath.Join(t.TempDir(), "webhooks.db"), Options{})
+	sub := subscribe(t, m, Subscription{URL: r.URL, Secret: "s"})
+
+	m.store.db.Close()
+	if err := m.Send(context.Background(), approved); err == nil {
+		t.Fatal("sent without saving the delivery")
+	}
+	if deliveries, _ := m.Deliveries(sub.ID, ""); len(deliveries) != 0 {
+		t.Fatalf("recorded %+v", deliveries)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if r.received() != 0 {
+		t.Fatalf("received %d requests", r.received())
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	r := newReceiver(t)
+	m := newManager(t, "", Options{})
+	app := fiber.New()
+	Routes(app, m, "token")
+
+	call := func(method, path, body string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer token")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(raw)
+	}
+
+	status, body := call("POST", "/admin/webhooks", `{"url":"ftp://nope"}`)
+	if status != fiber.StatusBadRequest {
+		t.Fatalf("got %d %s", status, body)
+	}
+	status, body = call("POST", "/admin/webhooks", `{"url":"`+r.URL+`","events":["ProposalApproved"],"secret":"s3cret","disabled":true}`)
+	var sub Subscription
+	json.Unmarshal([]byte(body), &sub)
+	if status != fiber.StatusCreated || sub.Secret != "s3cret" || sub.Disabled || sub.Events[0] != "ProposalApproved" {
+		t.Fatalf("got %d %s", status, body)
+	}
+	if status, body = call("GET", "/admin/webhooks", ""); strings.Contains(body, "s3cret") {
+		t.Fatalf("listed secret: %s", body)
+	}
+
+	m.Send(context.Background(), approved)
+	d := settle(t, m, sub.ID, 1)[0]
+
+	status, body = call("GET", "/admin/webhooks/"+sub.ID+"/deliveries?status=delivered", "")
+	if status != fiber.StatusOK || !strings.Contains(body, `"body":{"eventName":"ProposalApproved"`) {
+		t.Fatalf("got %d %s", status, body)
+	}
+	status, body = call("POST", "/admin/webhooks/"+sub.ID+"/deliveries/"+d.ID+"/redeliver", "")
+	if status != fiber.StatusAccepted || !strings.Contains(body, `"redeliveryOf":"`+d.ID+`"`) {
+		t.Fatalf("got %d %s", status, body)
+	}
+	settle(t, m, sub.ID, 2)
+	if r.received() != 2 {
+		t.Fatalf("received %d requests, want 2", r.received())
+	}
+
+	if status, _ = call("POST", "/admin/webhooks/"+sub.ID+"/deliveries/nope/redeliver", ""); status != fiber.StatusNotFound {
+		t.Fatalf("redeliver of an unknown delivery got %d", status)
+	}
+	if status, _ = call("DELETE", "/admin/webhooks/"+sub.ID, ""); status != fiber.StatusOK {
+		t.Fatalf("delete got %d", status)
+	}
+	if status, _ = call("GET", "/admin/webhooks/"+sub.ID, ""); status != fiber.StatusNotFound {
+		t.Fatalf("get after delete got %d", status)
+	}
+	if resp, _ := app.Test(httptest.NewRequest("GET", "/admin/webhooks", nil)); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("GET without a token got %d", resp.StatusCode)
+	}
+
+	// Without a configured token the routes are not served at all
+	open := fiber.New()
+	Routes(open, m, "")
+	req := httptest.NewRequest("POST", "/admin/webhooks", strings.NewReader(`{"url":"`+r.URL+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if resp, _ := open.Test(req); resp.StatusCode != fiber.StatusNotFound {
+		t.Fatalf("POST without a configured token got %d", resp.StatusCode)
+	}
+}
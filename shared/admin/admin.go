@@ -0,0 +1,35 @@
+// Package admin guards the routes that change a service at runtime, such as
+// its watch list. They require a bearer token, and are not served at all
+// when no token is configured, since they would then be open to anyone.
+package admin
+
+import (
+	"crypto/subtle"
+	"shared/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var logger = logging.For("admin")
+
+// Group returns the router for the admin routes under prefix, each of which
+// requires token as a bearer token. Without a token it logs that the routes
+// are disabled and reports false; the caller must not register them.
+func Group(router fiber.Router, prefix, token string) (fiber.Router, bool) {
+	if token == "" {
+		logger.Warn("Admin routes disabled, set an admin token to enable them", "prefix", prefix)
+		return nil, false
+	}
+	return router.Group(prefix, RequireToken(token)), true
+}
+
+// RequireToken rejects requests that do not send token as a bearer token.
+// An empty token rejects every request.
+func RequireToken(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if token == "" || subtle.ConstantTimeCompare([]byte(c.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+		return c.Next()
+	}
+}
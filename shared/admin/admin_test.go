@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAdminRoutesNeedAToken(t *testing.T) {
+	app := fiber.New()
+	if _, ok := Group(app, "/admin/open", ""); ok {
+		t.Fatal("admin routes registered without a token")
+	}
+	group, ok := Group(app, "/admin/things", "secret")
+	if !ok {
+		t.Fatal("admin routes not registered with a token")
+	}
+	group.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	app.Get("/unguarded", RequireToken(""), func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	for _, test := range []struct {
+		path, authorization string
+		want                int
+	}{
+		{"/admin/things", "Bearer secret", fiber.StatusOK},
+		{"/admin/things", "Bearer wrong", fiber.StatusUnauthorized},
+		{"/admin/things", "", fiber.StatusUnauthorized},
+		{"/unguarded", "Bearer ", fiber.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", test.path, nil)
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.want {
+			t.Errorf("GET %s with %q: %d, want %d", test.path, test.authorization, resp.StatusCode, test.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Package broker is the part of RabbitMQ the services program against:
+// declaring queues, publishing to them and consuming them, with request and
+// reply on top. AMQP adapts a real channel; Memory is an in-process broker
+// for tests.
+//
+// Messages stay streadway/amqp types. Deliveries are settled with their
+// Ack, Nack and Reject methods whichever broker they came from.
+package broker
+
+import (
+	"strings"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Broker is one channel to a broker. Messages are published through the
+// default exchange, so the routing key is the queue name.
+type Broker interface {
+	// Declare declares q and returns its name, chosen by the broker when
+	// q.Name is empty. Redeclaring a queue with other options fails.
+	Declare(q Queue) (string, error)
+	// Qos limits the unacknowledged deliveries of each consumer started
+	// afterwards; 0 means no limit.
+	Qos(prefetch int) error
+	// Publish sends msg to the named queue. Messages to queues that do not
+	// exist are dropped.
+	Publish(queue string, msg amqp.Publishing) error
+	// Consume delivers the queue's messages until the consumer is cancelled
+	// or the channel closed. The broker chooses the tag when tag is empty.
+	Consume(queue, tag string, autoAck bool) (<-chan amqp.Delivery, error)
+	// Cancel stops the consumer. Deliveries already sent to it are still
+	// received before its channel closes.
+	Cancel(tag string) error
+	// Close cancels the channel's consumers and requeues its unacknowledged
+	// deliveries.
+	Close() error
+}
+
+// Queue describes a queue to declare.
+type Queue struct {
+	Name       string
+	Durable    bool
+	AutoDelete bool // deleted once its last consumer is cancelled
+	Exclusive  bool // used by the declaring channel only, deleted with it
+
+	// MessageTTL expires messages left in the queue for longer, if set.
+	MessageTTL time.Duration
+	// DeadLetter receives the messages rejected without requeueing or
+	// expired, if set.
+	DeadLetter string
+
+	// Passive only checks that the queue exists, whatever its options.
+	// RabbitMQ closes the channel when it does not.
+	Passive bool
+}
+
+// The queues the services share, declared from one definition so both ends
+// of a queue agree on its options.
+var (
+	EventsQueue   = Queue{Name: "events_queue", Durable: true, DeadLetter: "events_dead_letters"}
+	ApprovalQueue = Queue{Name: "approval_queue"}
+	DepositQueue  = Queue{Name: "deposit_queue"}
+
+	// EventsDeadLetters keeps the events the subscriber gave up on, to be
+	// inspected and moved back to the events queue once the cause is fixed.
+	EventsDeadLetters = Queue{Name: "events_dead_letters", Durable: true}
+)
+
+// Internal reports whether name is one of the queues the services share, or
+// one of the names RabbitMQ reserves, such as those of reply queues. Only
+// the services themselves should publish to these.
+func Internal(name string) bool {
+	switch name {
+	case EventsQueue.Name, EventsDeadLetters.Name, ApprovalQueue.Name, DepositQueue.Name:
+		return true
+	}
+	return strings.HasPrefix(name, "amq.")
+}
+
+// args returns the queue's options that AMQP passes as arguments.
+func (q Queue) args() amqp.Table {
+	if q.MessageTTL == 0 && q.DeadLetter == "" {
+		return nil
+	}
+	args := amqp.Table{}
+	if q.MessageTTL > 0 {
+		args["x-message-ttl"] = int32(q.MessageTTL / time.Millisecond)
+	}
+	if q.DeadLetter != "" {
+		args["x-dead-letter-exchange"] = ""
+		args["x-dead-letter-routing-key"] = q.DeadLetter
+	}
+	return args
+}
+
+type amqpChannel struct {
+	ch *amqp.Channel
+}
+
+// AMQP adapts a channel to a RabbitMQ connection.
+func AMQP(ch *amqp.Channel) Broker {
+	return amqpChannel{ch: ch}
+}
+
+func (c amqpChannel) Declare(q Queue) (string, error) {
+	if q.Passive {
+		queue, err := c.ch.QueueDeclarePassive(q.Name, q.Durable, q.AutoDelete, q.Exclusive, false, q.args())
+		return queue.Name, err
+	}
+	queue, err := c.ch.QueueDeclare(q.Name, q.Durable, q.AutoDelete, q.Exclusive, false, q.args())
+	return queue.Name, err
+}
+
+func (c amqpChannel) Qos(prefetch int) error {
+	return c.ch.Qos(prefetch, 0, false)
+}
+
+func (c amqpChannel) Publish(queue string, msg amqp.Publishing) error {
+	return c.ch.Publish("", queue, false, false, msg)
+}
+
+func (c amqpChannel) Consume(queue, tag string, autoAck bool) (<-chan amqp.Delivery, error) {
+	return c.ch.Consume(queue, tag, autoAck, false, false, false, nil)
+}
+
+func (c amqpChannel) Cancel(tag string) error {
+	return c.ch.Cancel(tag, false)
+}
+
+func (c amqpChannel) Close() error {
+	return c.ch.Close()
+}
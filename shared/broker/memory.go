@@ -0,0 +1,475 @@
+package broker
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Memory is an in-process broker for tests. It keeps the RabbitMQ semantics
+// the services rely on: round-robin delivery to a queue's consumers,
+// prefetch limits, redelivery of requeued and unacknowledged messages with
+// the redelivered flag set, message TTLs, dead-lettering with x-death
+// headers, exclusive and auto-delete queues, and correlation IDs and
+// reply-to passed through untouched.
+type Memory struct {
+	mu     sync.Mutex
+	queues map[string]*memQueue
+	names  int
+}
+
+// NewMemory returns an empty broker.
+func NewMemory() *Memory {
+	return &Memory{queues: make(map[string]*memQueue)}
+}
+
+// Channel opens a channel to the broker. Like the channels of one RabbitMQ
+// connection, all of them see the same queues.
+func (m *Memory) Channel() *MemoryChannel {
+	return &MemoryChannel{
+		m:         m,
+		consumers: make(map[string]*memConsumer),
+		unacked:   make(map[uint64]*inflight),
+	}
+}
+
+// Len returns the number of messages ready in the queue, not yet delivered
+// to a consumer.
+func (m *Memory) Len(queue string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q, ok := m.queues[queue]
+	if !ok {
+		return 0
+	}
+	m.dispatch(q)
+	return len(q.ready)
+}
+
+type memQueue struct {
+	Queue
+	owner     *MemoryChannel
+	ready     []memMessage
+	consumers []*memConsumer
+	next      int
+}
+
+type memMessage struct {
+	msg         amqp.Publishing
+	redelivered bool
+	expires     time.Time
+}
+
+// enqueue appends msg to the named queue, dropping it if there is none.
+func (m *Memory) enqueue(name string, msg amqp.Publishing) {
+	q, ok := m.queues[name]
+	if !ok {
+		return
+	}
+	queued := memMessage{msg: msg}
+	if q.MessageTTL > 0 {
+		queued.expires = time.Now().Add(q.MessageTTL)
+		time.AfterFunc(q.MessageTTL, func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.dispatch(q)
+		})
+	}
+	q.ready = append(q.ready, queued)
+	m.dispatch(q)
+}
+
+// requeue puts msg back at the head of its queue, if the queue still exists.
+func (m *Memory) requeue(q *memQueue, msg memMessage) {
+	if m.queues[q.Name] != q {
+		return
+	}
+	msg.redelivered = true
+	q.ready = append([]memMessage{msg}, q.ready...)
+}
+
+// dispatch expires the messages at the head of q and hands the rest to its
+// consumers while they have room.
+func (m *Memory) dispatch(q *memQueue) {
+	now := time.Now()
+	for len(q.ready) > 0 {
+		msg := q.ready[0]
+		if !msg.expires.IsZero() && !now.Before(msg.expires) {
+			q.ready = q.ready[1:]
+			m.deadLetter(q, msg, "expired")
+			continue
+		}
+		consumer := q.nextConsumer()
+		if consumer == nil {
+			return
+		}
+		q.ready = q.ready[1:]
+		consumer.deliver(msg)
+	}
+}
+
+// deadLetter routes a rejected or expired message to the queue's dead letter
+// queue, recording why in its x-death header as RabbitMQ does.
+func (m *Memory) deadLetter(q *memQueue, msg memMessage, reason string) {
+	if q.DeadLetter == "" {
+		return
+	}
+	headers := amqp.Table{}
+	for k, v := range msg.msg.Headers {
+		headers[k] = v
+	}
+	death := amqp.Table{"queue": q.Name, "reason": reason, "count": int64(1)}
+	deaths := []interface{}{death}
+	previous, _ := headers["x-death"].([]interface{})
+	for _, d := range previous {
+		if d, ok := d.(amqp.Table); ok && d["queue"] == q.Name && d["reason"] == reason {
+			death["count"] = d["count"].(int64) + 1
+			continue
+		}
+		deaths = append(deaths, d)
+	}
+	headers["x-death"] = deaths
+	if _, ok := headers["x-first-death-queue"]; !ok {
+		headers["x-first-death-queue"] = q.Name
+		headers["x-first-death-reason"] = reason
+	}
+	msg.msg.Headers = headers
+	m.enqueue(q.DeadLetter, msg.msg)
+}
+
+func (m *Memory) delete(q *memQueue) {
+	if m.queues[q.Name] == q {
+		delete(m.queues, q.Name)
+	}
+}
+
+// nextConsumer picks the next consumer, in turn, that is below its prefetch
+// limit.
+func (q *memQueue) nextConsumer() *memConsumer {
+	for i := range q.consumers {
+		c := q.consumers[(q.next+i)%len(q.consumers)]
+		if c.autoAck || c.prefetch == 0 || c.unacked < c.prefetch {
+			q.next = (q.next + i + 1) % len(q.consumers)
+			return c
+		}
+	}
+	return nil
+}
+
+// MemoryChannel is a channel to a Memory broker. It implements Broker, and
+// settles the deliveries it hands out.
+type MemoryChannel struct {
+	m         *Memory
+	closed    bool
+	prefetch  int
+	nextTag   uint64
+	tags      int
+	consumers map[string]*memConsumer
+	unacked   map[uint64]*inflight
+}
+
+var (
+	_ Broker            = (*MemoryChannel)(nil)
+	_ amqp.Acknowledger = (*MemoryChannel)(nil)
+)
+
+// inflight is a delivery awaiting acknowledgement.
+type inflight struct {
+	msg      memMessage
+	queue    *memQueue
+	consumer *memConsumer
+}
+
+func (c *MemoryChannel) Declare(q Queue) (string, error) {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	if c.closed {
+		return "", amqp.ErrClosed
+	}
+	if q.Name == "" {
+		c.m.names++
+		q.Name = fmt.Sprintf("amq.gen-%d", c.m.names)
+	}
+	existing, ok := c.m.queues[q.Name]
+	if q.Passive {
+		if !ok {
+			return "", fmt.Errorf("queue %s does not exist", q.Name)
+		}
+		return q.Name, nil
+	}
+	if ok {
+		if existing.owner != nil && existing.owner != c {
+			return "", fmt.Errorf("queue %s is exclusive to another channel", q.Name)
+		}
+		if existing.Queue != q {
+			return "", fmt.Errorf("queue %s is already declared with other options", q.Name)
+		}
+		return q.Name, nil
+	}
+	queue := &memQueue{Queue: q}
+	if q.Exclusive {
+		queue.owner = c
+	}
+	c.m.queues[q.Name] = queue
+	return q.Name, nil
+}
+
+func (c *MemoryChannel) Qos(prefetch int) error {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+	c.prefetch = prefetch
+	return nil
+}
+
+func (c *MemoryChannel) Publish(queue string, msg amqp.Publishing) error {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+	c.m.enqueue(queue, msg)
+	return nil
+}
+
+func (c *MemoryChannel) Consume(queue, tag string, autoAck bool) (<-chan amqp.Delivery, error) {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	if c.closed {
+		return nil, amqp.ErrClosed
+	}
+	q, ok := c.m.queues[queue]
+	if !ok {
+		return nil, fmt.Errorf("no queue %s", queue)
+	}
+	if q.owner != nil && q.owner != c {
+		return nil, fmt.Errorf("queue %s is exclusive to another channel", queue)
+	}
+	if tag == "" {
+		c.tags++
+		tag = fmt.Sprintf("ctag-%d", c.tags)
+	}
+	if _, ok := c.consumers[tag]; ok {
+		return nil, fmt.Errorf("consumer tag %s is already in use", tag)
+	}
+
+	consumer := &memConsumer{
+		tag:      tag,
+		queue:    q,
+		channel:  c,
+		autoAck:  autoAck,
+		prefetch: c.prefetch,
+		wake:     make(chan struct{}, 1),
+		out:      make(chan amqp.Delivery),
+	}
+	c.consumers[tag] = consumer
+	q.consumers = append(q.consumers, consumer)
+	go consumer.run(&c.m.mu)
+	c.m.dispatch(q)
+	return consumer.out, nil
+}
+
+func (c *MemoryChannel) Cancel(tag string) error {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+	consumer, ok := c.consumers[tag]
+	if !ok {
+		return fmt.Errorf("no consumer %s", tag)
+	}
+	c.cancel(consumer)
+	return nil
+}
+
+// cancel stops delivering to the consumer and deletes its queue if it was
+// the auto-delete queue's last consumer. Its unacknowledged deliveries can
+// still be settled.
+func (c *MemoryChannel) cancel(consumer *memConsumer) {
+	delete(c.consumers, consumer.tag)
+	consumer.cancelled = true
+	consumer.signal()
+
+	q := consumer.queue
+	for i, other := range q.consumers {
+		if other == consumer {
+			q.consumers = append(q.consumers[:i], q.consumers[i+1:]...)
+			break
+		}
+	}
+	q.next = 0
+	if q.AutoDelete && len(q.consumers) == 0 {
+		c.m.delete(q)
+	}
+}
+
+func (c *MemoryChannel) Close() error {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+	for _, consumer := range c.consumers {
+		c.cancel(consumer)
+	}
+	touched := c.settle(c.pendingTags(^uint64(0)), func(f *inflight) { c.m.requeue(f.queue, f.msg) })
+	for _, q := range c.m.queues {
+		if q.owner == c {
+			c.m.delete(q)
+		}
+	}
+	c.closed = true
+	for q := range touched {
+		c.m.dispatch(q)
+	}
+	return nil
+}
+
+// Ack acknowledges the delivery with tag, and with multiple every earlier
+// one too.
+func (c *MemoryChannel) Ack(tag uint64, multiple bool) error {
+	return c.settleTags(tag, multiple, func(*inflight) {})
+}
+
+// Nack returns the delivery with tag, and with multiple every earlier one
+// too, to its queue or, without requeue, dead-letters it.
+func (c *MemoryChannel) Nack(tag uint64, multiple bool, requeue bool) error {
+	return c.settleTags(tag, multiple, func(f *inflight) {
+		if requeue {
+			c.m.requeue(f.queue, f.msg)
+		} else {
+			c.m.deadLetter(f.queue, f.msg, "rejected")
+		}
+	})
+}
+
+// Reject is Nack of a single delivery.
+func (c *MemoryChannel) Reject(tag uint64, requeue bool) error {
+	return c.Nack(tag, false, requeue)
+}
+
+func (c *MemoryChannel) settleTags(tag uint64, multiple bool, outcome func(*inflight)) error {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+	tags := []uint64{tag}
+	if multiple {
+		tags = c.pendingTags(tag)
+	} else if _, ok := c.unacked[tag]; !ok {
+		return fmt.Errorf("unknown delivery tag %d", tag)
+	}
+	for q := range c.settle(tags, outcome) {
+		c.m.dispatch(q)
+	}
+	return nil
+}
+
+// pendingTags returns the tags of the unacknowledged deliveries up to max,
+// newest first, so requeueing them in turn restores their order.
+func (c *MemoryChannel) pendingTags(max uint64) []uint64 {
+	var tags []uint64
+	for tag := range c.unacked {
+		if tag <= max {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] > tags[j] })
+	return tags
+}
+
+// settle applies outcome to the deliveries and returns the queues that may
+// now deliver more.
+func (c *MemoryChannel) settle(tags []uint64, outcome func(*inflight)) map[*memQueue]bool {
+	touched := make(map[*memQueue]bool)
+	for _, tag := range tags {
+		f := c.unacked[tag]
+		delete(c.unacked, tag)
+		f.consumer.unacked--
+		outcome(f)
+		touched[f.queue] = true
+	}
+	return touched
+}
+
+type memConsumer struct {
+	tag       string
+	queue     *memQueue
+	channel   *MemoryChannel
+	autoAck   bool
+	prefetch  int
+	unacked   int
+	cancelled bool
+
+	// pending holds the deliveries not yet received from out
+	pending []amqp.Delivery
+	wake    chan struct{}
+	out     chan amqp.Delivery
+}
+
+func (mc *memConsumer) deliver(msg memMessage) {
+	c := mc.channel
+	c.nextTag++
+	if !mc.autoAck {
+		c.unacked[c.nextTag] = &inflight{msg: msg, queue: mc.queue, consumer: mc}
+		mc.unacked++
+	}
+	mc.pending = append(mc.pending, amqp.Delivery{
+		Acknowledger:    c,
+		Headers:         msg.msg.Headers,
+		ContentType:     msg.msg.ContentType,
+		ContentEncoding: msg.msg.ContentEncoding,
+		DeliveryMode:    msg.msg.DeliveryMode,
+		Priority:        msg.msg.Priority,
+		CorrelationId:   msg.msg.CorrelationId,
+		ReplyTo:         msg.msg.ReplyTo,
+		Expiration:      msg.msg.Expiration,
+		MessageId:       msg.msg.MessageId,
+		Timestamp:       msg.msg.Timestamp,
+		Type:            msg.msg.Type,
+		UserId:          msg.msg.UserId,
+		AppId:           msg.msg.AppId,
+		ConsumerTag:     mc.tag,
+		DeliveryTag:     c.nextTag,
+		Redelivered:     msg.redelivered,
+		RoutingKey:      mc.queue.Name,
+		Body:            msg.msg.Body,
+	})
+	mc.signal()
+}
+
+func (mc *memConsumer) signal() {
+	select {
+	case mc.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run passes the pending deliveries to out, and closes it once the consumer
+// is cancelled and they have all been received.
+func (mc *memConsumer) run(mu *sync.Mutex) {
+	defer close(mc.out)
+	for {
+		mu.Lock()
+		if len(mc.pending) == 0 {
+			cancelled := mc.cancelled
+			mu.Unlock()
+			if cancelled {
+				return
+			}
+			<-mc.wake
+			continue
+		}
+		d := mc.pending[0]
+		mc.pending = mc.pending[1:]
+		mu.Unlock()
+		mc.out <- d
+	}
+}
@@ -0,0 +1,276 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func receive(t *testing.T, deliveries <-chan amqp.Delivery) amqp.Delivery {
+	t.Helper()
+	select {
+	case d, ok := <-deliveries:
+		if !ok {
+			t.Fatal("deliveries closed")
+		}
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("no delivery")
+	}
+	return amqp.Delivery{}
+}
+
+func nothing(t *testing.T, deliveries <-chan amqp.Delivery) {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		t.Fatalf("unexpected delivery %q", d.Body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func declare(t *testing.T, b Broker, q Queue) {
+	t.Helper()
+	if _, err := b.Declare(q); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func consume(t *testing.T, b Broker, queue string, autoAck bool) <-chan amqp.Delivery {
+	t.Helper()
+	deliveries, err := b.Consume(queue, "", autoAck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deliveries
+}
+
+func publish(t *testing.T, b Broker, queue, body string) {
+	t.Helper()
+	if err := b.Publish(queue, amqp.Publishing{Body: []byte(body)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequeuedMessagesAreRedelivered(t *testing.T) {
+	m := NewMemory()
+	ch := m.Channel()
+	declare(t, ch, Queue{Name: "work"})
+	publish(t, ch, "work", "first")
+	publish(t, ch, "work", "second")
+	deliveries := consume(t, ch, "work", false)
+
+	d := receive(t, deliveries)
+	if string(d.Body) != "first" || d.Redelivered {
+		t.Fatalf("got %q, redelivered %v", d.Body, d.Redelivered)
+	}
+	if err := d.Nack(false, true); err != nil {
+		t.Fatal(err)
+	}
+	// The second message was delivered before the first was requeued
+	if d := receive(t, deliveries); string(d.Body) != "second" {
+		t.Fatalf("got %q, want second", d.Body)
+	}
+	d = receive(t, deliveries)
+	if string(d.Body) != "first" || !d.Redelivered {
+		t.Fatalf("got %q, redelivered %v; want first redelivered", d.Body, d.Redelivered)
+	}
+	if err := d.Ack(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Ack(false); err == nil {
+		t.Fatal("acknowledged a delivery twice")
+	}
+}
+
+func TestClosingAChannelRequeuesUnacknowledged(t *testing.T) {
+	m := NewMemory()
+	worker := m.Channel()
+	declare(t, worker, Queue{Name: "work"})
+	publish(t, worker, "work", "job")
+	receive(t, consume(t, worker, "work", false))
+
+	if err := worker.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.Len("work"); n != 1 {
+		t.Fatalf("%d messages ready after close, want 1", n)
+	}
+	d := receive(t, consume(t, m.Channel(), "work", false))
+	if !d.Redelivered {
+		t.Fatal("requeued message not marked redelivered")
+	}
+}
+
+func TestPrefetchLimitsUnacknowledged(t *testing.T) {
+	m := NewMemory()
+	ch := m.Channel()
+	declare(t, ch, Queue{Name: "work"})
+	if err := ch.Qos(1); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, ch, "work", "first")
+	publish(t, ch, "work", "second")
+	deliveries := consume(t, ch, "work", false)
+
+	d := receive(t, deliveries)
+	nothing(t, deliveries)
+	if err := d.Ack(false); err != nil {
+		t.Fatal(err)
+	}
+	if d := receive(t, deliveries); string(d.Body) != "second" {
+		t.Fatalf("got %q, want second", d.Body)
+	}
+}
+
+func TestCancelledConsumerDrainsDeliveries(t *testing.T) {
+	m := NewMemory()
+	ch := m.Channel()
+	declare(t, ch, Queue{Name: "work"})
+	if err := ch.Qos(2); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, ch, "work", "first")
+	publish(t, ch, "work", "second")
+	publish(t, ch, "work", "third")
+	deliveries, err := ch.Consume("work", "worker", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ch.Cancel("worker"); err != nil {
+		t.Fatal(err)
+	}
+	var received int
+	for d := range deliveries {
+		received++
+		if err := d.Nack(false, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if received != 2 {
+		t.Fatalf("received %d deliveries after cancel, want the 2 prefetched", received)
+	}
+	if n := m.Len("work"); n != 3 {
+		t.Fatalf("%d messages ready, want 3", n)
+	}
+}
+
+func TestRejectedAndExpiredMessagesAreDeadLettered(t *testing.T) {
+	m := NewMemory()
+	ch := m.Channel()
+	declare(t, ch, Queue{Name: "dead"})
+	declare(t, ch, Queue{Name: "work", MessageTTL: 20 * time.Millisecond, DeadLetter: "dead"})
+	dead := consume(t, ch, "dead", true)
+
+	publish(t, ch, "work", "expires")
+	d := receive(t, dead)
+	if string(d.Body) != "expires" || d.Headers["x-first-death-reason"] != "expired" {
+		t.Fatalf("got %q with headers %v", d.Body, d.Headers)
+	}
+
+	deliveries := consume(t, ch, "work", false)
+	publish(t, ch, "work", "rejected")
+	if err := receive(t, deliveries).Reject(false); err != nil {
+		t.Fatal(err)
+	}
+	d = receive(t, dead)
+	deaths := d.Headers["x-death"].([]interface{})
+	death := deaths[0].(amqp.Table)
+	if string(d.Body) != "rejected" || death["queue"] != "work" || death["reason"] != "rejected" || death["count"] != int64(1) {
+		t.Fatalf("got %q with x-death %v", d.Body, deaths)
+	}
+}
+
+func TestQueueDeclarations(t *testing.T) {
+	m := NewMemory()
+	owner, other := m.Channel(), m.Channel()
+
+	declare(t, owner, EventsQueue)
+	if _, err := other.Declare(Queue{Name: EventsQueue.Name}); err == nil {
+		t.Fatal("redeclared a queue with other options")
+	}
+	if _, err := other.Declare(Queue{Name: EventsQueue.Name, Passive: true}); err != nil {
+		t.Fatalf("passive declare of an existing queue: %v", err)
+	}
+	if _, err := other.Declare(Queue{Name: "missing", Passive: true}); err == nil {
+		t.Fatal("passively declared a missing queue")
+	}
+
+	private, err := owner.Declare(Queue{Exclusive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Consume(private, "", true); err == nil {
+		t.Fatal("consumed another channel's exclusive queue")
+	}
+	owner.Close()
+	if _, err := other.Declare(Queue{Name: private}); err != nil {
+		t.Fatalf("exclusive queue outlived its channel: %v", err)
+	}
+
+	declare(t, other, Queue{Name: "replies", AutoDelete: true})
+	if _, err := other.Consume("replies", "reader", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Cancel("reader"); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, other, "replies", "lost")
+	if n := m.Len("replies"); n != 0 {
+		t.Fatal("auto-delete queue outlived its last consumer")
+	}
+}
+
+func TestCallWaitsForItsReply(t *testing.T) {
+	m := NewMemory()
+	server, client := m.Channel(), m.Channel()
+	declare(t, server, Queue{Name: "rpc"})
+	requests := consume(t, server, "rpc", false)
+	go func() {
+		for d := range requests {
+			// A reply to an earlier call is ignored
+			server.Publish(d.ReplyTo, amqp.Publishing{CorrelationId: "stale", Body: []byte("stale")})
+			Reply(server, d, amqp.Publishing{Body: append([]byte("re: "), d.Body...)})
+			d.Ack(false)
+		}
+	}()
+
+	reply, err := Call(context.Background(), client, "rpc", amqp.Publishing{CorrelationId: "call-1", Body: []byte("ping")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply.Body) != "re: ping" || reply.CorrelationId != "call-1" {
+		t.Fatalf("got %q for %s", reply.Body, reply.CorrelationId)
+	}
+	m.mu.Lock()
+	n := len(m.queues)
+	m.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("%d queues left, want the reply queue deleted", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := Call(ctx, client, "nobody", amqp.Publishing{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the deadline", err)
+	}
+}
+
+func TestInternal(t *testing.T) {
+	for name, want := range map[string]bool{
+		EventsQueue.Name:       true,
+		EventsDeadLetters.Name: true,
+		ApprovalQueue.Name:     true,
+		DepositQueue.Name:      true,
+		"amq.gen-1":            true,
+		"replays":              false,
+	} {
+		if Internal(name) != want {
+			t.Errorf("Internal(%q) = %v, want %v", name, !want, want)
+		}
+	}
+}
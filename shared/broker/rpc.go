@@ -0,0 +1,62 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+)
+
+// ErrNoReply is returned by Call when the reply queue closes before the
+// reply arrives.
+var ErrNoReply = errors.New("no reply received")
+
+// Call sends the request msg to queue and waits until ctx is done for the
+// reply with the same correlation ID, which is generated if msg has none.
+// Replies arrive on a queue of the call's own, deleted when it returns.
+func Call(ctx context.Context, b Broker, queue string, msg amqp.Publishing) (amqp.Delivery, error) {
+	replyTo, err := b.Declare(Queue{AutoDelete: true, Exclusive: true})
+	if err != nil {
+		return amqp.Delivery{}, fmt.Errorf("failed to declare a reply queue: %w", err)
+	}
+	tag := "reply-" + uuid.NewString()
+	replies, err := b.Consume(replyTo, tag, true)
+	if err != nil {
+		return amqp.Delivery{}, fmt.Errorf("failed to consume replies: %w", err)
+	}
+	defer b.Cancel(tag)
+
+	if msg.CorrelationId == "" {
+		msg.CorrelationId = uuid.NewString()
+	}
+	msg.ReplyTo = replyTo
+	if err := b.Publish(queue, msg); err != nil {
+		return amqp.Delivery{}, err
+	}
+
+	for {
+		select {
+		case d, ok := <-replies:
+			if !ok {
+				return amqp.Delivery{}, ErrNoReply
+			}
+			if d.CorrelationId == msg.CorrelationId {
+				return d, nil
+			}
+		case <-ctx.Done():
+			return amqp.Delivery{}, ctx.Err()
+		}
+	}
+}
+
+// Reply answers the request d with msg. Requests that expect no reply are
+// not answered.
+func Reply(b Broker, d amqp.Delivery, msg amqp.Publishing) error {
+	if d.ReplyTo == "" {
+		return nil
+	}
+	msg.CorrelationId = d.CorrelationId
+	return b.Publish(d.ReplyTo, msg)
+}
@@ -0,0 +1,168 @@
+// Package chaintest runs the services' chain code against go-ethereum's
+// simulated backend instead of a live node. New starts a chain served over
+// HTTP and websocket, mined in the background, with funded accounts and a
+// mock Diamond that records the calls made to it and emits any facet event
+// on request.
+package chaintest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"shared/failover"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Key is the hex private key of a funded account, for the code under test to
+// sign with. The chain sends its own transactions from another account.
+const Key = "b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291"
+
+// DiamondAddress is where the mock Diamond is deployed.
+var DiamondAddress = common.HexToAddress("0x00000000000000000000000000000000000d1a00")
+
+// blockTime is how often the chain mines a block.
+const blockTime = 20 * time.Millisecond
+
+// Chain is a simulated chain for one test.
+type Chain struct {
+	URL     string // HTTP endpoint
+	WSURL   string // websocket endpoint
+	Diamond common.Address
+
+	sim     *simulated.Backend
+	emitMu  sync.Mutex
+	emitter *bind.TransactOpts
+}
+
+// New starts a chain that is shut down when the test ends.
+func New(t testing.TB) *Chain {
+	t.Helper()
+	key, err := crypto.HexToECDSA(Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emitterKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, wsPort := freePort(t), freePort(t)
+	balance := new(big.Int).Mul(big.NewInt(1_000_000), big.NewInt(params.Ether))
+	sim := simulated.NewBackend(types.GenesisAlloc{
+		address(key):        {Balance: balance},
+		address(emitterKey): {Balance: balance},
+		DiamondAddress:      {Code: mockDiamond, Balance: big.NewInt(0)},
+	}, func(nodeConf *node.Config, ethConf *ethconfig.Config) {
+		nodeConf.HTTPHost = "127.0.0.1"
+		nodeConf.HTTPPort = port
+		nodeConf.HTTPModules = []string{"eth", "net", "web3"}
+		nodeConf.WSHost = "127.0.0.1"
+		nodeConf.WSPort = wsPort
+		nodeConf.WSModules = []string{"eth", "net", "web3"}
+	})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(blockTime)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				sim.Commit()
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+		sim.Close()
+	})
+
+	emitter, err := bind.NewKeyedTransactorWithChainID(emitterKey, params.AllDevChainProtocolChanges.ChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Chain{
+		URL:     fmt.Sprintf("http://127.0.0.1:%d", port),
+		WSURL:   fmt.Sprintf("ws://127.0.0.1:%d", wsPort),
+		Diamond: DiamondAddress,
+		sim:     sim,
+		emitter: emitter,
+	}
+}
+
+func address(key *ecdsa.PrivateKey) common.Address {
+	return crypto.PubkeyToAddress(key.PublicKey)
+}
+
+func freePort(t testing.TB) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// URLs returns the chain's endpoints, websocket first, as the services
+// configure them.
+func (c *Chain) URLs() []string {
+	return []string{c.WSURL, c.URL}
+}
+
+// Dial connects a failover client to the chain, closed when the test ends.
+func (c *Chain) Dial(t testing.TB) *failover.Client {
+	t.Helper()
+	client, err := failover.Dial(failover.Config{URLs: c.URLs()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+// Emitter returns the account the chain sends its own transactions from.
+func (c *Chain) Emitter() common.Address {
+	return c.emitter.From
+}
+
+// WaitMined waits for the transaction to be mined and returns its receipt.
+// The test fails if it is not mined within a few seconds or reverts.
+func (c *Chain) WaitMined(t testing.TB, hash common.Hash) *types.Receipt {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		receipt, err := c.sim.Client().TransactionReceipt(ctx, hash)
+		if err == nil {
+			if receipt.Status != types.ReceiptStatusSuccessful {
+				t.Fatalf("transaction %s reverted", hash.Hex())
+			}
+			return receipt
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("transaction %s was not mined: %v", hash.Hex(), err)
+		case <-time.After(blockTime):
+		}
+	}
+}
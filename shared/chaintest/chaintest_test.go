@@ -0,0 +1,95 @@
+package chaintest
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const testABI = `[
+	{"type":"event","name":"Transferred","anonymous":false,"inputs":[
+		{"indexed":true,"name":"from","type":"address"},
+		{"indexed":false,"name":"note","type":"string"},
+		{"indexed":true,"name":"id","type":"uint256"},
+		{"indexed":false,"name":"amount","type":"uint256"}]},
+	{"type":"function","name":"deposit","inputs":[{"name":"memo","type":"bytes"}],"outputs":[],"stateMutability":"payable"}
+]`
+
+func parse(t *testing.T) abi.ABI {
+	t.Helper()
+	parsed, err := abi.JSON(strings.NewReader(testABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestEmit(t *testing.T) {
+	c := New(t)
+	parsed := parse(t)
+	event := parsed.Events["Transferred"]
+
+	receipt := c.Emit(t, event, c.Emitter(), "hello", big.NewInt(7), big.NewInt(1000))
+	if len(receipt.Logs) != 1 {
+		t.Fatalf("got %d logs, want 1", len(receipt.Logs))
+	}
+	vLog := receipt.Logs[0]
+	if vLog.Address != c.Diamond {
+		t.Fatalf("log address = %s, want the Diamond", vLog.Address.Hex())
+	}
+	if len(vLog.Topics) != 3 || vLog.Topics[0] != event.ID || vLog.Topics[2].Big().Int64() != 7 {
+		t.Fatalf("unexpected topics %v", vLog.Topics)
+	}
+	values := map[string]interface{}{}
+	if err := parsed.UnpackIntoMap(values, event.Name, vLog.Data); err != nil {
+		t.Fatal(err)
+	}
+	if values["note"] != "hello" || values["amount"].(*big.Int).Int64() != 1000 {
+		t.Fatalf("unexpected data %v", values)
+	}
+}
+
+func TestCallsAreRecorded(t *testing.T) {
+	c := New(t)
+	parsed := parse(t)
+	key, _ := crypto.HexToECDSA(Key)
+	opts, err := bind.NewKeyedTransactorWithChainID(key, params.AllDevChainProtocolChanges.ChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Value = big.NewInt(params.GWei)
+	client := c.Dial(t)
+	contract := bind.NewBoundContract(c.Diamond, parsed, client, client, client)
+	memo := []byte(strings.Repeat("memo", 20))
+	tx, err := contract.Transact(opts, "deposit", memo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.WaitMined(t, tx.Hash())
+
+	calls := c.Calls(t)
+	if len(calls) != 1 {
+		t.Fatalf("got %d calls, want 1", len(calls))
+	}
+	call := calls[0]
+	if call.From != opts.From || call.Value.Int64() != params.GWei || call.TxHash != tx.Hash() {
+		t.Fatalf("unexpected call %+v", call)
+	}
+	name, args := call.Method(t, parsed)
+	if name != "deposit" || string(args[0].([]byte)) != string(memo) {
+		t.Fatalf("got %s(%q)", name, args)
+	}
+	balance, err := client.BalanceAt(context.Background(), c.Diamond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Int64() != params.GWei {
+		t.Fatalf("Diamond balance = %s, want the deposit", balance)
+	}
+}
@@ -0,0 +1,210 @@
+package chaintest
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/asm"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// emitSelector marks calldata that asks the mock Diamond to emit a log.
+const emitSelector = 0xffffffff
+
+// CalledABI is the event the mock Diamond logs for every other call.
+const CalledABI = `[{"anonymous":false,"inputs":[{"indexed":true,"name":"caller","type":"address"},{"indexed":false,"name":"value","type":"uint256"},{"indexed":false,"name":"input","type":"bytes"}],"name":"Called","type":"event"}]`
+
+var calledEvent = func() abi.Event {
+	parsed, err := abi.JSON(strings.NewReader(CalledABI))
+	if err != nil {
+		panic(err)
+	}
+	return parsed.Events["Called"]
+}()
+
+// mockDiamond is the runtime code of a stand-in for the Diamond and its
+// facets. It accepts any call and value and records it as a Called log,
+// except calldata starting with emitSelector:
+//
+//	ffffffff | topic count (1 byte) | topics (32 bytes each) | data
+//
+// which it emits as a log of its own, so tests can produce any facet event.
+var mockDiamond = mustAssemble(mockDiamondSource())
+
+func mockDiamondSource() string {
+	var src strings.Builder
+	fmt.Fprintf(&src, `
+	PUSH 0
+	CALLDATALOAD
+	PUSH 224
+	SHR
+	PUSH %#x
+	EQ
+	JUMPI @emit
+
+	;; Called(caller, value, input): memory holds value, the offset of
+	;; input, its length and the calldata, padded to 32 bytes
+	CALLVALUE
+	PUSH 0
+	MSTORE
+	PUSH 0x40
+	PUSH 0x20
+	MSTORE
+	CALLDATASIZE
+	PUSH 0x40
+	MSTORE
+	CALLDATASIZE
+	PUSH 0
+	PUSH 0x60
+	CALLDATACOPY
+	CALLER
+	PUSH %s
+	PUSH 32
+	PUSH 31
+	CALLDATASIZE
+	ADD
+	DIV
+	PUSH 32
+	MUL
+	PUSH 0x60
+	ADD
+	PUSH 0
+	LOG2
+	STOP
+
+emit:
+	PUSH 4
+	CALLDATALOAD
+	PUSH 248
+	SHR
+`, emitSelector, calledEvent.ID.Hex())
+	for n := 0; n <= 4; n++ {
+		fmt.Fprintf(&src, "\tDUP1\n\tPUSH %d\n\tEQ\n\tJUMPI @log%d\n", n, n)
+	}
+	src.WriteString("\tPUSH 0\n\tDUP1\n\tREVERT\n")
+
+	// Each LOGn copies the data after its n topics and pushes the topics
+	// last to first
+	for n := 0; n <= 4; n++ {
+		data := 5 + 32*n
+		fmt.Fprintf(&src, "log%d:\n\tPUSH %d\n\tCALLDATASIZE\n\tSUB\n\tPUSH %d\n\tPUSH 0\n\tCALLDATACOPY\n", n, data, data)
+		for i := n - 1; i >= 0; i-- {
+			fmt.Fprintf(&src, "\tPUSH %d\n\tCALLDATALOAD\n", 5+32*i)
+		}
+		fmt.Fprintf(&src, "\tPUSH %d\n\tCALLDATASIZE\n\tSUB\n\tPUSH 0\n\tLOG%d\n\tSTOP\n", data, n)
+	}
+	return src.String()
+}
+
+func mustAssemble(src string) []byte {
+	compiler := asm.NewCompiler(false)
+	compiler.Feed(asm.Lex([]byte(src), false))
+	code, errs := compiler.Compile()
+	if len(errs) > 0 {
+		panic(fmt.Sprintf("chaintest: assembling the mock Diamond: %v", errs))
+	}
+	return common.FromHex(code)
+}
+
+// Call is a call the mock Diamond recorded.
+type Call struct {
+	From   common.Address
+	Value  *big.Int
+	Input  []byte
+	Block  uint64
+	TxHash common.Hash
+}
+
+// Method returns the name of the method of contractABI the call invoked, and
+// its unpacked arguments.
+func (c Call) Method(t testing.TB, contractABI abi.ABI) (string, []interface{}) {
+	t.Helper()
+	method, err := contractABI.MethodById(c.Input)
+	if err != nil {
+		t.Fatalf("call %x: %v", c.Input, err)
+	}
+	args, err := method.Inputs.Unpack(c.Input[4:])
+	if err != nil {
+		t.Fatalf("call to %s: %v", method.Name, err)
+	}
+	return method.Name, args
+}
+
+// Calls returns the calls made to the mock Diamond so far, oldest first.
+func (c *Chain) Calls(t testing.TB) []Call {
+	t.Helper()
+	logs, err := c.sim.Client().FilterLogs(context.Background(), ethereum.FilterQuery{
+		FromBlock: big.NewInt(0),
+		Addresses: []common.Address{c.Diamond},
+		Topics:    [][]common.Hash{{calledEvent.ID}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := make([]Call, 0, len(logs))
+	for _, vLog := range logs {
+		values, err := calledEvent.Inputs.NonIndexed().Unpack(vLog.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		calls = append(calls, Call{
+			From:   common.BytesToAddress(vLog.Topics[1].Bytes()),
+			Value:  values[0].(*big.Int),
+			Input:  values[1].([]byte),
+			Block:  vLog.BlockNumber,
+			TxHash: vLog.TxHash,
+		})
+	}
+	return calls
+}
+
+// Emit makes the mock Diamond emit event with args, given in the order of
+// the event's inputs, and returns the receipt once it is mined.
+func (c *Chain) Emit(t testing.TB, event abi.Event, args ...interface{}) *types.Receipt {
+	t.Helper()
+	if len(args) != len(event.Inputs) {
+		t.Fatalf("%s takes %d arguments, got %d", event.Name, len(event.Inputs), len(args))
+	}
+	var topics []common.Hash
+	if !event.Anonymous {
+		topics = append(topics, event.ID)
+	}
+	var data []interface{}
+	for i, input := range event.Inputs {
+		if !input.Indexed {
+			data = append(data, args[i])
+			continue
+		}
+		topic, err := abi.MakeTopics([]interface{}{args[i]})
+		if err != nil {
+			t.Fatalf("%s: %v", input.Name, err)
+		}
+		topics = append(topics, topic[0][0])
+	}
+	packed, err := event.Inputs.NonIndexed().Pack(data...)
+	if err != nil {
+		t.Fatalf("%s: %v", event.Name, err)
+	}
+
+	calldata := []byte{0xff, 0xff, 0xff, 0xff, byte(len(topics))}
+	for _, topic := range topics {
+		calldata = append(calldata, topic.Bytes()...)
+	}
+	calldata = append(calldata, packed...)
+
+	c.emitMu.Lock()
+	defer c.emitMu.Unlock()
+	contract := bind.NewBoundContract(c.Diamond, abi.ABI{}, c.sim.Client(), c.sim.Client(), c.sim.Client())
+	tx, err := contract.RawTransact(c.emitter, calldata)
+	if err != nil {
+		t.Fatalf("emit %s: %v", event.Name, err)
+	}
+	return c.WaitMined(t, tx.Hash())
+}
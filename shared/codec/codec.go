@@ -0,0 +1,152 @@
+// Package codec encodes the messages the services exchange over RabbitMQ,
+// the event envelope and the worker's requests and responses, as JSON or as
+// Protobuf. The content type of each message says which.
+//
+// The Protobuf definitions are in proto/, for consumers in other languages,
+// and the registry file there records every version of each message so
+// consumers can check they are compatible with what is published. The Go
+// types convert to and from the types generated from those definitions,
+// which do the encoding; TestRegistry keeps the definitions in step with the
+// registry.
+package codec
+
+//go:generate protoc -I proto --go_out=.. --go_opt=module=shared contractevents/v1/envelope.proto worker/v1/worker.proto
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+
+	"github.com/streadway/amqp"
+	"google.golang.org/protobuf/proto"
+)
+
+// Content types of the supported encodings.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// Encodings, as services are configured with them.
+const (
+	EncodingJSON     = "json"
+	EncodingProtobuf = "protobuf"
+)
+
+// AcceptHeader is the request header naming the content type the reply
+// should be encoded in. Without it the reply uses the request's.
+const AcceptHeader = "accept"
+
+// Message is a message with a Protobuf encoding: a Go type that converts to
+// and from the type generated from its .proto file.
+type Message interface {
+	// Proto returns the message as its generated type.
+	Proto() proto.Message
+	// SetProto sets the message from its generated type, of the kind Proto
+	// returns.
+	SetProto(m proto.Message)
+}
+
+// Name returns m's full name in the .proto files, such as
+// "contractevents.v1.Envelope".
+func Name(m Message) string {
+	return string(proto.MessageName(m.Proto()))
+}
+
+// ContentType returns the content type of an encoding.
+func ContentType(encoding string) (string, error) {
+	switch encoding {
+	case "", EncodingJSON:
+		return ContentTypeJSON, nil
+	case EncodingProtobuf:
+		return ContentTypeProtobuf, nil
+	}
+	return "", fmt.Errorf("unknown encoding %q, want %s or %s", encoding, EncodingJSON, EncodingProtobuf)
+}
+
+// Marshal encodes m in contentType and returns the body with its full
+// content type. Protobuf content types name the message type in a
+// messagetype parameter.
+func Marshal(contentType string, m Message) ([]byte, string, error) {
+	mediaType, err := parse(contentType)
+	if err != nil {
+		return nil, "", err
+	}
+	if mediaType == ContentTypeProtobuf {
+		body, err := proto.Marshal(m.Proto())
+		return body, mime.FormatMediaType(ContentTypeProtobuf, map[string]string{"messageType": Name(m)}), err
+	}
+	body, err := json.Marshal(m)
+	return body, ContentTypeJSON, err
+}
+
+// Unmarshal decodes body, encoded in contentType, into m. An empty content
+// type is JSON, which is what every message was before Protobuf.
+func Unmarshal(contentType string, body []byte, m Message) error {
+	if contentType == "" {
+		return json.Unmarshal(body, m)
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+	switch mediaType {
+	case ContentTypeJSON:
+		return json.Unmarshal(body, m)
+	case ContentTypeProtobuf:
+		if name := params["messagetype"]; name != "" && name != Name(m) {
+			return fmt.Errorf("got a %s message, want %s", name, Name(m))
+		}
+		decoded := m.Proto().ProtoReflect().New().Interface()
+		if err := proto.Unmarshal(body, decoded); err != nil {
+			return err
+		}
+		m.SetProto(decoded)
+		return nil
+	}
+	return fmt.Errorf("unsupported content type %q", contentType)
+}
+
+// IsProtobuf reports whether contentType is the Protobuf encoding.
+func IsProtobuf(contentType string) bool {
+	mediaType, err := parse(contentType)
+	return err == nil && mediaType == ContentTypeProtobuf
+}
+
+// Publishing returns an AMQP message carrying m encoded in contentType.
+func Publishing(contentType string, m Message) (amqp.Publishing, error) {
+	body, contentType, err := Marshal(contentType, m)
+	if err != nil {
+		return amqp.Publishing{}, err
+	}
+	return amqp.Publishing{ContentType: contentType, Body: body}, nil
+}
+
+// ReplyContentType returns the content type to reply to a request in: the
+// one its accept header names, else its own.
+func ReplyContentType(request amqp.Delivery) string {
+	if accept, ok := request.Headers[AcceptHeader].(string); ok {
+		if mediaType, err := parse(accept); err == nil {
+			return mediaType
+		}
+	}
+	if mediaType, err := parse(request.ContentType); err == nil {
+		return mediaType
+	}
+	return ContentTypeJSON
+}
+
+// parse returns the media type of a supported content type.
+func parse(contentType string) (string, error) {
+	if contentType == "" {
+		return ContentTypeJSON, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+	if mediaType != ContentTypeJSON && mediaType != ContentTypeProtobuf {
+		return "", fmt.Errorf("unsupported content type %q", contentType)
+	}
+	return mediaType, nil
+}
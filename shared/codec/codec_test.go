@@ -0,0 +1,162 @@
+package codec_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"shared/codec"
+	"shared/envelope"
+	"shared/messages"
+	"strings"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// populated has a value of every message, with every field set.
+var populated = []codec.Message{
+	&envelope.Envelope{
+		ID: "1337:0xabc:2", SchemaVersion: "1.1", ChainID: 1337, Contract: "diamond", Address: "0xD1A",
+		EventName: "ProposalAdded", Signature: "ProposalAdded(address,uint256)", BlockNumber: 9, BlockHash: "0xb",
+		BlockTimestamp: 1700000000, TransactionHash: "0xabc", TransactionIndex: 1, LogIndex: 2, From: "0xF", Replay: "r1",
+		Args: map[string]json.RawMessage{"recipient": json.RawMessage(`"0xBB"`), "amount": json.RawMessage(`"100"`)},
+	},
+	&messages.ApprovalRequest{ProposalID: 7, PrivateKey: "key"},
+	&messages.DepositRequest{PrivateKey: "key", Amount: "0.5"},
+	&messages.Response{Message: "Success", Error: "unused"},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, m := range populated {
+		for _, contentType := range []string{codec.ContentTypeJSON, codec.ContentTypeProtobuf} {
+			body, full, err := codec.Marshal(contentType, m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded := reflect.New(reflect.TypeOf(m).Elem()).Interface().(codec.Message)
+			if err := codec.Unmarshal(full, body, decoded); err != nil {
+				t.Fatalf("%s as %s: %v", codec.Name(m), full, err)
+			}
+			if !reflect.DeepEqual(decoded, m) {
+				t.Errorf("%s as %s decoded to %+v", codec.Name(m), full, decoded)
+			}
+		}
+	}
+}
+
+func TestContentTypes(t *testing.T) {
+	request := &messages.ApprovalRequest{ProposalID: 7}
+	msg, err := codec.Publishing(codec.ContentTypeProtobuf, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ContentType != "application/x-protobuf; messagetype=worker.v1.ApprovalRequest" {
+		t.Fatalf("content type %q", msg.ContentType)
+	}
+	if err := codec.Unmarshal(msg.ContentType, msg.Body, &messages.DepositRequest{}); err == nil {
+		t.Fatal("decoded an approval request as a deposit request")
+	}
+	if err := codec.Unmarshal("text/plain", msg.Body, request); err == nil {
+		t.Fatal("decoded text")
+	}
+	// Messages from before content types were set are JSON
+	if err := codec.Unmarshal("", []byte(`{"proposalId":3}`), request); err != nil || request.ProposalID != 3 {
+		t.Fatalf("got %+v, %v", request, err)
+	}
+
+	for _, test := range []struct {
+		request amqp.Delivery
+		want    string
+	}{
+		{amqp.Delivery{}, codec.ContentTypeJSON},
+		{amqp.Delivery{ContentType: msg.ContentType}, codec.ContentTypeProtobuf},
+		{amqp.Delivery{ContentType: codec.ContentTypeJSON, Headers: amqp.Table{codec.AcceptHeader: codec.ContentTypeProtobuf}}, codec.ContentTypeProtobuf},
+		{amqp.Delivery{ContentType: "text/plain", Headers: amqp.Table{codec.AcceptHeader: "text/html"}}, codec.ContentTypeJSON},
+	} {
+		if got := codec.ReplyContentType(test.request); got != test.want {
+			t.Errorf("reply to %q accepting %v in %q, want %q", test.request.ContentType, test.request.Headers, got, test.want)
+		}
+	}
+
+	if _, err := codec.ContentType("avro"); err == nil {
+		t.Fatal("accepted an unknown encoding")
+	}
+}
+
+// TestRegistry checks the registry is consistent, and that the messages
+// generated from the .proto files match its latest versions.
+func TestRegistry(t *testing.T) {
+	registry := codec.DefaultRegistry()
+	if err := registry.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range populated {
+		name := codec.Name(m)
+		schema, ok := registry.Latest(name)
+		if !ok {
+			t.Fatalf("%s is not registered", name)
+		}
+		desc := m.Proto().ProtoReflect().Descriptor()
+		if desc.ParentFile().Path() != schema.File {
+			t.Errorf("%s is generated from %s, registered in %s", name, desc.ParentFile().Path(), schema.File)
+		}
+		if _, ok := codec.ProtoFile(schema.File); !ok {
+			t.Errorf("%s: no file %s", name, schema.File)
+		}
+		// The Go type fills in every field it is given
+		var declared []codec.Field
+		for i := 0; i < desc.Fields().Len(); i++ {
+			f := desc.Fields().Get(i)
+			declared = append(declared, codec.Field{Number: int(f.Number()), Name: string(f.Name()), Type: protoType(f)})
+			if !m.Proto().ProtoReflect().Has(f) {
+				t.Errorf("%s does not set %s", name, f.Name())
+			}
+		}
+		if !reflect.DeepEqual(declared, schema.Fields) {
+			t.Errorf("%s declares %+v, registered %+v", name, declared, schema.Fields)
+		}
+	}
+}
+
+// protoType is a field's type as the .proto files and the registry write it.
+func protoType(f protoreflect.FieldDescriptor) string {
+	if f.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", f.MapKey().Kind(), f.MapValue().Kind())
+	}
+	return f.Kind().String()
+}
+
+func field(number int, name, typ string) codec.Field {
+	return codec.Field{Number: number, Name: name, Type: typ}
+}
+
+func TestCompatible(t *testing.T) {
+	v1 := codec.Schema{Version: 1, Fields: []codec.Field{field(1, "id", "string"), field(2, "amount", "string")}}
+	for _, test := range []struct {
+		newer codec.Schema
+		err   string
+	}{
+		{codec.Schema{Fields: []codec.Field{field(1, "id", "string"), field(2, "amount", "string"), field(3, "memo", "string")}}, ""},
+		{codec.Schema{Fields: []codec.Field{field(1, "id", "string")}, Reserved: []int{2}}, ""},
+		{codec.Schema{Fields: []codec.Field{field(1, "id", "string")}}, "removed without reserving"},
+		{codec.Schema{Fields: []codec.Field{field(1, "id", "uint64"), field(2, "amount", "string")}}, "changed type"},
+		{codec.Schema{Fields: []codec.Field{field(1, "key", "string"), field(2, "amount", "string")}}, "renamed"},
+		{codec.Schema{Fields: []codec.Field{field(1, "id", "string"), field(2, "memo", "string")}, Reserved: []int{2}}, "reuses a reserved number"},
+	} {
+		err := codec.Compatible(v1, test.newer)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%+v: got %v, want %q", test.newer, err, test.err)
+		}
+	}
+
+	registry := codec.DefaultRegistry()
+	if err := registry.Check("worker.v1.Response", codec.Schema{Version: 1, Fields: []codec.Field{field(1, "message", "string")}}); err != nil {
+		t.Fatal(err)
+	}
+	err := registry.Check("worker.v1.Response", codec.Schema{Version: 1, Fields: []codec.Field{field(1, "message", "bytes")}})
+	if err == nil {
+		t.Fatal("compatible with a field of another type")
+	}
+}
@@ -0,0 +1,278 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: contractevents/v1/envelope.proto
+
+// The envelope the publisher wraps every contract event in. Its JSON form is
+// described by the envelope JSON Schema the publisher serves under /schemas;
+// the fields here carry the same values.
+
+package contracteventsv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Envelope struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// "<chainId>:<transactionHash>:<logIndex>", stable across redeliveries
+	// and replays.
+	Id            string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	SchemaVersion string `protobuf:"bytes,2,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+	ChainId       uint64 `protobuf:"varint,3,opt,name=chain_id,json=chainId,proto3" json:"chain_id,omitempty"`
+	// Name the publisher watches the contract under, and its address.
+	Contract  string `protobuf:"bytes,4,opt,name=contract,proto3" json:"contract,omitempty"`
+	Address   string `protobuf:"bytes,5,opt,name=address,proto3" json:"address,omitempty"`
+	EventName string `protobuf:"bytes,6,opt,name=event_name,json=eventName,proto3" json:"event_name,omitempty"`
+	// Canonical signature, such as "ProposalApproved(uint256)".
+	Signature   string `protobuf:"bytes,7,opt,name=signature,proto3" json:"signature,omitempty"`
+	BlockNumber uint64 `protobuf:"varint,8,opt,name=block_number,json=blockNumber,proto3" json:"block_number,omitempty"`
+	BlockHash   string `protobuf:"bytes,9,opt,name=block_hash,json=blockHash,proto3" json:"block_hash,omitempty"`
+	// Unix seconds; 0 if the block could not be fetched.
+	BlockTimestamp   uint64 `protobuf:"varint,10,opt,name=block_timestamp,json=blockTimestamp,proto3" json:"block_timestamp,omitempty"`
+	TransactionHash  string `protobuf:"bytes,11,opt,name=transaction_hash,json=transactionHash,proto3" json:"transaction_hash,omitempty"`
+	TransactionIndex uint32 `protobuf:"varint,12,opt,name=transaction_index,json=transactionIndex,proto3" json:"transaction_index,omitempty"`
+	LogIndex         uint32 `protobuf:"varint,13,opt,name=log_index,json=logIndex,proto3" json:"log_index,omitempty"`
+	From             string `protobuf:"bytes,14,opt,name=from,proto3" json:"from,omitempty"`
+	// Arguments by name, each the JSON value the JSON envelope carries:
+	// integers as decimal strings, addresses checksummed, bytes as 0x hex.
+	Args map[string]string `protobuf:"bytes,15,rep,name=args,proto3" json:"args,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// ID of the replay that published the event again, empty for live events.
+	// Added in version 2.
+	Replay        string `protobuf:"bytes,16,opt,name=replay,proto3" json:"replay,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Envelope) Reset() {
+	*x = Envelope{}
+	mi := &file_contractevents_v1_envelope_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Envelope) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Envelope) ProtoMessage() {}
+
+func (x *Envelope) ProtoReflect() protoreflect.Message {
+	mi := &file_contractevents_v1_envelope_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Envelope.ProtoReflect.Descriptor instead.
+func (*Envelope) Descriptor() ([]byte, []int) {
+	return file_contractevents_v1_envelope_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Envelope) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Envelope) GetSchemaVersion() string {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return ""
+}
+
+func (x *Envelope) GetChainId() uint64 {
+	if x != nil {
+		return x.ChainId
+	}
+	return 0
+}
+
+func (x *Envelope) GetContract() string {
+	if x != nil {
+		return x.Contract
+	}
+	return ""
+}
+
+func (x *Envelope) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *Envelope) GetEventName() string {
+	if x != nil {
+		return x.EventName
+	}
+	return ""
+}
+
+func (x *Envelope) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+func (x *Envelope) GetBlockNumber() uint64 {
+	if x != nil {
+		return x.BlockNumber
+	}
+	return 0
+}
+
+func (x *Envelope) GetBlockHash() string {
+	if x != nil {
+		return x.BlockHash
+	}
+	return ""
+}
+
+func (x *Envelope) GetBlockTimestamp() uint64 {
+	if x != nil {
+		return x.BlockTimestamp
+	}
+	return 0
+}
+
+func (x *Envelope) GetTransactionHash() string {
+	if x != nil {
+		return x.TransactionHash
+	}
+	return ""
+}
+
+func (x *Envelope) GetTransactionIndex() uint32 {
+	if x != nil {
+		return x.TransactionIndex
+	}
+	return 0
+}
+
+func (x *Envelope) GetLogIndex() uint32 {
+	if x != nil {
+		return x.LogIndex
+	}
+	return 0
+}
+
+func (x *Envelope) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *Envelope) GetArgs() map[string]string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *Envelope) GetReplay() string {
+	if x != nil {
+		return x.Replay
+	}
+	return ""
+}
+
+var File_contractevents_v1_envelope_proto protoreflect.FileDescriptor
+
+const file_contractevents_v1_envelope_proto_rawDesc = "" +
+	"\n" +
+	" contractevents/v1/envelope.proto\x12\x11contractevents.v1\"\xcf\x04\n" +
+	"\bEnvelope\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12%\n" +
+	"\x0eschema_version\x18\x02 \x01(\tR\rschemaVersion\x12\x19\n" +
+	"\bchain_id\x18\x03 \x01(\x04R\achainId\x12\x1a\n" +
+	"\bcontract\x18\x04 \x01(\tR\bcontract\x12\x18\n" +
+	"\aaddress\x18\x05 \x01(\tR\aaddress\x12\x1d\n" +
+	"\n" +
+	"event_name\x18\x06 \x01(\tR\teventName\x12\x1c\n" +
+	"\tsignature\x18\a \x01(\tR\tsignature\x12!\n" +
+	"\fblock_number\x18\b \x01(\x04R\vblockNumber\x12\x1d\n" +
+	"\n" +
+	"block_hash\x18\t \x01(\tR\tblockHash\x12'\n" +
+	"\x0fblock_timestamp\x18\n" +
+	" \x01(\x04R\x0eblockTimestamp\x12)\n" +
+	"\x10transaction_hash\x18\v \x01(\tR\x0ftransactionHash\x12+\n" +
+	"\x11transaction_index\x18\f \x01(\rR\x10transactionIndex\x12\x1b\n" +
+	"\tlog_index\x18\r \x01(\rR\blogIndex\x12\x12\n" +
+	"\x04from\x18\x0e \x01(\tR\x04from\x129\n" +
+	"\x04args\x18\x0f \x03(\v2%.contractevents.v1.Envelope.ArgsEntryR\x04args\x12\x16\n" +
+	"\x06replay\x18\x10 \x01(\tR\x06replay\x1a7\n" +
+	"\tArgsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01B7Z5shared/codec/proto/contractevents/v1;contracteventsv1b\x06proto3"
+
+var (
+	file_contractevents_v1_envelope_proto_rawDescOnce sync.Once
+	file_contractevents_v1_envelope_proto_rawDescData []byte
+)
+
+func file_contractevents_v1_envelope_proto_rawDescGZIP() []byte {
+	file_contractevents_v1_envelope_proto_rawDescOnce.Do(func() {
+		file_contractevents_v1_envelope_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_contractevents_v1_envelope_proto_rawDesc), len(file_contractevents_v1_envelope_proto_rawDesc)))
+	})
+	return file_contractevents_v1_envelope_proto_rawDescData
+}
+
+var file_contractevents_v1_envelope_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_contractevents_v1_envelope_proto_goTypes = []any{
+	(*Envelope)(nil), // 0: contractevents.v1.Envelope
+	nil,              // 1: contractevents.v1.Envelope.ArgsEntry
+}
+var file_contractevents_v1_envelope_proto_depIdxs = []int32{
+	1, // 0: contractevents.v1.Envelope.args:type_name -> contractevents.v1.Envelope.ArgsEntry
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_contractevents_v1_envelope_proto_init() }
+func file_contractevents_v1_envelope_proto_init() {
+	if File_contractevents_v1_envelope_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_contractevents_v1_envelope_proto_rawDesc), len(file_contractevents_v1_envelope_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_contractevents_v1_envelope_proto_goTypes,
+		DependencyIndexes: file_contractevents_v1_envelope_proto_depIdxs,
+		MessageInfos:      file_contractevents_v1_envelope_proto_msgTypes,
+	}.Build()
+	File_contractevents_v1_envelope_proto = out.File
+	file_contractevents_v1_envelope_proto_goTypes = nil
+	file_contractevents_v1_envelope_proto_depIdxs = nil
+}
@@ -0,0 +1,138 @@
+package codec
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// files holds the .proto files and the registry.
+//
+//go:embed proto/registry.json proto/*/*/*.proto
+var files embed.FS
+
+// ProtoFile returns one of the files under proto/, such as
+// "registry.json" or "worker/v1/worker.proto".
+func ProtoFile(name string) ([]byte, bool) {
+	raw, err := files.ReadFile("proto/" + name)
+	return raw, err == nil
+}
+
+// Registry is the schema registry file: every version of every message,
+// oldest first, by the message's full name.
+type Registry struct {
+	// Compatibility is the rule every new version follows. Only BACKWARD
+	// is supported: consumers of an older version can read newer messages.
+	Compatibility string              `json:"compatibility"`
+	Subjects      map[string][]Schema `json:"subjects"`
+}
+
+// Schema is one version of a message.
+type Schema struct {
+	Version int     `json:"version"`
+	File    string  `json:"file,omitempty"`
+	Fields  []Field `json:"fields"`
+	// Reserved are the numbers of fields removed in or before this version,
+	// which no later field may reuse.
+	Reserved []int `json:"reserved,omitempty"`
+}
+
+// Field is a field of a message, typed as in its .proto file.
+type Field struct {
+	Number int    `json:"number"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+}
+
+// DefaultRegistry returns the registry of the messages defined here.
+func DefaultRegistry() *Registry {
+	raw, _ := ProtoFile("registry.json")
+	var r Registry
+	if err := json.Unmarshal(raw, &r); err != nil {
+		panic(fmt.Sprintf("codec: invalid embedded registry: %v", err))
+	}
+	return &r
+}
+
+// LoadRegistry reads a registry file, such as a consumer's copy of the one
+// in proto/, and checks each subject's versions are compatible.
+func LoadRegistry(path string) (*Registry, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema registry: %w", err)
+	}
+	var r Registry
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse schema registry %s: %w", path, err)
+	}
+	return &r, r.Validate()
+}
+
+// Latest returns the newest version of a subject.
+func (r *Registry) Latest(subject string) (Schema, bool) {
+	versions := r.Subjects[subject]
+	if len(versions) == 0 {
+		return Schema{}, false
+	}
+	return versions[len(versions)-1], true
+}
+
+// Validate checks every version of each subject against the one before.
+func (r *Registry) Validate() error {
+	if r.Compatibility != "BACKWARD" {
+		return fmt.Errorf("unsupported compatibility %q", r.Compatibility)
+	}
+	var errs []error
+	for subject, versions := range r.Subjects {
+		for i := 1; i < len(versions); i++ {
+			if versions[i].Version <= versions[i-1].Version {
+				errs = append(errs, fmt.Errorf("%s: version %d follows %d", subject, versions[i].Version, versions[i-1].Version))
+			}
+			if err := Compatible(versions[i-1], versions[i]); err != nil {
+				errs = append(errs, fmt.Errorf("%s version %d: %w", subject, versions[i].Version, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Check reports whether a consumer built against reader, its version of
+// subject, can read the messages of the latest version.
+func (r *Registry) Check(subject string, reader Schema) error {
+	latest, ok := r.Latest(subject)
+	if !ok {
+		return fmt.Errorf("unknown subject %s", subject)
+	}
+	if err := Compatible(reader, latest); err != nil {
+		return fmt.Errorf("%s version %d cannot be read by consumers of version %d: %w", subject, latest.Version, reader.Version, err)
+	}
+	return nil
+}
+
+// Compatible reports whether readers of older can read messages of newer:
+// every field of older keeps its number, name and type, or is removed and
+// its number reserved, and no field reuses a reserved number.
+func Compatible(older, newer Schema) error {
+	var errs []error
+	for _, field := range older.Fields {
+		i := slices.IndexFunc(newer.Fields, func(f Field) bool { return f.Number == field.Number })
+		switch {
+		case i < 0 && !slices.Contains(newer.Reserved, field.Number):
+			errs = append(errs, fmt.Errorf("field %d (%s) removed without reserving its number", field.Number, field.Name))
+		case i >= 0 && newer.Fields[i].Type != field.Type:
+			errs = append(errs, fmt.Errorf("field %d (%s) changed type from %s to %s", field.Number, field.Name, field.Type, newer.Fields[i].Type))
+		case i >= 0 && newer.Fields[i].Name != field.Name:
+			// Protobuf would cope, but the JSON encoding uses the names
+			errs = append(errs, fmt.Errorf("field %d renamed from %s to %s", field.Number, field.Name, newer.Fields[i].Name))
+		}
+	}
+	for _, field := range newer.Fields {
+		if slices.Contains(older.Reserved, field.Number) || slices.Contains(newer.Reserved, field.Number) {
+			errs = append(errs, fmt.Errorf("field %d (%s) reuses a reserved number", field.Number, field.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
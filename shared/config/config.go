@@ -0,0 +1,409 @@
+// Package config loads a service's settings into a struct from, in order of
+// precedence, command-line flags, environment variables, a .env file, a
+// YAML or TOML config file and the defaults declared on the struct.
+//
+// Settings are described with struct tags:
+//
+//	type Config struct {
+//		Port int        `config:"port" default:"3000" validate:"port"`
+//		RPC  config.RPC `config:"rpc"`
+//	}
+//
+// The tags are:
+//
+//   - config is the setting's key in the config file. Nested structs add a
+//     dotted prefix, so RPC.URLs above is "rpc.urls".
+//   - env lists the environment variables read, first set wins. It defaults
+//     to the key in upper snake case, RPC_URLS for "rpc.urls".
+//   - default is the value used when no layer sets one.
+//   - validate lists checks: required, address, url, hexkey, port and
+//     oneof=a|b.
+//   - secret masks the value wherever the effective config is shown.
+//   - usage is the flag's help text. Flags are named after the key in kebab
+//     case, -rpc-urls.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Sources of a setting, as reported in the effective config.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceDotEnv  = ".env"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// setting is one leaf field of the config struct.
+type setting struct {
+	key    string
+	env    []string
+	flag   string
+	def    string
+	hasDef bool
+	rules  []string
+	secret bool
+	usage  string
+	value  reflect.Value
+
+	raw    string
+	source string
+	origin string // variable, file or flag the value came from
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load fills cfg, a pointer to a struct, from the process's arguments and
+// environment. It returns the effective settings, or an error listing every
+// invalid one. flag.ErrHelp is returned, wrapped, after -h printed usage.
+func Load(service string, cfg any) (Effective, error) {
+	return load(service, cfg, os.Args[1:], os.LookupEnv)
+}
+
+// MustLoad is Load for main: on error it prints the problems and exits, and
+// with -print-config it prints the effective settings and exits.
+func MustLoad(service string, cfg any) Effective {
+	effective, err := Load(service, cfg)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(0)
+	case errors.Is(err, errPrinted):
+		fmt.Print(effective.String())
+		os.Exit(0)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "%s: %v\n", service, err)
+		os.Exit(2)
+	}
+	return effective
+}
+
+var errPrinted = errors.New("effective config requested")
+
+func load(service string, cfg any, args []string, lookup func(string) (string, bool)) (Effective, error) {
+	root := reflect.ValueOf(cfg)
+	if root.Kind() != reflect.Pointer || root.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: Load needs a pointer to a struct, got %T", cfg)
+	}
+	settings, err := collect(root.Elem(), "")
+	if err != nil {
+		return nil, err
+	}
+
+	fs := flag.NewFlagSet(service, flag.ContinueOnError)
+	configFile := fs.String("config", "", "YAML or TOML config file (env CONFIG_FILE)")
+	printConfig := fs.Bool("print-config", false, "print the effective config and exit")
+	flags := make(map[string]*flagValue, len(settings))
+	for _, s := range settings {
+		v := &flagValue{isBool: s.value.Kind() == reflect.Bool}
+		flags[s.flag] = v
+		fs.Var(v, s.flag, s.help())
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("invalid arguments: unexpected %q", fs.Arg(0))
+	}
+
+	var problems []string
+	for _, s := range settings {
+		if s.hasDef {
+			s.raw, s.source = s.def, SourceDefault
+		}
+	}
+
+	path := *configFile
+	if path == "" {
+		path, _ = lookup("CONFIG_FILE")
+	}
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		byKey := make(map[string]*setting, len(settings))
+		for _, s := range settings {
+			byKey[s.key] = s
+		}
+		for _, key := range sortedKeys(values) {
+			s, ok := byKey[key]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: unknown setting in %s", key, path))
+				continue
+			}
+			s.raw, s.source, s.origin = values[key], SourceFile, path
+		}
+	}
+
+	dotenv, err := readDotEnv(".env")
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range settings {
+		for _, name := range s.env {
+			if raw, ok := lookup(name); ok {
+				s.raw, s.source, s.origin = raw, SourceEnv, name
+				break
+			}
+			if raw, ok := dotenv[name]; ok {
+				s.raw, s.source, s.origin = raw, SourceDotEnv, name
+				break
+			}
+		}
+		if v := flags[s.flag]; v.set {
+			s.raw, s.source, s.origin = v.value, SourceFlag, "-"+s.flag
+		}
+	}
+
+	for _, s := range settings {
+		if s.source == "" {
+			s.raw = ""
+		}
+		if err := s.assign(); err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if err := s.validate(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+
+	effective := newEffective(settings)
+	if *printConfig {
+		return effective, errPrinted
+	}
+	return effective, nil
+}
+
+// collect walks the struct v and returns its settings, prefixing keys with
+// prefix.
+func collect(v reflect.Value, prefix string) ([]*setting, error) {
+	var settings []*setting
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, ok := field.Tag.Lookup("config")
+		if name == "-" {
+			continue
+		}
+		if !ok {
+			name = lowerFirst(field.Name)
+		}
+		key := prefix + name
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			nested := key + "."
+			if field.Anonymous && !ok {
+				nested = prefix
+			}
+			children, err := collect(v.Field(i), nested)
+			if err != nil {
+				return nil, err
+			}
+			settings = append(settings, children...)
+			continue
+		}
+		if !supported(field.Type) {
+			return nil, fmt.Errorf("config: %s has unsupported type %s", key, field.Type)
+		}
+
+		s := &setting{
+			key:    key,
+			flag:   kebab(key),
+			usage:  field.Tag.Get("usage"),
+			secret: field.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		}
+		s.def, s.hasDef = field.Tag.Lookup("default")
+		if env := field.Tag.Get("env"); env != "" {
+			s.env = strings.Split(env, ",")
+		} else {
+			s.env = []string{strings.ToUpper(strings.ReplaceAll(kebab(key), "-", "_"))}
+		}
+		if rules := field.Tag.Get("validate"); rules != "" {
+			s.rules = strings.Split(rules, ",")
+		}
+		settings = append(settings, s)
+	}
+	return settings, nil
+}
+
+func supported(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// assign parses the raw value into the field.
+func (s *setting) assign() error {
+	v := s.value
+	raw := strings.TrimSpace(s.raw)
+	if raw == "" && v.Kind() != reflect.String {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	var err error
+	switch {
+	case v.Type() == durationType:
+		var d time.Duration
+		if d, err = time.ParseDuration(raw); err == nil {
+			v.SetInt(int64(d))
+		}
+	case v.Kind() == reflect.String:
+		v.SetString(s.raw)
+	case v.Kind() == reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(raw); err == nil {
+			v.SetBool(b)
+		}
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(raw, 10, 64); err == nil {
+			v.SetInt(n)
+		}
+	case v.Kind() == reflect.Uint || v.Kind() == reflect.Uint64:
+		var n uint64
+		if n, err = strconv.ParseUint(raw, 10, 64); err == nil {
+			v.SetUint(n)
+		}
+	case v.Kind() == reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(raw, 64); err == nil {
+			v.SetFloat(f)
+		}
+	case v.Kind() == reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s is not a valid %s", s.key, s.describe(), typeName(v.Type()))
+	}
+	return nil
+}
+
+// describe names the value and where it came from, masking secrets.
+func (s *setting) describe() string {
+	shown := strconv.Quote(s.raw)
+	if s.secret {
+		shown = "value"
+	}
+	switch s.source {
+	case SourceDefault:
+		return shown + " (default)"
+	case SourceFile:
+		return fmt.Sprintf("%s from %s", shown, s.origin)
+	case SourceFlag:
+		return fmt.Sprintf("%s from flag %s", shown, s.origin)
+	case "":
+		return shown
+	}
+	return fmt.Sprintf("%s from %s %s", shown, s.source, s.origin)
+}
+
+func (s *setting) help() string {
+	help := s.usage
+	if help == "" {
+		help = s.key
+	}
+	return fmt.Sprintf("%s (env %s)", help, strings.Join(s.env, " or "))
+}
+
+func typeName(t reflect.Type) string {
+	switch {
+	case t == durationType:
+		return "duration, e.g. 30s or 5m"
+	case t.Kind() == reflect.Bool:
+		return "boolean"
+	case t.Kind() == reflect.Int || t.Kind() == reflect.Int64:
+		return "integer"
+	case t.Kind() == reflect.Uint || t.Kind() == reflect.Uint64:
+		return "non-negative integer"
+	case t.Kind() == reflect.Float64:
+		return "number"
+	}
+	return t.String()
+}
+
+// flagValue records whether a flag was given, so unset flags do not
+// override the other layers.
+type flagValue struct {
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (f *flagValue) String() string { return f.value }
+
+func (f *flagValue) Set(value string) error {
+	f.value, f.set = value, true
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
+
+// kebab turns a dotted camelCase key such as "health.maxHeadAge" into
+// "health-max-head-age".
+func kebab(key string) string {
+	var b strings.Builder
+	runes := []rune(key)
+	for i, r := range runes {
+		switch {
+		case r == '.' || r == '_':
+			b.WriteRune('-')
+		case unicode.IsUpper(r):
+			// Break before an upper-case letter that starts a word, keeping
+			// acronyms such as URLs together
+			if i > 0 && runes[i-1] != '.' && (unicode.IsLower(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && runes[i+1] != 's')) {
+				b.WriteRune('-')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	runes := []rune(s)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	// "RPC" becomes "rpc", "URLs" becomes "urls", "MaxLag" becomes "maxLag"
+	if upper > 1 && upper < len(runes) && runes[upper] != 's' {
+		upper--
+	}
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
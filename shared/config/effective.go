@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+)
+
+const masked = "****"
+
+// Setting is one effective setting, with secrets masked.
+type Setting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// Effective lists the settings a service runs with, in declaration order.
+type Effective []Setting
+
+func newEffective(settings []*setting) Effective {
+	effective := make(Effective, 0, len(settings))
+	for _, s := range settings {
+		source := s.source
+		if source == "" {
+			source = "unset"
+		} else if s.origin != "" && source != SourceDefault {
+			source += " " + s.origin
+		}
+		effective = append(effective, Setting{Key: s.key, Value: s.shown(), Source: source})
+	}
+	return effective
+}
+
+// shown is the value as it may be logged: secrets are masked and passwords
+// are removed from URLs.
+func (s *setting) shown() string {
+	value := fmt.Sprint(s.value.Interface())
+	if items, ok := s.value.Interface().([]string); ok {
+		value = strings.Join(items, ",")
+	}
+	if value == "" {
+		return ""
+	}
+	if s.secret {
+		return masked
+	}
+	for _, rule := range s.rules {
+		if rule != "url" {
+			continue
+		}
+		items := strings.Split(value, ",")
+		for i, item := range items {
+			if u, err := url.Parse(item); err == nil {
+				items[i] = u.Redacted()
+			}
+		}
+		return strings.Join(items, ",")
+	}
+	return value
+}
+
+// Map returns the settings by key, for logging and status pages.
+func (e Effective) Map() map[string]string {
+	m := make(map[string]string, len(e))
+	for _, s := range e {
+		m[s.Key] = s.Value
+	}
+	return m
+}
+
+// String formats the settings as a table of key, value and source.
+func (e Effective) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+	for _, s := range e {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, s.Value, s.Source)
+	}
+	w.Flush()
+	return b.String()
+}
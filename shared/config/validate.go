@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var (
+	addressPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+	hexKeyPattern  = regexp.MustCompile(`^(0x)?[0-9a-fA-F]{64}$`)
+)
+
+// validate applies the setting's rules. Rules other than required and port
+// pass when the setting is empty.
+func (s *setting) validate() error {
+	empty := s.value.IsZero()
+	for _, rule := range s.rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		if name == "required" {
+			if empty {
+				return fmt.Errorf("%s is required, set %s or -%s", s.key, strings.Join(s.env, " or "), s.flag)
+			}
+			continue
+		}
+		if name == "port" && s.value.Kind() == reflect.Int {
+			if port := s.value.Int(); port < 1 || port > 65535 {
+				return fmt.Errorf("%s: %d is not a port between 1 and 65535", s.key, port)
+			}
+			continue
+		}
+		if empty {
+			continue
+		}
+		var values []string
+		switch s.value.Kind() {
+		case reflect.Slice:
+			values = s.value.Interface().([]string)
+		case reflect.String:
+			values = []string{s.value.String()}
+		default:
+			return fmt.Errorf("config: rule %s does not apply to %s", name, s.key)
+		}
+		for _, value := range values {
+			if err := check(name, arg, value); err != nil {
+				return fmt.Errorf("%s: %s %s", s.key, s.quoted(value), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *setting) quoted(value string) string {
+	if s.secret {
+		return "value"
+	}
+	return fmt.Sprintf("%q", value)
+}
+
+func check(rule, arg, value string) error {
+	switch rule {
+	case "address":
+		if !addressPattern.MatchString(value) {
+			return fmt.Errorf("is not an address, want 0x and 40 hex digits")
+		}
+	case "hexkey":
+		if !hexKeyPattern.MatchString(value) {
+			return fmt.Errorf("is not a private key, want 64 hex digits")
+		}
+	case "url":
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("is not an absolute URL")
+		}
+	case "oneof":
+		options := strings.Split(arg, "|")
+		for _, option := range options {
+			if strings.EqualFold(value, option) {
+				return nil
+			}
+		}
+		return fmt.Errorf("is not one of %s", strings.Join(options, ", "))
+	default:
+		return fmt.Errorf("has unknown rule %s", rule)
+	}
+	return nil
+}
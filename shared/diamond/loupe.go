@@ -0,0 +1,190 @@
+package diamond
+
+import (
+	"context"
+	"fmt"
+	"shared/logging"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var logger = logging.For("diamond")
+
+// loupeABI holds the parts of the EIP-2535 DiamondLoupe and DiamondCut
+// interfaces the services rely on.
+const loupeABI = `[
+    {
+      "inputs": [],
+      "name": "facets",
+      "outputs": [
+        {
+          "components": [
+            {
+              "internalType": "address",
+              "name": "facetAddress",
+              "type": "address"
+            },
+            {
+              "internalType": "bytes4[]",
+              "name": "functionSelectors",
+              "type": "bytes4[]"
+            }
+          ],
+          "internalType": "struct IDiamondLoupe.Facet[]",
+          "name": "facets_",
+          "type": "tuple[]"
+        }
+      ],
+      "stateMutability": "view",
+      "type": "function"
+    },
+    {
+      "inputs": [],
+      "name": "facetAddresses",
+      "outputs": [
+        {
+          "internalType": "address[]",
+          "name": "facetAddresses_",
+          "type": "address[]"
+        }
+      ],
+      "stateMutability": "view",
+      "type": "function"
+    },
+    {
+      "anonymous": false,
+      "inputs": [
+        {
+          "components": [
+            {
+              "internalType": "address",
+              "name": "facetAddress",
+              "type": "address"
+            },
+            {
+              "internalType": "enum IDiamondCut.FacetCutAction",
+              "name": "action",
+              "type": "uint8"
+            },
+            {
+              "internalType": "bytes4[]",
+              "name": "functionSelectors",
+              "type": "bytes4[]"
+            }
+          ],
+          "indexed": false,
+          "internalType": "struct IDiamondCut.FacetCut[]",
+          "name": "_diamondCut",
+          "type": "tuple[]"
+        },
+        {
+          "indexed": false,
+          "internalType": "address",
+          "name": "_init",
+          "type": "address"
+        },
+        {
+          "indexed": false,
+          "internalType": "bytes",
+          "name": "_calldata",
+          "type": "bytes"
+        }
+      ],
+      "name": "DiamondCut",
+      "type": "event"
+    }
+  ]`
+
+var loupe = mustParse(loupeABI)
+
+// DiamondCutTopic is the topic of the DiamondCut event.
+var DiamondCutTopic = loupe.Events["DiamondCut"].ID
+
+// Facet is one facet of a diamond as reported by the loupe.
+type Facet struct {
+	Address   string   `json:"address"`
+	Names     []string `json:"names"`
+	Selectors []string `json:"selectors"`
+	Unknown   []string `json:"unknownSelectors,omitempty"`
+}
+
+// Layout is a diamond's facets matched against the registry, together with
+// the ABI built from the matched facets.
+type Layout struct {
+	Address string  `json:"address"`
+	Facets  []Facet `json:"facets"`
+	ABI     abi.ABI `json:"-"`
+}
+
+// loupeFacet matches the IDiamondLoupe.Facet struct.
+type loupeFacet struct {
+	FacetAddress      common.Address
+	FunctionSelectors [][4]byte
+}
+
+// Discover asks the diamond for its facets and matches their selectors
+// against the registry. Selectors no registry facet declares are reported in
+// the layout and logged as warnings.
+func Discover(ctx context.Context, caller bind.ContractCaller, address common.Address, registry *Registry) (*Layout, error) {
+	data, err := loupe.Pack("facets")
+	if err != nil {
+		return nil, err
+	}
+	res, err := caller.CallContract(ctx, ethereum.CallMsg{To: &address, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call facets(): %w", err)
+	}
+	out, err := loupe.Unpack("facets", res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode facets(): %w", err)
+	}
+	facets := *abi.ConvertType(out[0], new([]loupeFacet)).(*[]loupeFacet)
+
+	layout := &Layout{Address: address.Hex()}
+	matched := map[string]bool{}
+	for _, f := range facets {
+		facet := Facet{Address: f.FacetAddress.Hex(), Names: []string{}, Selectors: []string{}}
+		names := map[string]bool{}
+		for _, selector := range f.FunctionSelectors {
+			hex := fmt.Sprintf("0x%x", selector)
+			facet.Selectors = append(facet.Selectors, hex)
+			name, ok := registry.selectors[selector]
+			if !ok {
+				facet.Unknown = append(facet.Unknown, hex)
+				continue
+			}
+			if !names[name] {
+				names[name] = true
+				facet.Names = append(facet.Names, name)
+			}
+			matched[name] = true
+		}
+		if len(facet.Unknown) > 0 {
+			logger.Warn("Facet has selectors not in the ABI registry",
+				"facet", facet.Address, "count", len(facet.Unknown), "selectors", strings.Join(facet.Unknown, ", "))
+		}
+		layout.Facets = append(layout.Facets, facet)
+	}
+
+	var names []string
+	for name := range matched {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		logger.Warn("None of the diamond's facets are in the ABI registry", "diamond", address.Hex())
+	}
+	layout.ABI = registry.merge(names)
+	return layout, nil
+}
+
+func mustParse(raw string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(raw))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
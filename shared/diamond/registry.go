@@ -0,0 +1,86 @@
+package diamond
+
+import (
+	"path/filepath"
+	"shared/watch"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// Registry is the local set of known facet ABIs, indexed by function selector.
+type Registry struct {
+	facets    map[string]abi.ABI
+	selectors map[[4]byte]string
+}
+
+// NewRegistry builds a registry from named facet ABIs.
+func NewRegistry(facets map[string]abi.ABI) *Registry {
+	r := &Registry{
+		facets:    make(map[string]abi.ABI),
+		selectors: make(map[[4]byte]string),
+	}
+	for name, facetABI := range facets {
+		r.Add(name, facetABI)
+	}
+	return r
+}
+
+// Add registers a facet ABI under name.
+func (r *Registry) Add(name string, facetABI abi.ABI) {
+	r.facets[name] = facetABI
+	for _, method := range facetABI.Methods {
+		r.selectors[[4]byte(method.ID)] = name
+	}
+}
+
+// LoadDir registers every *.json ABI or artifact in dir, named after the file.
+func (r *Registry) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		facetABI, err := watch.LoadABI(path)
+		if err != nil {
+			return err
+		}
+		r.Add(strings.TrimSuffix(filepath.Base(path), ".json"), facetABI)
+	}
+	return nil
+}
+
+// merge combines the named facets into one ABI. Facets are applied in name
+// order so the result is stable.
+func (r *Registry) merge(names []string) abi.ABI {
+	sort.Strings(names)
+	merged := abi.ABI{
+		Methods: make(map[string]abi.Method),
+		Events:  make(map[string]abi.Event),
+		Errors:  make(map[string]abi.Error),
+	}
+	for _, name := range names {
+		facetABI := r.facets[name]
+		for k, v := range facetABI.Methods {
+			merged.Methods[k] = v
+		}
+		for k, v := range facetABI.Events {
+			merged.Events[k] = v
+		}
+		for k, v := range facetABI.Errors {
+			merged.Errors[k] = v
+		}
+	}
+	return merged
+}
+
+// Names returns the registered facet names in order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.facets))
+	for name := range r.facets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
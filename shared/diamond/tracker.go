@@ -0,0 +1,129 @@
+package diamond
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Backend is the node access the tracker needs.
+type Backend interface {
+	bind.ContractCaller
+	ethereum.LogFilterer
+	BlockNumber(ctx context.Context) (uint64, error)
+}
+
+// Tracker keeps a diamond's layout current by re-running discovery whenever
+// the diamond emits DiamondCut.
+type Tracker struct {
+	backend  Backend
+	address  common.Address
+	registry *Registry
+	next     uint64 // first block not yet checked for DiamondCut
+
+	mu       sync.Mutex
+	layout   *Layout
+	onChange []func(abi.ABI)
+}
+
+// NewTracker discovers the diamond's current layout.
+func NewTracker(ctx context.Context, backend Backend, address common.Address, registry *Registry) (*Tracker, error) {
+	// Read the head first: a cut after it is either already reflected in the
+	// discovered layout or picked up by Run
+	head, err := backend.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := Discover(ctx, backend, address, registry)
+	if err != nil {
+		return nil, err
+	}
+	return &Tracker{backend: backend, address: address, registry: registry, next: head + 1, layout: layout}, nil
+}
+
+// Layout returns the most recently discovered layout.
+func (t *Tracker) Layout() *Layout {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.layout
+}
+
+// OnChange registers fn to receive the rebuilt ABI after every DiamondCut.
+func (t *Tracker) OnChange(fn func(abi.ABI)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onChange = append(t.onChange, fn)
+}
+
+// Run polls for DiamondCut events every interval until ctx is cancelled.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		head, err := t.backend.BlockNumber(ctx)
+		if err != nil {
+			logger.Warn("Failed to get latest block number", "err", err)
+			continue
+		}
+		if head < t.next {
+			continue
+		}
+
+		logs, err := t.backend.FilterLogs(ctx, ethereum.FilterQuery{
+			Addresses: []common.Address{t.address},
+			Topics:    [][]common.Hash{{DiamondCutTopic}},
+			FromBlock: new(big.Int).SetUint64(t.next),
+			ToBlock:   new(big.Int).SetUint64(head),
+		})
+		if err != nil {
+			logger.Warn("Failed to check for DiamondCut events", "err", err)
+			continue
+		}
+		if len(logs) > 0 {
+			logger.Info("DiamondCut seen, reloading facets", "block", logs[len(logs)-1].BlockNumber, "diamond", t.address.Hex())
+			if err := t.reload(ctx); err != nil {
+				logger.Error("Failed to reload facets", "err", err)
+				continue
+			}
+		}
+		t.next = head + 1
+	}
+}
+
+func (t *Tracker) reload(ctx context.Context) error {
+	layout, err := Discover(ctx, t.backend, t.address, t.registry)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.layout = layout
+	onChange := append([]func(abi.ABI){}, t.onChange...)
+	t.mu.Unlock()
+
+	for _, fn := range onChange {
+		fn(layout.ABI)
+	}
+	return nil
+}
+
+// Routes exposes the current layout.
+func (t *Tracker) Routes(router fiber.Router) {
+	router.Get("/diamond/facets", func(c *fiber.Ctx) error {
+		return c.JSON(t.Layout())
+	})
+}
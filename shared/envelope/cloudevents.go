@@ -0,0 +1,51 @@
+package envelope
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// CloudEvents content types.
+const (
+	ContentTypeJSON       = "application/json"
+	ContentTypeCloudEvent = "application/cloudevents+json"
+)
+
+// TypePrefix starts the CloudEvents type of every event, followed by the
+// event name.
+const TypePrefix = "ethereum.event."
+
+// CloudEventAttributes returns the envelope's CloudEvents 1.0 context
+// attributes, datacontenttype included. In binary mode transports send them
+// as headers, each under its binding's prefix, with the envelope as body.
+// Replayed events also carry the replay extension attribute.
+func (e Envelope) CloudEventAttributes() map[string]string {
+	attributes := map[string]string{
+		"specversion":     "1.0",
+		"id":              e.ID,
+		"source":          "eip155:" + strconv.FormatUint(e.ChainID, 10) + ":" + e.Address,
+		"type":            TypePrefix + e.EventName,
+		"subject":         e.Contract,
+		"datacontenttype": ContentTypeJSON,
+		"dataschema":      SchemaID,
+	}
+	if e.BlockTimestamp != 0 {
+		attributes["time"] = time.Unix(int64(e.BlockTimestamp), 0).UTC().Format(time.RFC3339)
+	}
+	if e.Replay != "" {
+		attributes["replay"] = e.Replay
+	}
+	return attributes
+}
+
+// StructuredCloudEvent encodes a structured-mode CloudEvent with the given
+// context attributes and data, which must be JSON.
+func StructuredCloudEvent(attributes map[string]string, data []byte) ([]byte, error) {
+	event := make(map[string]interface{}, len(attributes)+1)
+	for name, value := range attributes {
+		event[name] = value
+	}
+	event["data"] = json.RawMessage(data)
+	return json.Marshal(event)
+}
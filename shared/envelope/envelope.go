@@ -0,0 +1,130 @@
+// Package envelope defines the versioned envelope the publisher wraps every
+// contract event in, and its CloudEvents 1.0 representation. It is JSON by
+// default, or Protobuf (see package codec) when a sink asks for it.
+//
+// The envelope's JSON Schema is embedded (see Schema); the publisher serves
+// it, with a schema per event generated from the ABIs, under /schemas.
+package envelope
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"shared/codec"
+	"strings"
+)
+
+// SchemaVersion is the version of the envelope. Changes that only add
+// fields bump the minor version; consumers should accept any 1.x.
+const SchemaVersion = "1.1"
+
+// SchemaID identifies the envelope's JSON Schema, and is the CloudEvents
+// dataschema of the events.
+const SchemaID = "urn:contract-events:envelope:1.1"
+
+// Envelope is one contract event.
+type Envelope struct {
+	// ID is "<chainId>:<transactionHash>:<logIndex>", unique across chains
+	// and stable across redeliveries and replays.
+	ID            string `json:"id"`
+	SchemaVersion string `json:"schemaVersion"`
+	ChainID       uint64 `json:"chainId"`
+
+	// Contract is the name the publisher watches the emitting contract
+	// under, Address its address.
+	Contract  string `json:"contract"`
+	Address   string `json:"address"`
+	EventName string `json:"eventName"`
+	// Signature is the event's canonical signature, such as
+	// "ProposalApproved(uint256)".
+	Signature string `json:"signature"`
+
+	BlockNumber uint64 `json:"blockNumber"`
+	BlockHash   string `json:"blockHash"`
+	// BlockTimestamp is in Unix seconds, omitted if the block could not be
+	// fetched.
+	BlockTimestamp   uint64 `json:"blockTimestamp,omitempty"`
+	TransactionHash  string `json:"transactionHash"`
+	TransactionIndex uint   `json:"transactionIndex"`
+	LogIndex         uint   `json:"logIndex"`
+	From             string `json:"from,omitempty"`
+
+	// Replay is the ID of the replay that published the event again, empty
+	// for live events. Since 1.1.
+	Replay string `json:"replay,omitempty"`
+
+	// Args are the event's arguments by name, encoded by ABI type:
+	// integers as decimal strings, addresses checksummed, bytes as 0x hex,
+	// arrays as arrays and tuples as objects. Indexed arguments of dynamic
+	// types are the 0x hex keccak256 hash the log carries instead.
+	Args map[string]json.RawMessage `json:"args"`
+}
+
+// ID returns the envelope ID of a log.
+func ID(chainID uint64, transactionHash string, logIndex uint) string {
+	return fmt.Sprintf("%d:%s:%d", chainID, transactionHash, logIndex)
+}
+
+// UnmarshalJSON also reads the payloads published before the envelope was
+// versioned, which carried the arguments under "data". Their SchemaVersion
+// is empty.
+func (e *Envelope) UnmarshalJSON(raw []byte) error {
+	type plain Envelope
+	var v struct {
+		plain
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return err
+	}
+	*e = Envelope(v.plain)
+	if e.Args == nil && v.Data != nil {
+		e.Args = v.Data
+	}
+	return nil
+}
+
+// Decode reads an envelope from a message body, either bare (as published
+// by default and in CloudEvents binary mode) or as the data of a structured
+// CloudEvent.
+func Decode(body []byte) (Envelope, error) {
+	var probe struct {
+		SpecVersion string          `json:"specversion"`
+		Data        json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return Envelope{}, err
+	}
+	if probe.SpecVersion != "" {
+		if probe.Data == nil {
+			return Envelope{}, errors.New("cloud event has no data")
+		}
+		body = probe.Data
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return Envelope{}, err
+	}
+	return env, checkVersion(env)
+}
+
+// DecodeContent reads an envelope from a message body encoded in
+// contentType: Protobuf, or JSON as Decode reads it.
+func DecodeContent(contentType string, body []byte) (Envelope, error) {
+	if !codec.IsProtobuf(contentType) {
+		return Decode(body)
+	}
+	var env Envelope
+	if err := codec.Unmarshal(contentType, body, &env); err != nil {
+		return Envelope{}, err
+	}
+	return env, checkVersion(env)
+}
+
+func checkVersion(env Envelope) error {
+	if major, _, _ := strings.Cut(env.SchemaVersion, "."); env.SchemaVersion != "" && major != "1" {
+		return fmt.Errorf("unsupported schema version %s", env.SchemaVersion)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package envelope
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var approved = Envelope{
+	ID:              ID(1337, "0xabc", 2),
+	SchemaVersion:   SchemaVersion,
+	ChainID:         1337,
+	Contract:        "diamond",
+	Address:         "0xD1A",
+	EventName:       "ProposalApproved",
+	Signature:       "ProposalApproved(uint256)",
+	BlockTimestamp:  1700000000,
+	TransactionHash: "0xabc",
+	LogIndex:        2,
+	Args:            map[string]json.RawMessage{"proposalId": json.RawMessage(`"3"`)},
+}
+
+func TestDecode(t *testing.T) {
+	body, err := json.Marshal(approved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	structured, err := StructuredCloudEvent(approved.CloudEventAttributes(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, body := range map[string]string{
+		"bare":       string(body),
+		"structured": string(structured),
+		"legacy":     `{"eventName":"ProposalApproved","data":{"proposalId":"3"},"transactionHash":"0xabc","logIndex":2}`,
+	} {
+		env, err := Decode([]byte(body))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if env.EventName != "ProposalApproved" || string(env.Args["proposalId"]) != `"3"` || env.LogIndex != 2 {
+			t.Errorf("%s: decoded %+v", name, env)
+		}
+	}
+
+	for _, body := range []string{
+		`{"schemaVersion":"2.0","eventName":"ProposalApproved"}`,
+		`{"specversion":"1.0","id":"x"}`,
+		`not json`,
+	} {
+		if _, err := Decode([]byte(body)); err == nil {
+			t.Errorf("decoded %s", body)
+		}
+	}
+}
+
+func TestCloudEventAttributes(t *testing.T) {
+	attributes := approved.CloudEventAttributes()
+	for name, want := range map[string]string{
+		"id":          "1337:0xabc:2",
+		"source":      "eip155:1337:0xD1A",
+		"type":        "ethereum.event.ProposalApproved",
+		"subject":     "diamond",
+		"dataschema":  SchemaID,
+		"time":        "2023-11-14T22:13:20Z",
+		"specversion": "1.0",
+	} {
+		if attributes[name] != want {
+			t.Errorf("%s = %q, want %q", name, attributes[name], want)
+		}
+	}
+	if _, ok := attributes["replay"]; ok {
+		t.Error("live event marked as replayed")
+	}
+
+	replayed := approved
+	replayed.Replay = "r1"
+	if got := replayed.CloudEventAttributes()["replay"]; got != "r1" {
+		t.Errorf("replay = %q", got)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	for _, name := range []string{"envelope", "cloudevent"} {
+		raw, ok := Schema(name)
+		var schema struct {
+			ID string `json:"$id"`
+		}
+		if !ok || json.Unmarshal(raw, &schema) != nil || schema.ID == "" {
+			t.Errorf("schema %s: %s", name, raw)
+		}
+	}
+	if _, ok := Schema("../envelope"); ok {
+		t.Error("read outside the schemas")
+	}
+}
@@ -0,0 +1,62 @@
+package envelope
+
+import (
+	"encoding/json"
+	contracteventsv1 "shared/codec/proto/contractevents/v1"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Proto returns the envelope as the message generated from
+// codec/proto/contractevents/v1/envelope.proto. Each argument is its JSON
+// value as text.
+func (e Envelope) Proto() proto.Message {
+	args := make(map[string]string, len(e.Args))
+	for name, value := range e.Args {
+		args[name] = string(value)
+	}
+	return &contracteventsv1.Envelope{
+		Id:               e.ID,
+		SchemaVersion:    e.SchemaVersion,
+		ChainId:          e.ChainID,
+		Contract:         e.Contract,
+		Address:          e.Address,
+		EventName:        e.EventName,
+		Signature:        e.Signature,
+		BlockNumber:      e.BlockNumber,
+		BlockHash:        e.BlockHash,
+		BlockTimestamp:   e.BlockTimestamp,
+		TransactionHash:  e.TransactionHash,
+		TransactionIndex: uint32(e.TransactionIndex),
+		LogIndex:         uint32(e.LogIndex),
+		From:             e.From,
+		Args:             args,
+		Replay:           e.Replay,
+	}
+}
+
+// SetProto sets the envelope from a decoded Protobuf envelope.
+func (e *Envelope) SetProto(m proto.Message) {
+	p := m.(*contracteventsv1.Envelope)
+	*e = Envelope{
+		ID:               p.Id,
+		SchemaVersion:    p.SchemaVersion,
+		ChainID:          p.ChainId,
+		Contract:         p.Contract,
+		Address:          p.Address,
+		EventName:        p.EventName,
+		Signature:        p.Signature,
+		BlockNumber:      p.BlockNumber,
+		BlockHash:        p.BlockHash,
+		BlockTimestamp:   p.BlockTimestamp,
+		TransactionHash:  p.TransactionHash,
+		TransactionIndex: uint(p.TransactionIndex),
+		LogIndex:         uint(p.LogIndex),
+		From:             p.From,
+		Args:             make(map[string]json.RawMessage, len(p.Args)),
+		Replay:           p.Replay,
+	}
+	for name, value := range p.Args {
+		e.Args[name] = json.RawMessage(value)
+	}
+}
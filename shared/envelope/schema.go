@@ -0,0 +1,19 @@
+package envelope
+
+import (
+	"embed"
+	"strings"
+)
+
+//go:embed schemas/*.json
+var schemas embed.FS
+
+// Schema returns an embedded JSON Schema by name: "envelope" or
+// "cloudevent".
+func Schema(name string) ([]byte, bool) {
+	if strings.ContainsAny(name, "/.") {
+		return nil, false
+	}
+	raw, err := schemas.ReadFile("schemas/" + name + ".json")
+	return raw, err == nil
+}
@@ -0,0 +1,308 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("shared/failover")
+
+// ErrNoWebSocket is returned for subscriptions when no websocket endpoint is
+// configured at all, so callers can fall back to polling.
+var ErrNoWebSocket = errors.New("no websocket RPC endpoint configured")
+
+// Config tunes the endpoint pool. Zero values use the defaults.
+type Config struct {
+	URLs          []string
+	CheckInterval time.Duration // how often endpoints are probed, default 10s
+	Timeout       time.Duration // per probe, default 5s
+	MaxLag        uint64        // blocks an endpoint may trail the best head, default 5
+}
+
+// Client is an Ethereum client backed by several RPC endpoints. Every call
+// goes to the healthiest endpoint and fails over to the next one on
+// transport errors. It implements bind.ContractBackend and bind.DeployBackend.
+type Client struct {
+	cfg       Config
+	endpoints []*endpoint
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// Dial connects to every configured endpoint and starts health checking. It
+// fails only if no endpoint can be reached; the others are redialed by the
+// health checks.
+func Dial(cfg Config) (*Client, error) {
+	if len(cfg.URLs) == 0 {
+		return nil, fmt.Errorf("no RPC endpoints configured")
+	}
+	if cfg.CheckInterval == 0 {
+		cfg.CheckInterval = 10 * time.Second
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.MaxLag == 0 {
+		cfg.MaxLag = 5
+	}
+
+	c := &Client{cfg: cfg, stop: make(chan struct{})}
+	for _, url := range cfg.URLs {
+		c.endpoints = append(c.endpoints, newEndpoint(url))
+	}
+
+	c.check()
+	connected := false
+	for _, ep := range c.endpoints {
+		if ep.connected() {
+			connected = true
+		}
+	}
+	if !connected {
+		return nil, fmt.Errorf("failed to connect to any of %d RPC endpoints", len(c.endpoints))
+	}
+
+	go c.monitor()
+	return c, nil
+}
+
+// Close stops health checking and closes every endpoint. Calling it again
+// does nothing.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		for _, ep := range c.endpoints {
+			ep.close()
+		}
+	})
+}
+
+// do runs fn against the endpoints in order of health until one succeeds or
+// fails with an error another endpoint would return too. Calls made within a
+// trace get a client span named after the RPC method; background calls
+// without one are not traced.
+func do[T any](c *Client, ctx context.Context, method string, websocket bool, fn func(*ethclient.Client) (T, error)) (result T, err error) {
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		var span trace.Span
+		ctx, span = tracer.Start(ctx, method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("rpc.system", "jsonrpc"),
+				attribute.String("rpc.method", method),
+			),
+		)
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
+	var zero T
+	var errs []error
+	ranked := c.ranked(websocket)
+	if websocket && len(ranked) == 0 {
+		return zero, ErrNoWebSocket
+	}
+	for _, ep := range ranked {
+		client := ep.get()
+		if client == nil {
+			continue
+		}
+		start := time.Now()
+		result, err := fn(client)
+		ep.record(time.Since(start), err)
+		if err == nil || !isTransportError(err) || ctx.Err() != nil {
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("server.address", redact(ep.url)))
+			return result, err
+		}
+		trace.SpanFromContext(ctx).AddEvent("failover", trace.WithAttributes(
+			attribute.String("server.address", redact(ep.url)),
+			attribute.String("error", err.Error()),
+		))
+		errs = append(errs, fmt.Errorf("%s: %w", redact(ep.url), err))
+	}
+	if len(errs) == 0 {
+		if websocket {
+			return zero, fmt.Errorf("no connected websocket RPC endpoint")
+		}
+		return zero, fmt.Errorf("no connected RPC endpoint")
+	}
+	return zero, fmt.Errorf("all RPC endpoints failed: %w", errors.Join(errs...))
+}
+
+// isTransportError reports whether err came from reaching the endpoint rather
+// than from the request itself. Only transport errors trigger failover; a
+// revert or a missing transaction would be the same on every node.
+func isTransportError(err error) bool {
+	if errors.Is(err, ethereum.NotFound) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var rpcErr rpc.Error
+	return !errors.As(err, &rpcErr)
+}
+
+// BlockNumber returns the most recent block number.
+func (c *Client) BlockNumber(ctx context.Context) (uint64, error) {
+	return do(c, ctx, "eth_blockNumber", false, func(ec *ethclient.Client) (uint64, error) {
+		return ec.BlockNumber(ctx)
+	})
+}
+
+// ChainID returns the chain ID.
+func (c *Client) ChainID(ctx context.Context) (*big.Int, error) {
+	return do(c, ctx, "eth_chainId", false, func(ec *ethclient.Client) (*big.Int, error) {
+		return ec.ChainID(ctx)
+	})
+}
+
+// HeaderByNumber returns a block header; nil number means the latest block.
+func (c *Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return do(c, ctx, "eth_getBlockByNumber", false, func(ec *ethclient.Client) (*types.Header, error) {
+		return ec.HeaderByNumber(ctx, number)
+	})
+}
+
+// HeaderByHash returns the header of the block with the given hash.
+func (c *Client) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return do(c, ctx, "eth_getBlockByHash", false, func(ec *ethclient.Client) (*types.Header, error) {
+		return ec.HeaderByHash(ctx, hash)
+	})
+}
+
+// TransactionByHash returns a transaction and whether it is still pending.
+func (c *Client) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	type result struct {
+		tx      *types.Transaction
+		pending bool
+	}
+	r, err := do(c, ctx, "eth_getTransactionByHash", false, func(ec *ethclient.Client) (result, error) {
+		tx, pending, err := ec.TransactionByHash(ctx, hash)
+		return result{tx, pending}, err
+	})
+	return r.tx, r.pending, err
+}
+
+// TransactionSender returns the sender of a mined transaction.
+func (c *Client) TransactionSender(ctx context.Context, tx *types.Transaction, block common.Hash, index uint) (common.Address, error) {
+	return do(c, ctx, "eth_getTransactionByBlockHashAndIndex", false, func(ec *ethclient.Client) (common.Address, error) {
+		return ec.TransactionSender(ctx, tx, block, index)
+	})
+}
+
+// TransactionReceipt returns the receipt of a mined transaction.
+func (c *Client) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	return do(c, ctx, "eth_getTransactionReceipt", false, func(ec *ethclient.Client) (*types.Receipt, error) {
+		return ec.TransactionReceipt(ctx, hash)
+	})
+}
+
+// BalanceAt returns the account balance at the given block.
+func (c *Client) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	return do(c, ctx, "eth_getBalance", false, func(ec *ethclient.Client) (*big.Int, error) {
+		return ec.BalanceAt(ctx, account, blockNumber)
+	})
+}
+
+// CodeAt returns the contract code at the given block.
+func (c *Client) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	return do(c, ctx, "eth_getCode", false, func(ec *ethclient.Client) ([]byte, error) {
+		return ec.CodeAt(ctx, account, blockNumber)
+	})
+}
+
+// CallContract executes a message call without creating a transaction.
+func (c *Client) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return do(c, ctx, "eth_call", false, func(ec *ethclient.Client) ([]byte, error) {
+		return ec.CallContract(ctx, call, blockNumber)
+	})
+}
+
+// CallContractAtHash executes a message call against the state of the block
+// with the given hash, which stays the same if the chain reorganises.
+func (c *Client) CallContractAtHash(ctx context.Context, call ethereum.CallMsg, blockHash common.Hash) ([]byte, error) {
+	return do(c, ctx, "eth_call", false, func(ec *ethclient.Client) ([]byte, error) {
+		return ec.CallContractAtHash(ctx, call, blockHash)
+	})
+}
+
+// PendingCodeAt returns the contract code in the pending state.
+func (c *Client) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	return do(c, ctx, "eth_getCode", false, func(ec *ethclient.Client) ([]byte, error) {
+		return ec.PendingCodeAt(ctx, account)
+	})
+}
+
+// PendingNonceAt returns the account nonce in the pending state.
+func (c *Client) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return do(c, ctx, "eth_getTransactionCount", false, func(ec *ethclient.Client) (uint64, error) {
+		return ec.PendingNonceAt(ctx, account)
+	})
+}
+
+// SuggestGasPrice returns the suggested legacy gas price.
+func (c *Client) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return do(c, ctx, "eth_gasPrice", false, func(ec *ethclient.Client) (*big.Int, error) {
+		return ec.SuggestGasPrice(ctx)
+	})
+}
+
+// SuggestGasTipCap returns the suggested EIP-1559 tip cap.
+func (c *Client) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return do(c, ctx, "eth_maxPriorityFeePerGas", false, func(ec *ethclient.Client) (*big.Int, error) {
+		return ec.SuggestGasTipCap(ctx)
+	})
+}
+
+// EstimateGas estimates the gas needed for a call.
+func (c *Client) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return do(c, ctx, "eth_estimateGas", false, func(ec *ethclient.Client) (uint64, error) {
+		return ec.EstimateGas(ctx, call)
+	})
+}
+
+// SendTransaction broadcasts a signed transaction. If a failed-over attempt
+// finds the transaction already known, the earlier attempt reached a node
+// and the send counts as successful.
+func (c *Client) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	_, err := do(c, ctx, "eth_sendRawTransaction", false, func(ec *ethclient.Client) (struct{}, error) {
+		err := ec.SendTransaction(ctx, tx)
+		if err != nil && strings.Contains(strings.ToLower(err.Error()), "already known") {
+			err = nil
+		}
+		return struct{}{}, err
+	})
+	return err
+}
+
+// FilterLogs executes a log filter query.
+func (c *Client) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return do(c, ctx, "eth_getLogs", false, func(ec *ethclient.Client) ([]types.Log, error) {
+		return ec.FilterLogs(ctx, q)
+	})
+}
+
+// SubscribeFilterLogs subscribes on the healthiest websocket endpoint. The
+// subscription stays on that endpoint; callers resubscribe when it fails.
+func (c *Client) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return do(c, ctx, "eth_subscribe", true, func(ec *ethclient.Client) (ethereum.Subscription, error) {
+		return ec.SubscribeFilterLogs(ctx, q, ch)
+	})
+}
@@ -0,0 +1,301 @@
+package failover
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/gofiber/fiber/v2"
+)
+
+// errorDecay weighs each new outcome in the moving error rate.
+const errorDecay = 0.2
+
+type endpoint struct {
+	url       string
+	websocket bool
+
+	mu        sync.Mutex
+	client    *ethclient.Client
+	head      uint64
+	latency   time.Duration
+	errorRate float64
+	lastErr   error
+	lastCheck time.Time
+	healthy   bool
+}
+
+func newEndpoint(rawURL string) *endpoint {
+	lower := strings.ToLower(rawURL)
+	return &endpoint{
+		url:       rawURL,
+		websocket: strings.HasPrefix(lower, "ws://") || strings.HasPrefix(lower, "wss://"),
+	}
+}
+
+func (ep *endpoint) get() *ethclient.Client {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	return ep.client
+}
+
+func (ep *endpoint) connected() bool {
+	return ep.get() != nil
+}
+
+func (ep *endpoint) close() {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if ep.client != nil {
+		ep.client.Close()
+		ep.client = nil
+	}
+}
+
+// record folds the outcome of a call into the endpoint's latency and error rate.
+func (ep *endpoint) record(latency time.Duration, err error) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	failed := 0.0
+	if err != nil && isTransportError(err) {
+		failed = 1
+		ep.lastErr = err
+	}
+	ep.errorRate = ep.errorRate*(1-errorDecay) + failed*errorDecay
+	if failed == 0 {
+		if ep.latency == 0 {
+			ep.latency = latency
+		} else {
+			ep.latency = (ep.latency*4 + latency) / 5
+		}
+	}
+}
+
+// score orders healthy endpoints; lower is better. Latency is penalised by
+// the recent error rate.
+func (ep *endpoint) score() float64 {
+	return float64(ep.latency) * (1 + 10*ep.errorRate)
+}
+
+// ranked returns the endpoints ordered healthiest first. Unhealthy endpoints
+// stay at the end as a last resort.
+func (c *Client) ranked(websocket bool) []*endpoint {
+	type candidate struct {
+		ep      *endpoint
+		healthy bool
+		score   float64
+	}
+	var candidates []candidate
+	for _, ep := range c.endpoints {
+		if websocket && !ep.websocket {
+			continue
+		}
+		ep.mu.Lock()
+		candidates = append(candidates, candidate{ep: ep, healthy: ep.healthy, score: ep.score()})
+		ep.mu.Unlock()
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].healthy != candidates[j].healthy {
+			return candidates[i].healthy
+		}
+		return candidates[i].score < candidates[j].score
+	})
+
+	ranked := make([]*endpoint, len(candidates))
+	for i, candidate := range candidates {
+		ranked[i] = candidate.ep
+	}
+	return ranked
+}
+
+func (c *Client) monitor() {
+	ticker := time.NewTicker(c.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.check()
+		}
+	}
+}
+
+// check probes every endpoint in parallel, redialing those that are down,
+// then marks as healthy the ones that answered and are close to the best head.
+func (c *Client) check() {
+	var wg sync.WaitGroup
+	for _, ep := range c.endpoints {
+		wg.Add(1)
+		go func(ep *endpoint) {
+			defer wg.Done()
+			c.probe(ep)
+		}(ep)
+	}
+	wg.Wait()
+
+	var best uint64
+	for _, ep := range c.endpoints {
+		ep.mu.Lock()
+		if ep.lastErr == nil && ep.head > best {
+			best = ep.head
+		}
+		ep.mu.Unlock()
+	}
+	for _, ep := range c.endpoints {
+		ep.mu.Lock()
+		ep.healthy = ep.client != nil && ep.lastErr == nil && best-ep.head <= c.cfg.MaxLag
+		ep.mu.Unlock()
+	}
+}
+
+func (c *Client) probe(ep *endpoint) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+	defer cancel()
+
+	client := ep.get()
+	if client == nil {
+		dialed, err := ethclient.DialContext(ctx, ep.url)
+		ep.mu.Lock()
+		ep.lastCheck = time.Now()
+		if err != nil {
+			ep.lastErr = err
+			ep.mu.Unlock()
+			return
+		}
+		ep.client = dialed
+		ep.mu.Unlock()
+		client = dialed
+	}
+
+	start := time.Now()
+	head, err := client.BlockNumber(ctx)
+	ep.record(time.Since(start), err)
+
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.lastCheck = time.Now()
+	ep.lastErr = err
+	if err == nil {
+		ep.head = head
+		return
+	}
+
+	// Drop a connection that cannot answer so the next probe redials it
+	if isTransportError(err) && ep.client == client {
+		client.Close()
+		ep.client = nil
+	}
+}
+
+// EndpointStatus describes one endpoint for the status endpoint.
+type EndpointStatus struct {
+	URL       string    `json:"url"`
+	WebSocket bool      `json:"websocket"`
+	Connected bool      `json:"connected"`
+	Healthy   bool      `json:"healthy"`
+	Head      uint64    `json:"head"`
+	Lag       uint64    `json:"lag"`
+	LatencyMs int64     `json:"latencyMs"`
+	ErrorRate float64   `json:"errorRate"`
+	LastError string    `json:"lastError,omitempty"`
+	LastCheck time.Time `json:"lastCheck"`
+}
+
+// Head returns the highest block seen by the health checks.
+func (c *Client) Head() uint64 {
+	var best uint64
+	for _, ep := range c.endpoints {
+		ep.mu.Lock()
+		best = max(best, ep.head)
+		ep.mu.Unlock()
+	}
+	return best
+}
+
+// Healthy reports whether at least one endpoint passed its last health check.
+func (c *Client) Healthy() bool {
+	for _, ep := range c.endpoints {
+		ep.mu.Lock()
+		healthy := ep.healthy
+		ep.mu.Unlock()
+		if healthy {
+			return true
+		}
+	}
+	return false
+}
+
+// Ready fails unless an endpoint is healthy and, when maxHeadAge is set, the
+// chain head is recent enough to show the node is following the chain.
+func (c *Client) Ready(maxHeadAge time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if !c.Healthy() {
+			return fmt.Errorf("no healthy RPC endpoint")
+		}
+		header, err := c.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to read chain head: %v", err)
+		}
+		if maxHeadAge > 0 {
+			age := time.Since(time.Unix(int64(header.Time), 0))
+			if age > maxHeadAge {
+				return fmt.Errorf("chain head %d is %s old", header.Number, age.Round(time.Second))
+			}
+		}
+		return nil
+	}
+}
+
+// Status reports the state of every endpoint in order of preference.
+func (c *Client) Status() []EndpointStatus {
+	best := c.Head()
+
+	var statuses []EndpointStatus
+	for _, ep := range c.ranked(false) {
+		ep.mu.Lock()
+		status := EndpointStatus{
+			URL:       redact(ep.url),
+			WebSocket: ep.websocket,
+			Connected: ep.client != nil,
+			Healthy:   ep.healthy,
+			Head:      ep.head,
+			Lag:       best - ep.head,
+			LatencyMs: ep.latency.Milliseconds(),
+			ErrorRate: ep.errorRate,
+			LastCheck: ep.lastCheck,
+		}
+		if ep.lastErr != nil {
+			status.LastError = ep.lastErr.Error()
+		}
+		ep.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Routes exposes the endpoint status.
+func (c *Client) Routes(router fiber.Router) {
+	router.Get("/rpc/status", func(ctx *fiber.Ctx) error {
+		return ctx.JSON(c.Status())
+	})
+}
+
+// redact strips credentials, API keys in the path and query strings from an
+// endpoint URL before it is shown.
+func redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "<redacted>"
+	}
+	redacted := u.Scheme + "://" + u.Host
+	if u.Path != "" && u.Path != "/" {
+		redacted += "/***"
+	}
+	return redacted
+}
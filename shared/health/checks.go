@@ -0,0 +1,92 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"shared/logging"
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+var logger = logging.For("health")
+
+// Channel tracks whether an AMQP channel is still open. Channels close on
+// protocol errors without closing the connection, so both are checked.
+type Channel struct {
+	mu     sync.Mutex
+	conn   *amqp.Connection
+	closed error
+}
+
+// WatchChannel starts tracking ch on conn.
+func WatchChannel(conn *amqp.Connection, ch *amqp.Channel) *Channel {
+	watched := &Channel{conn: conn}
+	closes := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		err, ok := <-closes
+		watched.mu.Lock()
+		defer watched.mu.Unlock()
+		if ok && err != nil {
+			watched.closed = fmt.Errorf("channel closed: %v", err)
+		} else {
+			watched.closed = fmt.Errorf("channel closed")
+		}
+	}()
+	return watched
+}
+
+// Check fails once the connection or the channel has closed.
+func (c *Channel) Check(context.Context) error {
+	if c.conn == nil || c.conn.IsClosed() {
+		return fmt.Errorf("connection closed")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// QueueDepth is the state of one queue.
+type QueueDepth struct {
+	Messages  int    `json:"messages"`
+	Consumers int    `json:"consumers"`
+	Error     string `json:"error,omitempty"`
+}
+
+// QueueDepths reports the depth of each queue. Inspection uses its own
+// channel because inspecting a missing queue closes the channel it runs on.
+func QueueDepths(conn func() *amqp.Connection, queues ...string) Section {
+	return func(ctx context.Context) any {
+		depths := make(map[string]QueueDepth, len(queues))
+		for _, name := range queues {
+			depths[name] = inspect(conn(), name)
+		}
+		return depths
+	}
+}
+
+func inspect(conn *amqp.Connection, name string) QueueDepth {
+	if conn == nil || conn.IsClosed() {
+		return QueueDepth{Error: "connection closed"}
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return QueueDepth{Error: err.Error()}
+	}
+	defer ch.Close()
+	queue, err := ch.QueueInspect(name)
+	if err != nil {
+		return QueueDepth{Error: err.Error()}
+	}
+	return QueueDepth{Messages: queue.Messages, Consumers: queue.Consumers}
+}
+
+// MaskURL hides the password in a URL such as an AMQP broker address.
+func MaskURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid>"
+	}
+	return u.Redacted()
+}
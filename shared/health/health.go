@@ -0,0 +1,201 @@
+package health
+
+import (
+	"context"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Version is the build version reported by /status. Set it at build time with
+// -ldflags "-X shared/health.Version=v1.2.3"; otherwise the VCS revision is used.
+var Version = ""
+
+// checkTimeout bounds every check so a hung dependency cannot hang the probe.
+const checkTimeout = 3 * time.Second
+
+// Check reports a dependency as healthy by returning nil.
+type Check func(ctx context.Context) error
+
+// Section contributes one entry to the /status document.
+type Section func(ctx context.Context) any
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type namedSection struct {
+	name    string
+	section Section
+}
+
+// Service collects a service's checks and serves /healthz, /readyz and
+// /status. Liveness checks should only fail when restarting the process
+// would help; readiness checks cover the dependencies the service needs to
+// do useful work.
+type Service struct {
+	name    string
+	started time.Time
+
+	mu       sync.Mutex
+	live     []namedCheck
+	ready    []namedCheck
+	sections []namedSection
+	config   map[string]any
+}
+
+// New returns a service with no checks; every probe passes until checks are added.
+func New(name string) *Service {
+	return &Service{name: name, started: time.Now(), config: map[string]any{}}
+}
+
+// Live adds a liveness check, served on /healthz.
+func (s *Service) Live(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.live = append(s.live, namedCheck{name, check})
+}
+
+// Ready adds a readiness check, served on /readyz.
+func (s *Service) Ready(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ready = append(s.ready, namedCheck{name, check})
+}
+
+// Status adds a section to the /status document.
+func (s *Service) Status(name string, section Section) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sections = append(s.sections, namedSection{name, section})
+}
+
+// Config records a configuration value for /status. Callers must not pass
+// secrets; use MaskURL for URLs that may carry credentials.
+func (s *Service) Config(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config[key] = value
+}
+
+// Result is the outcome of a set of checks.
+type Result struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// OK reports whether every check passed.
+func (r Result) OK() bool {
+	return r.Status == "ok"
+}
+
+// run executes checks in parallel.
+func run(ctx context.Context, checks []namedCheck) Result {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	result := Result{Status: "ok", Checks: make(map[string]string, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+			outcome := "ok"
+			if err := c.check(ctx); err != nil {
+				outcome = err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			result.Checks[c.name] = outcome
+			if outcome != "ok" {
+				result.Status = "fail"
+			}
+		}(c)
+	}
+	wg.Wait()
+	return result
+}
+
+// Liveness runs the liveness checks.
+func (s *Service) Liveness(ctx context.Context) Result {
+	s.mu.Lock()
+	checks := append([]namedCheck(nil), s.live...)
+	s.mu.Unlock()
+	return run(ctx, checks)
+}
+
+// Readiness runs the readiness checks.
+func (s *Service) Readiness(ctx context.Context) Result {
+	s.mu.Lock()
+	checks := append([]namedCheck(nil), s.ready...)
+	s.mu.Unlock()
+	return run(ctx, checks)
+}
+
+// Document builds the /status document.
+func (s *Service) Document(ctx context.Context) fiber.Map {
+	s.mu.Lock()
+	sections := append([]namedSection(nil), s.sections...)
+	config := make(map[string]any, len(s.config))
+	for k, v := range s.config {
+		config[k] = v
+	}
+	s.mu.Unlock()
+
+	doc := fiber.Map{
+		"service":   s.name,
+		"version":   version(),
+		"startedAt": s.started.UTC(),
+		"uptime":    time.Since(s.started).Round(time.Second).String(),
+		"config":    config,
+		"readiness": s.Readiness(ctx),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	sort.Slice(sections, func(i, j int) bool { return sections[i].name < sections[j].name })
+	for _, section := range sections {
+		doc[section.name] = section.section(ctx)
+	}
+	return doc
+}
+
+// Routes serves /healthz, /readyz and /status. The probes answer 503 when a
+// check fails.
+func (s *Service) Routes(router fiber.Router) {
+	router.Get("/healthz", func(c *fiber.Ctx) error {
+		return respond(c, s.Liveness(c.UserContext()))
+	})
+	router.Get("/readyz", func(c *fiber.Ctx) error {
+		return respond(c, s.Readiness(c.UserContext()))
+	})
+	router.Get("/status", func(c *fiber.Ctx) error {
+		return c.JSON(s.Document(c.UserContext()))
+	})
+}
+
+func respond(c *fiber.Ctx, result Result) error {
+	if !result.OK() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(result)
+	}
+	return c.JSON(result)
+}
+
+func version() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "dev"
+}
@@ -0,0 +1,68 @@
+package lifecycle
+
+import (
+	"context"
+	"shared/broker"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+)
+
+// Consumer reads one queue with manual acknowledgement and can be stopped
+// without losing messages.
+type Consumer struct {
+	b        broker.Broker
+	queue    string
+	tag      string
+	stopping atomic.Bool
+	done     chan struct{}
+}
+
+// Consume starts passing the deliveries of queue on b to handle, one at a
+// time. handle must ack, nack or reject each delivery. Set the channel's
+// prefetch with Qos first to bound the deliveries buffered when stopping.
+func Consume(b broker.Broker, queue string, handle func(amqp.Delivery)) (*Consumer, error) {
+	c := &Consumer{b: b, queue: queue, tag: queue + "-" + uuid.NewString(), done: make(chan struct{})}
+	msgs, err := b.Consume(queue, c.tag, false)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer close(c.done)
+		for d := range msgs {
+			if c.stopping.Load() {
+				// Buffered before the cancel reached the broker
+				if err := d.Nack(false, true); err != nil {
+					logger.Warn("Failed to requeue message", "queue", queue, "err", err)
+				}
+				continue
+			}
+			handle(d)
+		}
+	}()
+	return c, nil
+}
+
+// Stop cancels the consumer, requeues the deliveries it has not started on
+// and waits for the one in progress until ctx is done. Unacknowledged
+// deliveries left when the channel closes are requeued by the broker.
+func (c *Consumer) Stop(ctx context.Context) error {
+	c.stopping.Store(true)
+	if err := c.b.Cancel(c.tag); err != nil {
+		return err
+	}
+	select {
+	case <-c.done:
+		logger.Info("Stopped consuming", "queue", c.queue)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Done is closed once the consumer has handed on its last delivery, whether
+// it was stopped or its channel closed.
+func (c *Consumer) Done() <-chan struct{} {
+	return c.done
+}
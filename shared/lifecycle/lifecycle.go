@@ -0,0 +1,94 @@
+// Package lifecycle stops services cleanly: it turns SIGINT and SIGTERM into
+// a cancelled context, then runs the service's shutdown steps in order under
+// one deadline.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"shared/logging"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var logger = logging.For("lifecycle")
+
+// SignalContext returns a context cancelled by SIGINT or SIGTERM. Calling
+// stop restores the default handling, so a second signal kills the process
+// if shutdown hangs.
+func SignalContext() (ctx context.Context, stop context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// Serve runs app on addr until ctx is cancelled. It returns without waiting
+// for requests in progress; add Drain(app) to the shutdown steps for that.
+func Serve(ctx context.Context, app *fiber.App, addr string) error {
+	errs := make(chan error, 1)
+	go func() { errs <- app.Listen(addr) }()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// Drain stops app accepting connections and waits for the requests in
+// progress to finish.
+func Drain(app *fiber.App) func(context.Context) error {
+	return app.ShutdownWithContext
+}
+
+// Closer adapts Close methods to a shutdown step.
+func Closer(c io.Closer) func(context.Context) error {
+	return func(context.Context) error { return c.Close() }
+}
+
+type step struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// Shutdown is an ordered list of steps run when the service stops. Add them
+// in the order they must run: stop taking work first, then finish the work
+// in progress, then persist state and close connections.
+type Shutdown struct {
+	steps []step
+}
+
+// Add appends a step.
+func (s *Shutdown) Add(name string, fn func(context.Context) error) {
+	s.steps = append(s.steps, step{name: name, fn: fn})
+}
+
+// Run runs every step within timeout. Steps still run after the deadline
+// passes, with an expired context, so connections get closed; steps that
+// wait on the context give up at once.
+func (s *Shutdown) Run(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	logger.Info("Shutting down", "timeout", timeout.String())
+	start := time.Now()
+	var errs []error
+	for _, step := range s.steps {
+		stepStart := time.Now()
+		if err := step.fn(ctx); err != nil {
+			logger.Error("Shutdown step failed", "step", step.name, "err", err)
+			errs = append(errs, fmt.Errorf("%s: %w", step.name, err))
+			continue
+		}
+		logger.Debug("Shutdown step done", "step", step.name, "duration_ms", time.Since(stepStart).Milliseconds())
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	logger.Info("Shutdown complete", "duration_ms", time.Since(start).Milliseconds())
+	return nil
+}
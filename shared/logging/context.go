@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	correlationIDKey
+	txHashKey
+)
+
+// WithRequestID returns ctx carrying the ID of the HTTP request being served.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// WithCorrelationID returns ctx carrying the correlation ID of an AMQP
+// request and its reply.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey, id)
+}
+
+// WithTxHash returns ctx carrying the hash of the transaction being handled.
+func WithTxHash(ctx context.Context, hash string) context.Context {
+	return context.WithValue(ctx, txHashKey, hash)
+}
+
+// RequestID returns the request ID in ctx, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func contextAttrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	var attrs []slog.Attr
+	if id, ok := ctx.Value(requestIDKey).(string); ok && id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if id, ok := ctx.Value(correlationIDKey).(string); ok && id != "" {
+		attrs = append(attrs, slog.String("correlation_id", id))
+	}
+	if hash, ok := ctx.Value(txHashKey).(string); ok && hash != "" {
+		attrs = append(attrs, slog.String("tx_hash", hash))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		attrs = append(attrs,
+			slog.String("trace_id", span.TraceID().String()),
+			slog.String("span_id", span.SpanID().String()),
+		)
+	}
+	return attrs
+}
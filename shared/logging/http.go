@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Middleware gives every request an ID, taken from X-Request-Id when the
+// caller sent one, stores it in c.UserContext() and echoes it in the
+// response. Each request is logged by the "http" component: failures at
+// warn or error level, the rest at debug so probes do not flood the logs.
+func Middleware() fiber.Handler {
+	logger := For("http")
+	return func(c *fiber.Ctx) error {
+		id := c.Get(fiber.HeaderXRequestID)
+		if id == "" {
+			id = uuid.NewString()
+		}
+		c.Set(fiber.HeaderXRequestID, id)
+		ctx := WithRequestID(c.UserContext(), id)
+		c.SetUserContext(ctx)
+
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			}
+		}
+		level := slog.LevelDebug
+		switch {
+		case status >= fiber.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= fiber.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		args := []any{
+			"method", c.Method(),
+			"route", c.Route().Path,
+			"path", c.Path(),
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			args = append(args, "err", err)
+		}
+		logger.Log(ctx, level, "Request handled", args...)
+		return err
+	}
+}
@@ -0,0 +1,161 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// config is the process-wide logging setup. Loggers returned by For read it
+// on every call, so they can be created at package init before Init runs.
+var config = struct {
+	sync.RWMutex
+	base    slog.Handler
+	level   slog.Level
+	levels  map[string]slog.Level
+	service string
+}{
+	base:  newBase(os.Stdout),
+	level: slog.LevelInfo,
+}
+
+func newBase(w io.Writer) slog.Handler {
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{
+		// Levels are filtered per component before records get here
+		Level:       slog.LevelDebug,
+		ReplaceAttr: redactAttr,
+	})
+}
+
+// Init configures JSON logging on stdout for service and installs it as the
+// default logger, which the standard log package also writes through.
+//
+// level sets the level of every component (debug, info, warn or error;
+// info when empty). levels overrides it per component, e.g.
+// "listener=debug,rabbitmq=warn".
+func Init(service, level, levels string) error {
+	base := slog.LevelInfo
+	if level != "" {
+		if err := base.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level %q: %v", level, err)
+		}
+	}
+	overrides, err := parseLevels(levels)
+	if err != nil {
+		return err
+	}
+
+	config.Lock()
+	config.level = base
+	config.levels = overrides
+	config.service = service
+	config.Unlock()
+
+	slog.SetDefault(For(service))
+	return nil
+}
+
+// parseLevels reads a comma-separated list of component=level pairs.
+func parseLevels(raw string) (map[string]slog.Level, error) {
+	levels := make(map[string]slog.Level)
+	for _, pair := range strings.Split(raw, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		component, name, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid log levels entry %q, want component=level", pair)
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+			return nil, fmt.Errorf("invalid level for %s in log levels: %v", component, err)
+		}
+		levels[strings.TrimSpace(component)] = level
+	}
+	return levels, nil
+}
+
+// SetLevel changes the level of one component at runtime, or of every
+// component without an override when component is empty.
+func SetLevel(component string, level slog.Level) {
+	config.Lock()
+	defer config.Unlock()
+	if component == "" {
+		config.level = level
+		return
+	}
+	if config.levels == nil {
+		config.levels = make(map[string]slog.Level)
+	}
+	config.levels[component] = level
+}
+
+func levelOf(component string) slog.Level {
+	config.RLock()
+	defer config.RUnlock()
+	if level, ok := config.levels[component]; ok {
+		return level
+	}
+	return config.level
+}
+
+// For returns the logger of a component. Every line carries the service,
+// the component, and the request, correlation, trace and transaction fields
+// found in the context passed to the *Context logging methods.
+func For(component string) *slog.Logger {
+	return slog.New(&handler{component: component})
+}
+
+// Fatal logs msg at error level on the default logger and exits.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// handler filters by the component's level and writes through the shared
+// base handler. Attributes and groups added with With are replayed onto the
+// base handler for each record, so a reconfigured base takes effect at once.
+type handler struct {
+	component string
+	ops       []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= levelOf(h.component)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	config.RLock()
+	base, service := config.base, config.service
+	config.RUnlock()
+
+	attrs := []slog.Attr{slog.String("component", h.component)}
+	if service != "" && service != h.component {
+		attrs = append(attrs, slog.String("service", service))
+	}
+	attrs = append(attrs, contextAttrs(ctx)...)
+
+	var out slog.Handler = base.WithAttrs(attrs)
+	for _, op := range h.ops {
+		out = op(out)
+	}
+	return out.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h *handler) with(op func(slog.Handler) slog.Handler) *handler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+	return &handler{component: h.component, ops: append(ops, op)}
+}
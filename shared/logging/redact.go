@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretKeys are normalised attribute and field names whose values are
+// never logged.
+var secretKeys = map[string]bool{
+	"privatekey":    true,
+	"password":      true,
+	"passwd":        true,
+	"secret":        true,
+	"clientsecret":  true,
+	"token":         true,
+	"accesstoken":   true,
+	"refreshtoken":  true,
+	"apikey":        true,
+	"authorization": true,
+	"mnemonic":      true,
+	"seed":          true,
+	"seedphrase":    true,
+}
+
+func isSecret(key string) bool {
+	normalised := strings.NewReplacer("_", "", "-", "", ".", "").Replace(strings.ToLower(key))
+	return secretKeys[normalised] || strings.HasSuffix(normalised, "privatekey") || strings.HasSuffix(normalised, "secret")
+}
+
+// redactAttr replaces secret attributes, and secret fields of structs and
+// maps logged as a single attribute.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if isSecret(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	if a.Value.Kind() == slog.KindAny {
+		if scrubbed, ok := scrub(a.Value.Any()); ok {
+			a.Value = slog.AnyValue(scrubbed)
+		}
+	}
+	return a
+}
+
+// scrub returns v as generic JSON with secret fields redacted, and false if
+// v is not a composite value that could hold one.
+func scrub(v any) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	if _, ok := v.(error); ok {
+		return nil, false
+	}
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	// Numbers stay json.Number so wei amounts keep their precision
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var generic any
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, false
+	}
+	return redactValue(generic), true
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if isSecret(key) {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(value)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+	return v
+}
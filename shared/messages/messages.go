@@ -0,0 +1,58 @@
+// Package messages defines the requests the gateways send the worker and the
+// worker's responses, converted to and from the types generated from
+// codec/proto/worker/v1/worker.proto. Each is sent as JSON or Protobuf; see
+// package codec.
+package messages
+
+import (
+	workerv1 "shared/codec/proto/worker/v1"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ApprovalRequest asks the worker to approve a proposal, signed with
+// PrivateKey.
+type ApprovalRequest struct {
+	ProposalID int64  `json:"proposalId"`
+	PrivateKey string `json:"privateKey"`
+}
+
+// DepositRequest asks the worker to deposit Amount Ether, from the account
+// of PrivateKey.
+type DepositRequest struct {
+	PrivateKey string `json:"privateKey"`
+	Amount     string `json:"amount"`
+}
+
+// Response is the worker's reply: Message on success, Error otherwise.
+type Response struct {
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (r ApprovalRequest) Proto() proto.Message {
+	return &workerv1.ApprovalRequest{ProposalId: r.ProposalID, PrivateKey: r.PrivateKey}
+}
+
+func (r *ApprovalRequest) SetProto(m proto.Message) {
+	p := m.(*workerv1.ApprovalRequest)
+	*r = ApprovalRequest{ProposalID: p.ProposalId, PrivateKey: p.PrivateKey}
+}
+
+func (r DepositRequest) Proto() proto.Message {
+	return &workerv1.DepositRequest{PrivateKey: r.PrivateKey, Amount: r.Amount}
+}
+
+func (r *DepositRequest) SetProto(m proto.Message) {
+	p := m.(*workerv1.DepositRequest)
+	*r = DepositRequest{PrivateKey: p.PrivateKey, Amount: p.Amount}
+}
+
+func (r Response) Proto() proto.Message {
+	return &workerv1.Response{Message: r.Message, Error: r.Error}
+}
+
+func (r *Response) SetProto(m proto.Message) {
+	p := m.(*workerv1.Response)
+	*r = Response{Message: p.Message, Error: p.Error}
+}
@@ -0,0 +1,245 @@
+package signer
+
+import (
+	"container/list"
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("shared/signer")
+
+// SignedFunc is called with every transaction a signer signs, before it is
+// sent. ctx is the one passed to Transact.
+type SignedFunc func(ctx context.Context, tx *types.Transaction)
+
+// Backend is what a signer needs from the chain.
+type Backend interface {
+	bind.ContractBackend
+	ChainID(ctx context.Context) (*big.Int, error)
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+}
+
+// Signer signs and submits transactions for one account. It is meant to be
+// created once at boot and shared: submissions are serialised so every
+// transaction gets the next nonce, even under concurrent requests.
+type Signer struct {
+	client  Backend
+	key     *ecdsa.PrivateKey
+	from    common.Address
+	chainID *big.Int
+
+	mu       sync.Mutex
+	nonce    uint64
+	synced   bool
+	onSigned SignedFunc
+}
+
+// New parses a hex private key and reads the chain ID from the backend.
+func New(ctx context.Context, client Backend, hexKey string) (*Signer, error) {
+	key, err := parseKey(hexKey)
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chain ID: %v", err)
+	}
+	return &Signer{
+		client:  client,
+		key:     key,
+		from:    crypto.PubkeyToAddress(key.PublicKey),
+		chainID: chainID,
+	}, nil
+}
+
+func parseKey(hexKey string) (*ecdsa.PrivateKey, error) {
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(hexKey), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	return key, nil
+}
+
+// Address returns the signing account.
+func (s *Signer) Address() common.Address {
+	return s.from
+}
+
+// ChainID returns the chain the signer signs for.
+func (s *Signer) ChainID() *big.Int {
+	return new(big.Int).Set(s.chainID)
+}
+
+// OnSigned registers fn to be called with every transaction once it is
+// signed. The hash is final at that point, so fn can record it before the
+// transaction can be mined.
+func (s *Signer) OnSigned(fn SignedFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onSigned = fn
+}
+
+// Funded fails unless the signing account can pay for gas.
+func (s *Signer) Funded(ctx context.Context) error {
+	balance, err := s.client.BalanceAt(ctx, s.from, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read signer balance: %v", err)
+	}
+	if balance.Sign() == 0 {
+		return fmt.Errorf("signer %s has no balance", s.from.Hex())
+	}
+	return nil
+}
+
+// Transact calls send with fresh transact options carrying the next nonce
+// and the given value (nil for none). After a failure the nonce is re-read
+// from the node, since the transaction may or may not have been accepted.
+func (s *Signer) Transact(ctx context.Context, value *big.Int, send func(opts *bind.TransactOpts) (*types.Transaction, error)) (tx *types.Transaction, err error) {
+	ctx, span := tracer.Start(ctx, "signer.Transact", trace.WithAttributes(attribute.String("eth.from", s.from.Hex())))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.synced {
+		nonce, err := s.client.PendingNonceAt(ctx, s.from)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read nonce: %v", err)
+		}
+		s.nonce, s.synced = nonce, true
+	}
+
+	opts, err := bind.NewKeyedTransactorWithChainID(s.key, s.chainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authorized transactor: %v", err)
+	}
+	opts.Context = ctx
+	opts.Nonce = new(big.Int).SetUint64(s.nonce)
+	opts.Value = value
+	sign := opts.Signer
+	opts.Signer = func(from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		signed, err := sign(from, tx)
+		if err == nil {
+			span.SetAttributes(attribute.String("eth.tx_hash", signed.Hash().Hex()))
+			if s.onSigned != nil {
+				s.onSigned(ctx, signed)
+			}
+		}
+		return signed, err
+	}
+	span.SetAttributes(attribute.Int64("eth.nonce", int64(s.nonce)))
+
+	tx, err = send(opts)
+	if err != nil {
+		s.synced = false
+		return nil, err
+	}
+	s.nonce++
+	return tx, nil
+}
+
+// KeyringSize is how many signers a keyring keeps. Past it, the least
+// recently used idle signer is evicted; its account's nonce is read from the
+// node again if its key comes back.
+const KeyringSize = 256
+
+// Keyring caches one signer per account, for services that are handed the
+// private key with each request.
+type Keyring struct {
+	client Backend
+	size   int
+
+	mu       sync.Mutex
+	signers  map[common.Address]*list.Element // of *Signer
+	recent   *list.List                       // most recently used first
+	onSigned SignedFunc
+}
+
+// NewKeyring returns an empty keyring whose signers use client.
+func NewKeyring(client Backend) *Keyring {
+	return &Keyring{client: client, size: KeyringSize, signers: make(map[common.Address]*list.Element), recent: list.New()}
+}
+
+// Signer returns the cached signer for hexKey's account, creating it on
+// first use.
+func (k *Keyring) Signer(ctx context.Context, hexKey string) (*Signer, error) {
+	key, err := parseKey(hexKey)
+	if err != nil {
+		return nil, err
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if e, ok := k.signers[from]; ok {
+		k.recent.MoveToFront(e)
+		k.evict()
+		return e.Value.(*Signer), nil
+	}
+	s, err := New(ctx, k.client, hexKey)
+	if err != nil {
+		return nil, err
+	}
+	s.onSigned = k.onSigned
+	k.signers[from] = k.recent.PushFront(s)
+	k.evict()
+	return s, nil
+}
+
+// evict drops the least recently used signers past the keyring's size,
+// keeping the one just used and skipping those in the middle of a
+// transaction, so an account never has two signers picking nonces at once.
+func (k *Keyring) evict() {
+	for e := k.recent.Back(); e != k.recent.Front() && k.recent.Len() > k.size; {
+		s, previous := e.Value.(*Signer), e.Prev()
+		if s.mu.TryLock() {
+			k.recent.Remove(e)
+			delete(k.signers, s.from)
+			s.mu.Unlock()
+		}
+		e = previous
+	}
+}
+
+// OnSigned registers fn with every signer in the keyring, including those
+// created later.
+func (k *Keyring) OnSigned(fn SignedFunc) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.onSigned = fn
+	for e := k.recent.Front(); e != nil; e = e.Next() {
+		e.Value.(*Signer).OnSigned(fn)
+	}
+}
+
+// Addresses lists the accounts of the cached signers.
+func (k *Keyring) Addresses() []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	addresses := make([]string, 0, len(k.signers))
+	for from := range k.signers {
+		addresses = append(addresses, from.Hex())
+	}
+	sort.Strings(addresses)
+	return addresses
+}
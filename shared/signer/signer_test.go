@@ -0,0 +1,247 @@
+package signer
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+
+	"shared/chaintest"
+	"shared/failover"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const testKey = chaintest.Key
+
+const depositABI = `[{"inputs":[],"name":"depositEther","outputs":[],"stateMutability":"payable","type":"function"}]`
+
+// chain is a simulated chain whose mock Diamond accepts any call and value,
+// which is all the client layer needs to be exercised.
+type chain struct {
+	*chaintest.Chain
+	abi abi.ABI
+}
+
+func newChain(t testing.TB) *chain {
+	t.Helper()
+	parsed, err := abi.JSON(strings.NewReader(depositABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &chain{Chain: chaintest.New(t), abi: parsed}
+}
+
+func (c *chain) deposit(client bind.ContractBackend) func(opts *bind.TransactOpts) (*types.Transaction, error) {
+	contract := bind.NewBoundContract(c.Diamond, c.abi, client, client, client)
+	return func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return contract.Transact(opts, "depositEther")
+	}
+}
+
+func dial(t testing.TB, url string) *failover.Client {
+	t.Helper()
+	client, err := failover.Dial(failover.Config{URLs: []string{url}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+func TestConcurrentTransactUsesSequentialNonces(t *testing.T) {
+	c := newChain(t)
+	client := dial(t, c.URL)
+	s, err := New(context.Background(), client, "0x"+testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const requests = 25
+	nonces := make(chan uint64, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tx, err := s.Transact(context.Background(), big.NewInt(1), c.deposit(client))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			nonces <- tx.Nonce()
+		}()
+	}
+	wg.Wait()
+	close(nonces)
+
+	seen := make(map[uint64]bool)
+	for nonce := range nonces {
+		if seen[nonce] {
+			t.Fatalf("nonce %d used twice", nonce)
+		}
+		seen[nonce] = true
+	}
+	for nonce := uint64(0); nonce < requests; nonce++ {
+		if !seen[nonce] {
+			t.Fatalf("nonce %d skipped", nonce)
+		}
+	}
+}
+
+func TestTransactResyncsNonceAfterFailure(t *testing.T) {
+	c := newChain(t)
+	client := dial(t, c.URL)
+	s, err := New(context.Background(), client, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Transact(context.Background(), nil, func(*bind.TransactOpts) (*types.Transaction, error) {
+		return nil, fmt.Errorf("rejected")
+	}); err == nil {
+		t.Fatal("expected the failed send to be reported")
+	}
+	tx, err := s.Transact(context.Background(), nil, c.deposit(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Nonce() != 0 {
+		t.Fatalf("nonce = %d, want 0", tx.Nonce())
+	}
+}
+
+func TestKeyringCachesSigners(t *testing.T) {
+	c := newChain(t)
+	keyring := NewKeyring(dial(t, c.URL))
+
+	first, err := keyring.Signer(context.Background(), testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := keyring.Signer(context.Background(), "0x"+strings.ToUpper(testKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatal("expected the same signer for the same key")
+	}
+	if first.ChainID().Uint64() != 1337 {
+		t.Fatalf("chain ID = %s, want 1337", first.ChainID())
+	}
+}
+
+func TestKeyringEvictsIdleSigners(t *testing.T) {
+	c := newChain(t)
+	keyring := NewKeyring(dial(t, c.URL))
+	keyring.size = 1
+
+	first, err := keyring.Signer(context.Background(), testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey := hex.EncodeToString(crypto.FromECDSA(other))
+
+	// A signer in the middle of a transaction is kept past the size
+	first.mu.Lock()
+	if _, err := keyring.Signer(context.Background(), otherKey); err != nil {
+		t.Fatal(err)
+	}
+	first.mu.Unlock()
+	if got := len(keyring.Addresses()); got != 2 {
+		t.Fatalf("%d signers cached, want 2", got)
+	}
+
+	// Once idle, the least recently used one goes
+	if _, err := keyring.Signer(context.Background(), otherKey); err != nil {
+		t.Fatal(err)
+	}
+	again, err := keyring.Signer(context.Background(), testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == first {
+		t.Fatal("evicted signer still cached")
+	}
+	if addresses := keyring.Addresses(); len(addresses) != 1 || addresses[0] != first.Address().Hex() {
+		t.Fatalf("cached %v", addresses)
+	}
+}
+
+// The benchmarks below go over websocket like the gateways do; compare them
+// with go test ./signer -run ^$ -bench .
+
+// BenchmarkDialPerRequest reproduces the old request path: dial, parse the
+// key and build a transactor for every transaction.
+func BenchmarkDialPerRequest(b *testing.B) {
+	c := newChain(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client, err := ethclient.Dial(c.WSURL)
+		if err != nil {
+			b.Fatal(err)
+		}
+		key, err := crypto.HexToECDSA(testKey)
+		if err != nil {
+			b.Fatal(err)
+		}
+		auth, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+		if err != nil {
+			b.Fatal(err)
+		}
+		auth.Value = big.NewInt(1)
+		if _, err := c.deposit(client)(auth); err != nil {
+			b.Fatal(err)
+		}
+		client.Close()
+	}
+}
+
+// BenchmarkSharedSigner uses one client and signer for every transaction.
+func BenchmarkSharedSigner(b *testing.B) {
+	c := newChain(b)
+	client := dial(b, c.WSURL)
+	s, err := New(context.Background(), client, testKey)
+	if err != nil {
+		b.Fatal(err)
+	}
+	send := c.deposit(client)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Transact(context.Background(), big.NewInt(1), send); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSharedSignerParallel drives the shared signer from concurrent
+// requests, which the per-request path cannot do without nonce collisions.
+func BenchmarkSharedSignerParallel(b *testing.B) {
+	c := newChain(b)
+	client := dial(b, c.WSURL)
+	s, err := New(context.Background(), client, testKey)
+	if err != nil {
+		b.Fatal(err)
+	}
+	send := c.deposit(client)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := s.Transact(context.Background(), big.NewInt(1), send); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
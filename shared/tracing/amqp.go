@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("shared/tracing")
+
+// Headers carries trace context in AMQP message headers.
+type Headers amqp.Table
+
+func (h Headers) Get(key string) string {
+	value, _ := h[key].(string)
+	return value
+}
+
+func (h Headers) Set(key, value string) {
+	h[key] = value
+}
+
+func (h Headers) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Inject adds the trace context of ctx to headers, allocating them if nil.
+func Inject(ctx context.Context, headers amqp.Table) amqp.Table {
+	if headers == nil {
+		headers = amqp.Table{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, Headers(headers))
+	return headers
+}
+
+// Extract returns ctx carrying the trace context found in headers.
+func Extract(ctx context.Context, headers amqp.Table) context.Context {
+	if headers == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, Headers(headers))
+}
+
+// StartPublish starts a producer span for a message sent to queue. Inject
+// the returned context into the message headers.
+func StartPublish(ctx context.Context, queue string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	opts = append([]trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(messagingAttributes(queue, "publish")...),
+	}, opts...)
+	return tracer.Start(ctx, queue+" publish", opts...)
+}
+
+// StartConsume starts a consumer span for a delivery from queue, continuing
+// the trace its publisher injected.
+func StartConsume(d amqp.Delivery, queue string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx := Extract(context.Background(), d.Headers)
+	opts = append([]trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messagingAttributes(queue, "process")...),
+	}, opts...)
+	if d.CorrelationId != "" {
+		opts = append(opts, trace.WithAttributes(attribute.String("messaging.message.conversation_id", d.CorrelationId)))
+	}
+	return tracer.Start(ctx, queue+" process", opts...)
+}
+
+func messagingAttributes(queue, operation string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("messaging.system", "rabbitmq"),
+		attribute.String("messaging.destination.name", queue),
+		attribute.String("messaging.operation.type", operation),
+	}
+}
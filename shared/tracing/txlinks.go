@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"shared/broker"
+	"shared/logging"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var logger = logging.For("tracing")
+
+// TxQueue carries the trace context of every transaction the worker signs,
+// so the publisher can link the events a transaction emits back to the
+// request that sent it.
+const TxQueue = "tx_traces"
+
+// txTTL is how long an announced transaction can be linked. It bounds both
+// the queue, when no publisher is consuming it, and the publisher's memory.
+const txTTL = time.Hour
+
+// DeclareTxQueue declares TxQueue. Both sides declare it with the same
+// options so either may start first.
+func DeclareTxQueue(b broker.Broker) error {
+	_, err := b.Declare(broker.Queue{Name: TxQueue, Durable: true, MessageTTL: txTTL})
+	return err
+}
+
+type txAnnouncement struct {
+	TxHash string `json:"txHash"`
+}
+
+// AnnounceTx publishes the trace context of ctx for txHash. Call it as soon
+// as the transaction is signed, before it can be mined and its logs seen.
+func AnnounceTx(ctx context.Context, b broker.Broker, txHash string) error {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+	body, err := json.Marshal(txAnnouncement{TxHash: txHash})
+	if err != nil {
+		return err
+	}
+	return b.Publish(TxQueue, amqp.Publishing{
+		ContentType: "application/json",
+		Headers:     Inject(ctx, nil),
+		Body:        body,
+	})
+}
+
+type txLink struct {
+	span trace.SpanContext
+	seen time.Time
+}
+
+// TxLinks remembers the trace context announced for each transaction.
+type TxLinks struct {
+	mu     sync.Mutex
+	links  map[string]txLink
+	pruned time.Time
+}
+
+// NewTxLinks returns an empty set of links.
+func NewTxLinks() *TxLinks {
+	return &TxLinks{links: make(map[string]txLink), pruned: time.Now()}
+}
+
+// Consume reads announcements from TxQueue on b until the channel closes.
+func (l *TxLinks) Consume(b broker.Broker) error {
+	if err := DeclareTxQueue(b); err != nil {
+		return fmt.Errorf("failed to declare %s: %v", TxQueue, err)
+	}
+	msgs, err := b.Consume(TxQueue, "", true)
+	if err != nil {
+		return fmt.Errorf("failed to consume %s: %v", TxQueue, err)
+	}
+	go func() {
+		for d := range msgs {
+			var announcement txAnnouncement
+			if err := json.Unmarshal(d.Body, &announcement); err != nil {
+				logger.Warn("Ignoring malformed message", "queue", TxQueue, "err", err)
+				continue
+			}
+			span := trace.SpanContextFromContext(Extract(context.Background(), d.Headers))
+			if span.IsValid() {
+				l.add(announcement.TxHash, span)
+			}
+		}
+	}()
+	return nil
+}
+
+func (l *TxLinks) add(txHash string, span trace.SpanContext) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.links[strings.ToLower(txHash)] = txLink{span: span, seen: now}
+
+	if now.Sub(l.pruned) > time.Minute {
+		for hash, link := range l.links {
+			if now.Sub(link.seen) > txTTL {
+				delete(l.links, hash)
+			}
+		}
+		l.pruned = now
+	}
+}
+
+// Link returns a span link to the trace that sent txHash, if it was announced.
+func (l *TxLinks) Link(txHash string) (trace.Link, bool) {
+	if l == nil {
+		return trace.Link{}, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	link, ok := l.links[strings.ToLower(txHash)]
+	if !ok {
+		return trace.Link{}, false
+	}
+	return trace.Link{
+		SpanContext: link.span,
+		Attributes:  []attribute.KeyValue{attribute.String("eth.tx_hash", txHash)},
+	}, true
+}
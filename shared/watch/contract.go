@@ -0,0 +1,95 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Contract describes one watched contract.
+type Contract struct {
+	Name       string   `json:"name"`
+	Address    string   `json:"address"`
+	ABIPath    string   `json:"abi,omitempty"`
+	StartBlock uint64   `json:"startBlock"`
+	Events     []string `json:"events,omitempty"`
+
+	// ABI is loaded from ABIPath, or is the service's built-in ABI when no
+	// path is given.
+	ABI abi.ABI `json:"-"`
+}
+
+// EventEnabled reports whether the named event should be delivered. An empty
+// event list enables every event in the ABI.
+func (c Contract) EventEnabled(name string) bool {
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, event := range c.Events {
+		if event == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Topics returns the topic filter selecting the enabled events, or nil when
+// all events are enabled.
+func (c Contract) Topics() [][]common.Hash {
+	if len(c.Events) == 0 {
+		return nil
+	}
+	ids := make([]common.Hash, 0, len(c.Events))
+	for _, name := range c.Events {
+		ids = append(ids, c.ABI.Events[name].ID)
+	}
+	return [][]common.Hash{ids}
+}
+
+// validate checks the contract definition against its ABI.
+func (c Contract) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("contract name is required")
+	}
+	if !common.IsHexAddress(c.Address) {
+		return fmt.Errorf("contract %s: invalid address %q", c.Name, c.Address)
+	}
+	for _, name := range c.Events {
+		if _, ok := c.ABI.Events[name]; !ok {
+			return fmt.Errorf("contract %s: event %s is not in its ABI", c.Name, name)
+		}
+	}
+	return nil
+}
+
+// LoadABI reads an ABI from a JSON file holding either a bare ABI array or a
+// Hardhat/Foundry artifact with an "abi" field.
+func LoadABI(path string) (abi.ABI, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return abi.ABI{}, fmt.Errorf("failed to read ABI %s: %w", path, err)
+	}
+
+	if trimmed := strings.TrimSpace(string(raw)); strings.HasPrefix(trimmed, "{") {
+		var artifact struct {
+			ABI json.RawMessage `json:"abi"`
+		}
+		if err := json.Unmarshal(raw, &artifact); err != nil {
+			return abi.ABI{}, fmt.Errorf("failed to parse artifact %s: %w", path, err)
+		}
+		if artifact.ABI == nil {
+			return abi.ABI{}, fmt.Errorf("artifact %s has no abi field", path)
+		}
+		raw = artifact.ABI
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(string(raw)))
+	if err != nil {
+		return abi.ABI{}, fmt.Errorf("failed to parse ABI %s: %w", path, err)
+	}
+	return parsed, nil
+}
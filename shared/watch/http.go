@@ -0,0 +1,39 @@
+package watch
+
+import (
+	"shared/admin"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Routes exposes the watch list for runtime changes to requests sending
+// token as a bearer token. Without a token they are not served: they write
+// the watch config and read any ABI path they are given.
+func Routes(router fiber.Router, l *List, token string) {
+	routes, ok := admin.Group(router, "/admin/watches", token)
+	if !ok {
+		return
+	}
+
+	routes.Get("/", func(c *fiber.Ctx) error {
+		return c.JSON(l.Contracts())
+	})
+
+	routes.Post("/", func(c *fiber.Ctx) error {
+		var contract Contract
+		if err := c.BodyParser(&contract); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+		if err := l.Add(contract); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusCreated).JSON(contract)
+	})
+
+	routes.Delete("/:name", func(c *fiber.Ctx) error {
+		if err := l.Remove(c.Params("name")); err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"message": "Watch removed"})
+	})
+}
@@ -0,0 +1,208 @@
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// Runner starts and stops a service's listener for one contract.
+type Runner interface {
+	Start(c Contract) error
+	Stop(name string)
+}
+
+// List is the set of contracts a service watches. Changes made at runtime
+// are applied to the Runner and written back to the config file.
+type List struct {
+	mu         sync.Mutex
+	path       string
+	defaultABI abi.ABI
+	contracts  map[string]Contract
+	runner     Runner
+}
+
+// Load reads the watch list from a JSON config file holding an array of
+// contracts. Contracts without an ABI path use defaultABI.
+func Load(path string, defaultABI abi.ABI) (*List, error) {
+	l := &List{path: path, defaultABI: defaultABI, contracts: make(map[string]Contract)}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watch config: %w", err)
+	}
+	var contracts []Contract
+	if err := json.Unmarshal(raw, &contracts); err != nil {
+		return nil, fmt.Errorf("failed to parse watch config %s: %w", path, err)
+	}
+	for _, c := range contracts {
+		if err := l.add(c); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Single builds an in-memory watch list for one contract using defaultABI.
+// It is used when no config file is given; runtime changes are not persisted.
+func Single(c Contract, defaultABI abi.ABI) (*List, error) {
+	l := &List{defaultABI: defaultABI, contracts: make(map[string]Contract)}
+	if err := l.add(c); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Run starts the runner for every contract on the list. Later additions and
+// removals are applied to the same runner.
+func (l *List) Run(runner Runner) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.runner = runner
+	for _, c := range l.sorted() {
+		if err := runner.Start(c); err != nil {
+			return fmt.Errorf("failed to start watch %s: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// Contracts returns the watched contracts ordered by name.
+func (l *List) Contracts() []Contract {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sorted()
+}
+
+// Add starts watching a contract, replacing any existing watch with the same name.
+func (l *List) Add(c Contract) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, err := l.prepare(c)
+	if err != nil {
+		return err
+	}
+
+	old, replacing := l.contracts[c.Name]
+	if l.runner != nil {
+		if replacing {
+			l.runner.Stop(c.Name)
+		}
+		if err := l.runner.Start(c); err != nil {
+			// Keep the previous watch running rather than losing it
+			if replacing && l.runner.Start(old) == nil {
+				return fmt.Errorf("failed to start watch %s: %w", c.Name, err)
+			}
+			delete(l.contracts, c.Name)
+			return fmt.Errorf("failed to start watch %s: %w", c.Name, err)
+		}
+	}
+	l.contracts[c.Name] = c
+	return l.save()
+}
+
+// Remove stops watching the named contract.
+func (l *List) Remove(name string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.contracts[name]; !ok {
+		return fmt.Errorf("no watch named %s", name)
+	}
+	if l.runner != nil {
+		l.runner.Stop(name)
+	}
+	delete(l.contracts, name)
+	return l.save()
+}
+
+// SetDefaultABI replaces the ABI used by contracts without an ABI path and
+// restarts their watches so they decode with it.
+func (l *List) SetDefaultABI(defaultABI abi.ABI) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.defaultABI = defaultABI
+	var errs []error
+	for _, c := range l.sorted() {
+		if c.ABIPath != "" {
+			continue
+		}
+		c.ABI = defaultABI
+		if err := c.validate(); err != nil {
+			// Keep watching with the previous ABI rather than dropping the contract
+			errs = append(errs, err)
+			continue
+		}
+		l.contracts[c.Name] = c
+		if l.runner != nil {
+			l.runner.Stop(c.Name)
+			if err := l.runner.Start(c); err != nil {
+				errs = append(errs, fmt.Errorf("failed to restart watch %s: %w", c.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (l *List) add(c Contract) error {
+	c, err := l.prepare(c)
+	if err != nil {
+		return err
+	}
+	l.contracts[c.Name] = c
+	return nil
+}
+
+// prepare loads the contract's ABI and validates it against the list.
+func (l *List) prepare(c Contract) (Contract, error) {
+	c.ABI = l.defaultABI
+	if c.ABIPath != "" {
+		parsed, err := LoadABI(c.ABIPath)
+		if err != nil {
+			return c, err
+		}
+		c.ABI = parsed
+	}
+	if err := c.validate(); err != nil {
+		return c, err
+	}
+	for _, other := range l.contracts {
+		if other.Name != c.Name && strings.EqualFold(other.Address, c.Address) {
+			return c, fmt.Errorf("address %s is already watched as %s", c.Address, other.Name)
+		}
+	}
+	return c, nil
+}
+
+// save writes the list back to its config file, if it has one.
+func (l *List) save() error {
+	if l.path == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(l.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		return fmt.Errorf("failed to write watch config: %w", err)
+	}
+	return os.Rename(tmp, l.path)
+}
+
+func (l *List) sorted() []Contract {
+	contracts := make([]Contract, 0, len(l.contracts))
+	for _, c := range l.contracts {
+		contracts = append(contracts, c)
+	}
+	sort.Slice(contracts, func(i, j int) bool { return contracts[i].Name < contracts[j].Name })
+	return contracts
+}
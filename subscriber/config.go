@@ -0,0 +1,18 @@
+package main
+
+import (
+	"shared/config"
+)
+
+// Config is the subscriber's configuration. See shared/config for the
+// sources each setting is read from.
+type Config struct {
+	Port            int             `config:"port" default:"3001" validate:"port" usage:"HTTP port"`
+	ProjectionDB    string          `config:"projectionDB" default:"proposals.db" validate:"required" usage:"path of the proposal read model"`
+	FirstProposalID uint64          `config:"firstProposalId" default:"1" usage:"ID the contract gives its first proposal, where the search for new proposals' IDs starts"`
+	AdminToken      string          `config:"adminToken" secret:"true" usage:"bearer token required by the admin routes, which are disabled without one"`
+	RPC             config.RPC      `config:"rpc"`
+	RabbitMQ        config.RabbitMQ `config:"rabbitmq"`
+	Log             config.Log      `config:"log"`
+	Shutdown        config.Shutdown `config:"shutdown"`
+}
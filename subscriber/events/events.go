@@ -0,0 +1,163 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"shared/envelope"
+	"strings"
+)
+
+// Envelope is the publisher's event envelope as it arrives on events_queue.
+type Envelope = envelope.Envelope
+
+// Event is implemented by every typed contract event.
+type Event interface {
+	EventName() string
+}
+
+// Initialized is emitted once when the diamond is initialized.
+type Initialized struct {
+	Version uint64
+}
+
+// ThresholdSet is emitted when the approval threshold changes.
+type ThresholdSet struct {
+	Threshold *big.Int
+}
+
+// ApproverAdded is emitted when an approver is registered.
+type ApproverAdded struct {
+	Approver string
+}
+
+// ApproverDeleted is emitted when an approver is removed.
+type ApproverDeleted struct {
+	Approver string
+}
+
+// ProposalAdded is emitted when a new payout proposal is created.
+type ProposalAdded struct {
+	Recipient string
+	Amount    *big.Int
+}
+
+// ProposalApproved is emitted for every approval of a proposal.
+type ProposalApproved struct {
+	ProposalID *big.Int
+}
+
+// ProposalExecuted is emitted once a proposal reaches the threshold and is paid out.
+type ProposalExecuted struct {
+	ProposalID *big.Int
+}
+
+// DepositedEther is emitted when Ether is deposited into the contract.
+type DepositedEther struct {
+	Sender string
+	Amount *big.Int
+}
+
+func (Initialized) EventName() string      { return "Initialized" }
+func (ThresholdSet) EventName() string     { return "ThresholdSet" }
+func (ApproverAdded) EventName() string    { return "ApproverAdded" }
+func (ApproverDeleted) EventName() string  { return "ApproverDeleted" }
+func (ProposalAdded) EventName() string    { return "ProposalAdded" }
+func (ProposalApproved) EventName() string { return "ProposalApproved" }
+func (ProposalExecuted) EventName() string { return "ProposalExecuted" }
+func (DepositedEther) EventName() string   { return "DepositedEther" }
+
+// decoders turns the raw data map of an envelope into its typed event.
+var decoders = map[string]func(Args) (Event, error){
+	"Initialized": func(a Args) (Event, error) {
+		v, err := a.BigInt("version")
+		if err != nil {
+			return nil, err
+		}
+		return Initialized{Version: v.Uint64()}, nil
+	},
+	"ThresholdSet": func(a Args) (Event, error) {
+		v, err := a.BigInt("threshold")
+		return ThresholdSet{Threshold: v}, err
+	},
+	"ApproverAdded": func(a Args) (Event, error) {
+		v, err := a.Address("approver")
+		return ApproverAdded{Approver: v}, err
+	},
+	"ApproverDeleted": func(a Args) (Event, error) {
+		v, err := a.Address("approver")
+		return ApproverDeleted{Approver: v}, err
+	},
+	"ProposalAdded": func(a Args) (Event, error) {
+		recipient, err := a.Address("recipient")
+		if err != nil {
+			return nil, err
+		}
+		amount, err := a.BigInt("amount")
+		return ProposalAdded{Recipient: recipient, Amount: amount}, err
+	},
+	"ProposalApproved": func(a Args) (Event, error) {
+		v, err := a.BigInt("proposalId")
+		return ProposalApproved{ProposalID: v}, err
+	},
+	"ProposalExecuted": func(a Args) (Event, error) {
+		v, err := a.BigInt("_proposalId")
+		return ProposalExecuted{ProposalID: v}, err
+	},
+	"DepositedEther": func(a Args) (Event, error) {
+		sender, err := a.Address("sender")
+		if err != nil {
+			return nil, err
+		}
+		amount, err := a.BigInt("amount")
+		return DepositedEther{Sender: sender, Amount: amount}, err
+	},
+}
+
+// Decode converts an envelope into its typed event.
+func Decode(env Envelope) (Event, error) {
+	decode, ok := decoders[env.EventName]
+	if !ok {
+		return nil, fmt.Errorf("unknown event %q", env.EventName)
+	}
+	event, err := decode(Args(env.Args))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", env.EventName, err)
+	}
+	return event, nil
+}
+
+// Args gives typed access to the decoded event arguments.
+type Args map[string]json.RawMessage
+
+// BigInt reads a uint/int argument. The publisher sends them as decimal
+// strings; payloads from before the versioned envelope had JSON numbers, so
+// both are accepted.
+func (a Args) BigInt(name string) (*big.Int, error) {
+	raw, ok := a[name]
+	if !ok {
+		return nil, fmt.Errorf("missing argument %q", name)
+	}
+	text := strings.Trim(string(raw), `"`)
+	v, ok := new(big.Int).SetString(text, 0)
+	if !ok {
+		return nil, fmt.Errorf("argument %q is not an integer: %s", name, raw)
+	}
+	return v, nil
+}
+
+// Address reads an address argument.
+func (a Args) Address(name string) (string, error) {
+	raw, ok := a[name]
+	if !ok {
+		return "", fmt.Errorf("missing argument %q", name)
+	}
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", fmt.Errorf("argument %q is not an address: %s", name, raw)
+	}
+	if len(v) != 42 || !strings.HasPrefix(v, "0x") {
+		return "", fmt.Errorf("argument %q is not an address: %s", name, v)
+	}
+	return v, nil
+}
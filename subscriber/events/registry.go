@@ -0,0 +1,61 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"shared/envelope"
+)
+
+// ErrMalformed marks messages that can never be handled, no matter how often
+// they are redelivered.
+var ErrMalformed = errors.New("malformed event")
+
+// HandlerFunc handles one decoded event.
+type HandlerFunc func(env Envelope, event Event) error
+
+// Registry dispatches incoming events to the handlers registered for them.
+type Registry struct {
+	handlers map[string][]HandlerFunc
+}
+
+// NewRegistry creates an empty handler registry.
+func NewRegistry() *Registry {
+	return &Registry{handlers: make(map[string][]HandlerFunc)}
+}
+
+// Handle registers a typed handler for events of type E.
+func Handle[E Event](r *Registry, handler func(env Envelope, event E) error) {
+	var zero E
+	name := zero.EventName()
+	r.handlers[name] = append(r.handlers[name], func(env Envelope, event Event) error {
+		return handler(env, event.(E))
+	})
+}
+
+// Dispatch decodes a message body, JSON or Protobuf as its content type
+// says, and runs every handler registered for its event. Events without
+// handlers are ignored. Decoding failures are wrapped in ErrMalformed;
+// handler errors are returned as-is so the caller can requeue.
+func (r *Registry) Dispatch(contentType string, body []byte) error {
+	env, err := envelope.DecodeContent(contentType, body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	handlers := r.handlers[env.EventName]
+	if len(handlers) == 0 {
+		return nil
+	}
+
+	event, err := Decode(env)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	for _, handler := range handlers {
+		if err := handler(env, event); err != nil {
+			return fmt.Errorf("%s handler failed: %w", env.EventName, err)
+		}
+	}
+	return nil
+}
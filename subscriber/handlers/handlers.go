@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"shared/logging"
+	"subscriber/events"
+)
+
+var logger = logging.For("handlers")
+
+// Register wires the default handlers into the registry.
+func Register(r *events.Registry) {
+	events.Handle(r, func(env events.Envelope, e events.Initialized) error {
+		logger.Info("Contract initialized", "version", e.Version, "block", env.BlockNumber)
+		return nil
+	})
+	events.Handle(r, func(env events.Envelope, e events.ThresholdSet) error {
+		logger.Info("Approval threshold set", "threshold", e.Threshold.String(), "block", env.BlockNumber)
+		return nil
+	})
+	events.Handle(r, func(env events.Envelope, e events.ApproverAdded) error {
+		logger.Info("Approver added", "approver", e.Approver, "tx_hash", env.TransactionHash)
+		return nil
+	})
+	events.Handle(r, func(env events.Envelope, e events.ApproverDeleted) error {
+		logger.Info("Approver deleted", "approver", e.Approver, "tx_hash", env.TransactionHash)
+		return nil
+	})
+	events.Handle(r, func(env events.Envelope, e events.ProposalAdded) error {
+		logger.Info("Proposal added", "amount_wei", e.Amount.String(), "recipient", e.Recipient, "tx_hash", env.TransactionHash)
+		return nil
+	})
+	events.Handle(r, func(env events.Envelope, e events.ProposalApproved) error {
+		logger.Info("Proposal approved", "proposal_id", e.ProposalID.String(), "tx_hash", env.TransactionHash)
+		return nil
+	})
+	events.Handle(r, func(env events.Envelope, e events.ProposalExecuted) error {
+		logger.Info("Proposal executed", "proposal_id", e.ProposalID.String(), "tx_hash", env.TransactionHash)
+		return nil
+	})
+	events.Handle(r, func(env events.Envelope, e events.DepositedEther) error {
+		logger.Info("Ether deposited", "amount_wei", e.Amount.String(), "sender", e.Sender, "tx_hash", env.TransactionHash)
+		return nil
+	})
+}
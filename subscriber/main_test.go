@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"shared/broker"
+	"shared/codec"
+	"shared/envelope"
+	"subscriber/events"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// attempts counts the handler runs per proposal, failing a proposal's first
+// fail runs.
+type attempts struct {
+	mu   sync.Mutex
+	runs map[int64]int
+	fail map[int64]int
+}
+
+func (a *attempts) handle(_ events.Envelope, e events.ProposalApproved) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	id := e.ProposalID.Int64()
+	a.runs[id]++
+	if a.runs[id] <= a.fail[id] {
+		return errors.New("projection unavailable")
+	}
+	return nil
+}
+
+func (a *attempts) count(id int64) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.runs[id]
+}
+
+func subscribe(t *testing.T, fail map[int64]int) (*broker.Memory, *attempts) {
+	t.Helper()
+	a := &attempts{runs: map[int64]int{}, fail: fail}
+	registry := events.NewRegistry()
+	events.Handle(registry, a.handle)
+
+	m := broker.NewMemory()
+	consumer, err := consume(m.Channel(), registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { consumer.Stop(context.Background()) })
+	return m, a
+}
+
+func publishEvents(t *testing.T, m *broker.Memory, bodies ...string) {
+	t.Helper()
+	publisher := m.Channel()
+	for _, body := range bodies {
+		if err := publisher.Publish(broker.EventsQueue.Name, amqp.Publishing{Body: []byte(body)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func approved(id string) string {
+	return `{"eventName":"ProposalApproved","data":{"proposalId":"` + id + `"}}`
+}
+
+// settled waits until the handlers ran want times per proposal and nothing
+// is left to deliver.
+func settled(t *testing.T, m *broker.Memory, a *attempts, want map[int64]int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		done := m.Len(broker.EventsQueue.Name) == 0
+		for id, runs := range want {
+			done = done && a.count(id) == runs
+		}
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("handler runs = %v, want %v", a.runs, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Nothing is redelivered afterwards
+	time.Sleep(20 * time.Millisecond)
+	for id, runs := range want {
+		if got := a.count(id); got != runs {
+			t.Fatalf("proposal %d handled %d times, want %d", id, got, runs)
+		}
+	}
+}
+
+func TestFailedEventsAreRetriedOnce(t *testing.T) {
+	m, a := subscribe(t, map[int64]int{2: 1, 3: 5})
+
+	publishEvents(t, m, approved("1"), approved("2"), approved("3"))
+
+	// 1 succeeds, 2 succeeds on redelivery, 3 is dead-lettered after its
+	// retry
+	settled(t, m, a, map[int64]int{1: 1, 2: 2, 3: 2})
+	if n := m.Len(broker.EventsDeadLetters.Name); n != 1 {
+		t.Fatalf("%d dead letters, want 1", n)
+	}
+}
+
+func TestMalformedEventsAreDeadLettered(t *testing.T) {
+	m, a := subscribe(t, nil)
+
+	publishEvents(t, m, `{"eventName":`, approved("x"), approved("4"))
+
+	settled(t, m, a, map[int64]int{4: 1})
+	if n := m.Len(broker.EventsDeadLetters.Name); n != 2 {
+		t.Fatalf("%d dead letters, want 2", n)
+	}
+}
+
+func TestEventsAreDecodedByContentType(t *testing.T) {
+	m, a := subscribe(t, nil)
+
+	env := envelope.Envelope{
+		ID:            envelope.ID(1337, "0xabc", 0),
+		SchemaVersion: envelope.SchemaVersion,
+		EventName:     "ProposalApproved",
+		Args:          map[string]json.RawMessage{"proposalId": json.RawMessage(`"5"`)},
+	}
+	msg, err := codec.Publishing(codec.ContentTypeProtobuf, &env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Channel().Publish(broker.EventsQueue.Name, msg); err != nil {
+		t.Fatal(err)
+	}
+	// A Protobuf body labelled as JSON is malformed
+	if err := m.Channel().Publish(broker.EventsQueue.Name, amqp.Publishing{ContentType: codec.ContentTypeJSON, Body: msg.Body}); err != nil {
+		t.Fatal(err)
+	}
+
+	settled(t, m, a, map[int64]int{5: 1})
+}
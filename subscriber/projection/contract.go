@@ -0,0 +1,159 @@
+package projection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"subscriber/events"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// proposalABI is the part of the Diamond's ABI the projection reads.
+const proposalABI = `[
+	{"anonymous":false,"inputs":[{"indexed":false,"name":"recipient","type":"address"},{"indexed":false,"name":"amount","type":"uint256"}],"name":"ProposalAdded","type":"event"},
+	{"inputs":[{"name":"_proposalId","type":"uint256"}],"name":"getProposal","outputs":[{"name":"proposalId","type":"uint256"},{"name":"recipient","type":"address"},{"name":"amount","type":"uint256"},{"name":"approvals","type":"uint256"},{"name":"executed","type":"bool"}],"stateMutability":"view","type":"function"}
+]`
+
+var parsedProposalABI = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(proposalABI))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// ProposalIDs finds the ID the contract gave the proposal a ProposalAdded
+// event announces, which the event does not carry.
+type ProposalIDs interface {
+	ProposalID(ctx context.Context, env events.Envelope) (uint64, error)
+}
+
+// caller is the part of the RPC client Contract uses; *failover.Client
+// implements it.
+type caller interface {
+	CallContractAtHash(ctx context.Context, call ethereum.CallMsg, blockHash common.Hash) ([]byte, error)
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+}
+
+// Contract reads proposal IDs from the chain. The contract numbers proposals
+// from firstProposalID up and has no counter to read, so the number created
+// by the end of the event's block is found by searching getProposal at that
+// block, and the proposals the same block added after the event are taken
+// off it. Both are read at the block's hash, so a reorganisation cannot
+// change the answer for an event.
+type Contract struct {
+	client          caller
+	firstProposalID uint64
+}
+
+// NewContract returns a Contract reading proposals through client.
+func NewContract(client caller, firstProposalID uint64) *Contract {
+	return &Contract{client: client, firstProposalID: firstProposalID}
+}
+
+// ProposalID implements ProposalIDs.
+func (c *Contract) ProposalID(ctx context.Context, env events.Envelope) (uint64, error) {
+	address, block := common.HexToAddress(env.Address), common.HexToHash(env.BlockHash)
+	if block == (common.Hash{}) {
+		return 0, errors.New("event has no block hash")
+	}
+	last, ok, err := c.lastProposal(ctx, address, block)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("no proposal exists at block %s", env.BlockHash)
+	}
+
+	logs, err := c.client.FilterLogs(ctx, ethereum.FilterQuery{
+		BlockHash: &block,
+		Addresses: []common.Address{address},
+		Topics:    [][]common.Hash{{parsedProposalABI.Events["ProposalAdded"].ID}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the block's proposals: %w", err)
+	}
+	later := uint64(0)
+	for _, l := range logs {
+		if l.Index > env.LogIndex {
+			later++
+		}
+	}
+	if later > last-c.firstProposalID {
+		return 0, fmt.Errorf("block %s added %d proposals after the event, more than exist", env.BlockHash, later)
+	}
+	return last - later, nil
+}
+
+// lastProposal returns the highest proposal ID in use at the end of block,
+// doubling the step from firstProposalID until a proposal is missing, then
+// bisecting.
+func (c *Contract) lastProposal(ctx context.Context, address common.Address, block common.Hash) (uint64, bool, error) {
+	exists := func(id uint64) (bool, error) {
+		return c.exists(ctx, address, block, id)
+	}
+	ok, err := exists(c.firstProposalID)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	found, step := c.firstProposalID, uint64(1)
+	for {
+		ok, err := exists(found + step)
+		if err != nil {
+			return 0, false, err
+		}
+		if !ok {
+			break
+		}
+		found, step = found+step, step*2
+	}
+	// found exists and found+step does not
+	missing := found + step
+	for missing-found > 1 {
+		mid := found + (missing-found)/2
+		ok, err := exists(mid)
+		if err != nil {
+			return 0, false, err
+		}
+		if ok {
+			found = mid
+		} else {
+			missing = mid
+		}
+	}
+	return found, true, nil
+}
+
+// exists reports whether getProposal knows id at block. Unknown proposals
+// either revert or come back zeroed, without their ID.
+func (c *Contract) exists(ctx context.Context, address common.Address, block common.Hash, id uint64) (bool, error) {
+	input, err := parsedProposalABI.Pack("getProposal", new(big.Int).SetUint64(id))
+	if err != nil {
+		return false, err
+	}
+	output, err := c.client.CallContractAtHash(ctx, ethereum.CallMsg{To: &address, Data: input}, block)
+	if reverted(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read proposal %d: %w", id, err)
+	}
+	values, err := parsedProposalABI.Unpack("getProposal", output)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode proposal %d: %w", id, err)
+	}
+	proposalID, ok := values[0].(*big.Int)
+	return ok && proposalID.IsUint64() && proposalID.Uint64() == id, nil
+}
+
+func reverted(err error) bool {
+	var dataErr rpc.DataError
+	return err != nil && (errors.As(err, &dataErr) || strings.Contains(err.Error(), "execution reverted"))
+}
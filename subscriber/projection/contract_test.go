@@ -0,0 +1,69 @@
+package projection
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"subscriber/events"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// fakeChain holds first..last proposals at every block, and the ProposalAdded
+// logs of the block asked about.
+type fakeChain struct {
+	first, last uint64
+	added       []uint
+	calls       int
+}
+
+var errReverted = errors.New("execution reverted: proposal does not exist")
+
+func (f *fakeChain) CallContractAtHash(_ context.Context, call ethereum.CallMsg, _ common.Hash) ([]byte, error) {
+	f.calls++
+	values, err := parsedProposalABI.Methods["getProposal"].Inputs.Unpack(call.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	id := values[0].(*big.Int).Uint64()
+	if id < f.first || id > f.last {
+		return nil, errReverted
+	}
+	return parsedProposalABI.Methods["getProposal"].Outputs.Pack(new(big.Int).SetUint64(id), common.Address{}, big.NewInt(1), big.NewInt(0), false)
+}
+
+func (f *fakeChain) FilterLogs(_ context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	for _, index := range f.added {
+		logs = append(logs, types.Log{BlockHash: *q.BlockHash, Index: index})
+	}
+	return logs, nil
+}
+
+func TestContractProposalIDs(t *testing.T) {
+	chain := &fakeChain{first: 1, last: 1000, added: []uint{3, 5, 9}}
+	contract := NewContract(chain, 1)
+	env := events.Envelope{Address: "0xd1a", BlockHash: "0xb", LogIndex: 5}
+
+	id, err := contract.ProposalID(context.Background(), env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Proposal 1000 was added after the event, in the same block
+	if id != 999 {
+		t.Fatalf("ID %d, want 999", id)
+	}
+	if chain.calls > 25 {
+		t.Fatalf("%d calls to find the last of 1000 proposals", chain.calls)
+	}
+
+	if _, err := NewContract(&fakeChain{first: 1}, 1).ProposalID(context.Background(), env); err == nil {
+		t.Fatal("found an ID with no proposals")
+	}
+	if _, err := contract.ProposalID(context.Background(), events.Envelope{Address: "0xd1a"}); err == nil {
+		t.Fatal("found an ID without a block hash")
+	}
+}
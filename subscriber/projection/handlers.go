@@ -0,0 +1,19 @@
+package projection
+
+import "subscriber/events"
+
+// Register subscribes the store to the events that shape the proposal read model.
+func Register(r *events.Registry, s *Store) {
+	events.Handle(r, func(env events.Envelope, e events.ThresholdSet) error {
+		return s.Apply(env, e)
+	})
+	events.Handle(r, func(env events.Envelope, e events.ProposalAdded) error {
+		return s.Apply(env, e)
+	})
+	events.Handle(r, func(env events.Envelope, e events.ProposalApproved) error {
+		return s.Apply(env, e)
+	})
+	events.Handle(r, func(env events.Envelope, e events.ProposalExecuted) error {
+		return s.Apply(env, e)
+	})
+}
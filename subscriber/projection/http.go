@@ -0,0 +1,68 @@
+package projection
+
+import (
+	"shared/admin"
+	"shared/logging"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var logger = logging.For("projection")
+
+// Routes exposes the read model over HTTP. Rebuilding it rewrites the whole
+// database, so it is only served to requests sending token as a bearer token.
+func (s *Store) Routes(router fiber.Router, token string) {
+	router.Get("/proposals", s.listProposals)
+	router.Get("/proposals/:id", s.getProposal)
+	if routes, ok := admin.Group(router, "/admin/proposals", token); ok {
+		routes.Post("/rebuild", s.rebuild)
+	}
+}
+
+// listProposals returns all proposals, optionally filtered with ?executed=true|false.
+func (s *Store) listProposals(c *fiber.Ctx) error {
+	var executed *bool
+	if raw := c.Query("executed"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "executed must be true or false"})
+		}
+		executed = &v
+	}
+
+	proposals, err := s.Proposals(executed)
+	if err != nil {
+		logger.ErrorContext(c.UserContext(), "Failed to list proposals", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(proposals)
+}
+
+func (s *Store) getProposal(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid proposal ID"})
+	}
+
+	proposal, err := s.Proposal(id)
+	if err != nil {
+		logger.ErrorContext(c.UserContext(), "Failed to load proposal", "proposal_id", id, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if proposal == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "proposal not found"})
+	}
+	return c.JSON(proposal)
+}
+
+// rebuild replays the journal into a fresh read model.
+func (s *Store) rebuild(c *fiber.Ctx) error {
+	applied, err := s.Rebuild()
+	if err != nil {
+		logger.ErrorContext(c.UserContext(), "Failed to rebuild proposals", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	logger.InfoContext(c.UserContext(), "Rebuilt proposal read model", "events", applied)
+	return c.JSON(fiber.Map{"message": "Rebuild complete", "events": applied})
+}
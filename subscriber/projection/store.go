@@ -0,0 +1,359 @@
+package projection
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"subscriber/events"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	journalBucket   = []byte("journal")
+	proposalsBucket = []byte("proposals")
+	metaBucket      = []byte("meta")
+
+	thresholdKey = []byte("threshold")
+)
+
+// BlockRef points at the block and transaction an event was emitted in.
+type BlockRef struct {
+	BlockNumber     uint64 `json:"blockNumber"`
+	TransactionHash string `json:"transactionHash"`
+}
+
+// Proposal is the current view of one proposal, folded from its events.
+type Proposal struct {
+	ID           uint64    `json:"id"`
+	Recipient    string    `json:"recipient"`
+	Amount       string    `json:"amount"`
+	Approvals    int       `json:"approvals"`
+	Approvers    []string  `json:"approvers"`
+	Threshold    string    `json:"threshold"`
+	Executed     bool      `json:"executed"`
+	Created      *BlockRef `json:"created,omitempty"`
+	LastApproved *BlockRef `json:"lastApproved,omitempty"`
+	ExecutedAt   *BlockRef `json:"executedAt,omitempty"`
+}
+
+// Store keeps the proposal read model in a bbolt database. Every applied
+// event is also written to a journal keyed by block and log index, which
+// makes redelivered and replayed events no-ops and lets the model be
+// rebuilt.
+//
+// The journal is the source of truth: the model only knows the events the
+// subscriber has received. To build it from chain history, start from an
+// empty database and have the publisher replay the contract's events from
+// its deployment block (POST /admin/replays).
+type Store struct {
+	db  *bolt.DB
+	ids ProposalIDs
+}
+
+// journaled is a journal entry: the event, and for ProposalAdded the ID the
+// contract gave the proposal, so rebuilding does not read the chain again.
+type journaled struct {
+	Envelope   events.Envelope `json:"envelope"`
+	ProposalID *uint64         `json:"proposalId,omitempty"`
+}
+
+// lookupTimeout bounds reading a new proposal's ID from the chain.
+const lookupTimeout = 30 * time.Second
+
+// Open opens (or creates) the projection database at path. ProposalAdded
+// carries no ID, so ids is asked for the one the contract assigned.
+func Open(path string, ids ProposalIDs) (*Store, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open projection database: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{journalBucket, proposalsBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create projection buckets: %w", err)
+	}
+	return &Store{db: db, ids: ids}, nil
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Apply folds one event into the read model. Events already in the journal
+// are ignored; events arriving out of order, as backfills and replays
+// deliver them, fold in as they come, since proposals are found by the IDs
+// the chain gave them. An event from a block that replaced one at the same
+// height in a reorganisation drops the journaled events of the replaced
+// block, and the model is rebuilt without them.
+func (s *Store) Apply(env events.Envelope, event events.Event) error {
+	key := journalKey(env)
+	var seen bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		seen = tx.Bucket(journalBucket).Get(key) != nil
+		return nil
+	})
+	if err != nil || seen {
+		return err
+	}
+
+	entry := journaled{Envelope: env}
+	if _, ok := event.(events.ProposalAdded); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+		defer cancel()
+		id, err := s.ids.ProposalID(ctx, env)
+		if err != nil {
+			return fmt.Errorf("failed to read the ID of the proposal added in %s: %w", env.TransactionHash, err)
+		}
+		entry.ProposalID = &id
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		journal := tx.Bucket(journalBucket)
+		if journal.Get(key) != nil {
+			return nil
+		}
+		raw, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err := journal.Put(key, raw); err != nil {
+			return err
+		}
+		replaced, err := dropReplaced(journal, key)
+		if err != nil {
+			return err
+		}
+		if replaced {
+			_, err := s.refold(tx)
+			return err
+		}
+		return s.apply(tx, entry, event)
+	})
+}
+
+// dropReplaced deletes the journaled events from the same height as key but
+// another block, and reports whether there were any.
+func dropReplaced(journal *bolt.Bucket, key []byte) (bool, error) {
+	var replaced [][]byte
+	c := journal.Cursor()
+	for k, _ := c.Seek(key[:8]); k != nil && bytes.HasPrefix(k, key[:8]); k, _ = c.Next() {
+		if !bytes.Equal(k[8:40], key[8:40]) {
+			replaced = append(replaced, k)
+		}
+	}
+	for _, k := range replaced {
+		if err := journal.Delete(k); err != nil {
+			return false, err
+		}
+	}
+	return len(replaced) > 0, nil
+}
+
+// Rebuild drops the read model and re-folds every journaled event in chain order.
+func (s *Store) Rebuild() (int, error) {
+	var applied int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		applied, err = s.refold(tx)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to rebuild projection: %w", err)
+	}
+	return applied, nil
+}
+
+func (s *Store) refold(tx *bolt.Tx) (int, error) {
+	for _, name := range [][]byte{proposalsBucket, metaBucket} {
+		if err := tx.DeleteBucket(name); err != nil {
+			return 0, err
+		}
+		if _, err := tx.CreateBucket(name); err != nil {
+			return 0, err
+		}
+	}
+	applied := 0
+	err := tx.Bucket(journalBucket).ForEach(func(_, raw []byte) error {
+		var entry journaled
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return err
+		}
+		event, err := events.Decode(entry.Envelope)
+		if err != nil {
+			return err
+		}
+		applied++
+		return s.apply(tx, entry, event)
+	})
+	return applied, err
+}
+
+// Proposal returns a single proposal by ID.
+func (s *Store) Proposal(id uint64) (*Proposal, error) {
+	var p *Proposal
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		p, err = getProposal(tx, id)
+		return err
+	})
+	return p, err
+}
+
+// Proposals returns every proposal in ID order, optionally filtered by
+// execution state.
+func (s *Store) Proposals(executed *bool) ([]Proposal, error) {
+	proposals := []Proposal{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(proposalsBucket).ForEach(func(_, raw []byte) error {
+			var p Proposal
+			if err := json.Unmarshal(raw, &p); err != nil {
+				return err
+			}
+			if executed == nil || p.Executed == *executed {
+				proposals = append(proposals, p)
+			}
+			return nil
+		})
+	})
+	return proposals, err
+}
+
+// Stats summarises the projection for the status endpoint.
+type Stats struct {
+	Proposals int    `json:"proposals"`
+	Events    int    `json:"events"`
+	LastBlock uint64 `json:"lastBlock"`
+}
+
+// Stats counts proposals and journalled events and reports the block of the
+// latest event applied.
+func (s *Store) Stats() (Stats, error) {
+	var stats Stats
+	err := s.db.View(func(tx *bolt.Tx) error {
+		stats.Proposals = tx.Bucket(proposalsBucket).Stats().KeyN
+		journal := tx.Bucket(journalBucket)
+		stats.Events = journal.Stats().KeyN
+		if key, _ := journal.Cursor().Last(); key != nil {
+			stats.LastBlock = binary.BigEndian.Uint64(key[:8])
+		}
+		return nil
+	})
+	return stats, err
+}
+
+func (s *Store) apply(tx *bolt.Tx, entry journaled, event events.Event) error {
+	env := entry.Envelope
+	meta := tx.Bucket(metaBucket)
+	ref := &BlockRef{BlockNumber: env.BlockNumber, TransactionHash: env.TransactionHash}
+
+	switch e := event.(type) {
+	case events.ThresholdSet:
+		return meta.Put(thresholdKey, []byte(e.Threshold.String()))
+
+	case events.ProposalAdded:
+		if entry.ProposalID == nil {
+			return fmt.Errorf("proposal added in %s has no ID", env.TransactionHash)
+		}
+		id := *entry.ProposalID
+		p, err := getProposal(tx, id)
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			p = &Proposal{ID: id, Approvers: []string{}}
+		}
+		p.Recipient = e.Recipient
+		p.Amount = e.Amount.String()
+		p.Threshold = string(meta.Get(thresholdKey))
+		p.Created = ref
+		return putProposal(tx, p)
+
+	case events.ProposalApproved:
+		p, err := proposalForEvent(tx, e.ProposalID)
+		if err != nil {
+			return err
+		}
+		p.Approvals++
+		if env.From != "" {
+			p.Approvers = append(p.Approvers, env.From)
+		}
+		p.LastApproved = ref
+		return putProposal(tx, p)
+
+	case events.ProposalExecuted:
+		p, err := proposalForEvent(tx, e.ProposalID)
+		if err != nil {
+			return err
+		}
+		p.Executed = true
+		p.ExecutedAt = ref
+		return putProposal(tx, p)
+	}
+	return nil
+}
+
+// proposalForEvent loads the proposal an event refers to. Proposals created
+// before the projection started are represented by a stub so their approvals
+// are still counted.
+func proposalForEvent(tx *bolt.Tx, proposalID *big.Int) (*Proposal, error) {
+	if !proposalID.IsUint64() {
+		return nil, fmt.Errorf("proposal ID %s out of range", proposalID)
+	}
+	id := proposalID.Uint64()
+	p, err := getProposal(tx, id)
+	if err != nil || p != nil {
+		return p, err
+	}
+	return &Proposal{ID: id, Approvers: []string{}}, nil
+}
+
+func getProposal(tx *bolt.Tx, id uint64) (*Proposal, error) {
+	raw := tx.Bucket(proposalsBucket).Get(uint64Key(id))
+	if raw == nil {
+		return nil, nil
+	}
+	var p Proposal
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, fmt.Errorf("failed to decode proposal %d: %w", id, err)
+	}
+	return &p, nil
+}
+
+func putProposal(tx *bolt.Tx, p *Proposal) error {
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(proposalsBucket).Put(uint64Key(p.ID), raw)
+}
+
+// journalKey orders events by block number, then log index within the
+// block. The block hash between them tells apart the events of blocks that
+// replaced each other at the same height.
+func journalKey(env events.Envelope) []byte {
+	key := make([]byte, 48)
+	binary.BigEndian.PutUint64(key[:8], env.BlockNumber)
+	copy(key[8:40], common.HexToHash(env.BlockHash).Bytes())
+	binary.BigEndian.PutUint64(key[40:], uint64(env.LogIndex))
+	return key
+}
+
+func uint64Key(v uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, v)
+	return key
+}
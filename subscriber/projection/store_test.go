@@ -0,0 +1,177 @@
+package projection
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"subscriber/events"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	bolt "go.etcd.io/bbolt"
+)
+
+// chainIDs answers proposal IDs by the transaction that added them.
+type chainIDs map[string]uint64
+
+func (ids chainIDs) ProposalID(_ context.Context, env events.Envelope) (uint64, error) {
+	id, ok := ids[env.TransactionHash]
+	if !ok {
+		return 0, fmt.Errorf("no proposal added in %s", env.TransactionHash)
+	}
+	return id, nil
+}
+
+func open(t *testing.T, ids chainIDs) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "proposals.db"), ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func apply(t *testing.T, s *Store, env events.Envelope) {
+	t.Helper()
+	event, err := events.Decode(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Apply(env, event); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// journalSize counts the events in the journal.
+func journalSize(t *testing.T, s *Store) int {
+	t.Helper()
+	var n int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(journalBucket).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func added(block uint64, tx, recipient string) events.Envelope {
+	return events.Envelope{
+		EventName:       "ProposalAdded",
+		BlockNumber:     block,
+		BlockHash:       fmt.Sprintf("0x%x", block),
+		TransactionHash: tx,
+		Args: map[string]json.RawMessage{
+			"recipient": json.RawMessage(`"` + recipient + `"`),
+			"amount":    json.RawMessage(`"100"`),
+		},
+	}
+}
+
+func approved(block uint64, blockHash string, logIndex uint, id int) events.Envelope {
+	return events.Envelope{
+		EventName:   "ProposalApproved",
+		BlockNumber: block,
+		BlockHash:   blockHash,
+		LogIndex:    logIndex,
+		Args:        map[string]json.RawMessage{"proposalId": json.RawMessage(fmt.Sprintf(`"%d"`, id))},
+	}
+}
+
+const (
+	first  = "0x00000000000000000000000000000000000000aA"
+	second = "0x00000000000000000000000000000000000000bB"
+)
+
+func TestProposalIDsComeFromTheChain(t *testing.T) {
+	s := open(t, chainIDs{"0x1": 7, "0x2": 8})
+
+	// A backfilled proposal and its approval arrive after a later one, then
+	// are replayed
+	apply(t, s, added(20, "0x2", second))
+	apply(t, s, approved(11, "0xb", 0, 7))
+	apply(t, s, added(10, "0x1", first))
+	apply(t, s, added(10, "0x1", first))
+	apply(t, s, approved(11, "0xb", 0, 7))
+
+	proposals, err := s.Proposals(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proposals) != 2 || proposals[0].ID != 7 || proposals[0].Recipient != first || proposals[0].Approvals != 1 ||
+		proposals[1].ID != 8 || proposals[1].Recipient != second {
+		t.Fatalf("proposals %+v", proposals)
+	}
+
+	if _, err := s.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt, _ := s.Proposals(nil); len(rebuilt) != 2 || rebuilt[0].ID != 7 || rebuilt[0].Approvals != 1 {
+		t.Fatalf("rebuilt %+v", rebuilt)
+	}
+
+	// Without an ID from the chain, the event is not journaled
+	if err := s.Apply(added(30, "0x3", first), events.ProposalAdded{}); err == nil {
+		t.Fatal("applied a proposal without its ID")
+	}
+	if n := journalSize(t, s); n != 3 {
+		t.Fatalf("%d events journaled, want 3", n)
+	}
+}
+
+func TestReorganisedBlocksAreDropped(t *testing.T) {
+	s := open(t, chainIDs{"0x1": 1})
+	apply(t, s, added(10, "0x1", first))
+	apply(t, s, approved(11, "0xa", 0, 1))
+	apply(t, s, approved(11, "0xa", 1, 1))
+
+	// Block 11 is replaced by one with a single approval at the same index
+	apply(t, s, approved(11, "0xb", 0, 1))
+
+	p, err := s.Proposal(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Approvals != 1 || p.Recipient != first {
+		t.Fatalf("proposal %+v", p)
+	}
+	if n := journalSize(t, s); n != 2 {
+		t.Fatalf("%d events journaled, want 2", n)
+	}
+}
+
+func TestRebuildNeedsTheAdminToken(t *testing.T) {
+	s := open(t, chainIDs{})
+	app := fiber.New()
+	s.Routes(app, "token")
+
+	for _, test := range []struct {
+		method, path, authorization string
+		want                        int
+	}{
+		{"GET", "/proposals", "", fiber.StatusOK},
+		{"POST", "/admin/proposals/rebuild", "", fiber.StatusUnauthorized},
+		{"POST", "/admin/proposals/rebuild", "Bearer token", fiber.StatusOK},
+	} {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		req.Header.Set("Authorization", test.authorization)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.want {
+			t.Errorf("%s %s with %q got %d, want %d", test.method, test.path, test.authorization, resp.StatusCode, test.want)
+		}
+	}
+
+	// Without a configured token, rebuilding is not served at all
+	disabled := fiber.New()
+	s.Routes(disabled, "")
+	if resp, _ := disabled.Test(httptest.NewRequest("POST", "/admin/proposals/rebuild", nil)); resp.StatusCode != fiber.StatusNotFound {
+		t.Fatalf("rebuild without a configured token got %d", resp.StatusCode)
+	}
+}